@@ -0,0 +1,216 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Duration is a duration that is written as a string like 500ms in the
+// configuration file
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON marshals the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON unmarshals the duration from a string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	err := json.Unmarshal(data, &value)
+	if err != nil {
+		return err
+	}
+	d.Duration, err = time.ParseDuration(value)
+	return err
+}
+
+// Motion is how an action drives the wheels, the speeds are fractions of the
+// drive speed and a motion with a duration stops once it has run for it
+type Motion struct {
+	Left, Right float64
+	Duration    Duration
+}
+
+// Forward returns true if the motion moves the robot forward
+func (m Motion) Forward() bool {
+	return m.Left+m.Right > 0
+}
+
+// Moves returns true if the motion turns any wheel
+func (m Motion) Moves() bool {
+	return m.Left != 0 || m.Right != 0
+}
+
+const (
+	// GripOpenName opens the gripper
+	GripOpenName = "open"
+	// GripCloseName closes the gripper
+	GripCloseName = "close"
+)
+
+const (
+	// LightToggle toggles the lights
+	LightToggle = "toggle"
+	// LightOn turns the lights on
+	LightOn = "on"
+	// LightOff turns the lights off
+	LightOff = "off"
+)
+
+// GimbalTarget is where the gimbal points in degrees
+type GimbalTarget struct {
+	X, Y float64
+}
+
+// Effect is what an action does, the parts that are not set are left as
+// they are
+type Effect struct {
+	// Motion drives the wheels
+	Motion *Motion
+	// Light is toggle, on or off
+	Light string
+	// Gimbal points the gimbal
+	Gimbal *GimbalTarget
+	// Snapshot takes a snapshot of the cameras
+	Snapshot bool
+	// Brightness is the change of the brightness of the lights
+	Brightness int
+	// Outputs set the pwm of the named outputs
+	Outputs map[string]int
+	// Grip is open or close, the gripper of the arm
+	Grip string
+	// Cooldown is how long the action is ignored after it runs
+	Cooldown Duration
+}
+
+// Effects maps the actions to what they do
+type Effects map[TypeAction]Effect
+
+// DefaultEffects are the effects used without a configuration file
+var DefaultEffects = Effects{
+	ActionNone:       {Motion: &Motion{Left: 0, Right: 0}},
+	ActionForward:    {Motion: &Motion{Left: 1, Right: 1}},
+	ActionBackward:   {Motion: &Motion{Left: -1, Right: -1, Duration: Duration{500 * time.Millisecond}}},
+	ActionLeft:       {Motion: &Motion{Left: -1, Right: 1}},
+	ActionRight:      {Motion: &Motion{Left: 1, Right: -1}},
+	ActionArcLeft:    {Motion: &Motion{Left: .5, Right: 1}},
+	ActionArcRight:   {Motion: &Motion{Left: 1, Right: .5}},
+	ActionPivotLeft:  {Motion: &Motion{Left: -1, Right: 1, Duration: Duration{250 * time.Millisecond}}},
+	ActionPivotRight: {Motion: &Motion{Left: 1, Right: -1, Duration: Duration{250 * time.Millisecond}}},
+	ActionBurst:      {Motion: &Motion{Left: 1, Right: 1, Duration: Duration{500 * time.Millisecond}}},
+	ActionLight:      {Light: LightToggle, Cooldown: Duration{2 * time.Second}},
+	ActionSnapshot:   {Snapshot: true, Cooldown: Duration{time.Second}},
+	ActionBrighter:   {Brightness: LightStep, Cooldown: Duration{500 * time.Millisecond}},
+	ActionDimmer:     {Brightness: -LightStep, Cooldown: Duration{500 * time.Millisecond}},
+	ActionGripOpen:   {Grip: GripOpenName, Cooldown: Duration{time.Second}},
+	ActionGripClose:  {Grip: GripCloseName, Cooldown: Duration{time.Second}},
+}
+
+// ParseAction looks up an action by its name
+func ParseAction(name string) (TypeAction, error) {
+	for action := TypeAction(0); action < ActionCount; action++ {
+		if action.String() == name {
+			return action, nil
+		}
+	}
+	return ActionCount, fmt.Errorf("unknown action %s", name)
+}
+
+// NewEffects creates the effects from the defaults replaced by the
+// configured effects keyed by action name, the outputs are the named outputs
+// the effects can set
+func NewEffects(config map[string]Effect, outputs map[string]OutputConfig) (Effects, error) {
+	effects := make(Effects, len(DefaultEffects))
+	for action, effect := range DefaultEffects {
+		effects[action] = effect
+	}
+	for name, effect := range config {
+		action, err := ParseAction(name)
+		if err != nil {
+			return nil, err
+		}
+		switch effect.Light {
+		case "", LightToggle, LightOn, LightOff:
+		default:
+			return nil, fmt.Errorf("unknown light %s for action %s", effect.Light, name)
+		}
+		for output := range effect.Outputs {
+			if _, ok := outputs[output]; !ok {
+				return nil, fmt.Errorf("unknown output %s for action %s", output, name)
+			}
+		}
+		switch effect.Grip {
+		case "", GripOpenName, GripCloseName:
+		default:
+			return nil, fmt.Errorf("unknown grip %s for action %s", effect.Grip, name)
+		}
+		effects[action] = effect
+	}
+	return effects, nil
+}
+
+// Executor runs the effects of the actions chosen by the mind, a motion runs
+// for its duration and an action is ignored during its cooldown
+type Executor struct {
+	Effects Effects
+	// Motion is the running motion
+	Motion  Motion
+	Started time.Time
+	Last    TypeAction
+	// Ready is when each action may run again
+	Ready map[TypeAction]time.Time
+}
+
+// NewExecutor creates a new executor
+func NewExecutor(effects Effects) *Executor {
+	return &Executor{
+		Effects: effects,
+		Last:    ActionNone,
+		Ready:   make(map[TypeAction]time.Time),
+	}
+}
+
+// Execute returns the effect of the action to apply now, ok is false while
+// the action is cooling down, a motion is restarted when the action changes
+// or the motion has run for its duration
+func (e *Executor) Execute(action TypeAction, now time.Time) (effect Effect, ok bool) {
+	if now.Before(e.Ready[action]) {
+		return Effect{}, false
+	}
+	effect = e.Effects[action]
+	if cooldown := effect.Cooldown.Duration; cooldown > 0 {
+		e.Ready[action] = now.Add(cooldown)
+	}
+	if m := effect.Motion; m != nil && (action != e.Last || *m != e.Motion || e.Done(now)) {
+		e.Motion, e.Started = *m, now
+	}
+	e.Last = action
+	return effect, true
+}
+
+// Done returns true if the running motion has run for its duration
+func (e *Executor) Done(now time.Time) bool {
+	duration := e.Motion.Duration.Duration
+	return duration > 0 && now.Sub(e.Started) >= duration
+}
+
+// Speeds returns the fractions of the drive speed of the running motion
+func (e *Executor) Speeds(now time.Time) (left, right float64) {
+	if e.Done(now) {
+		return 0, 0
+	}
+	return e.Motion.Left, e.Motion.Right
+}
+
+// Stop stops the running motion
+func (e *Executor) Stop() {
+	e.Motion, e.Last = Motion{}, ActionNone
+}
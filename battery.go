@@ -0,0 +1,135 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BatteryLevel is how depleted the battery is
+type BatteryLevel uint
+
+const (
+	// BatteryNormal the robot drives normally
+	BatteryNormal BatteryLevel = iota
+	// BatterySlow the maximum speed is reduced
+	BatterySlow
+	// BatteryFlash the maximum speed is reduced and the lights flash
+	BatteryFlash
+	// BatteryEmpty the robot refuses to drive
+	BatteryEmpty
+)
+
+// String returns the name of the battery level
+func (b BatteryLevel) String() string {
+	switch b {
+	case BatteryNormal:
+		return "normal"
+	case BatterySlow:
+		return "slow"
+	case BatteryFlash:
+		return "flash"
+	case BatteryEmpty:
+		return "empty"
+	}
+	return "unknown"
+}
+
+// BatteryDecay is the decay of the running mean of the battery voltage that
+// smooths the sag under load
+const BatteryDecay = .9
+
+// BatteryFlashPeriod is the time between the flashes of the lights
+const BatteryFlashPeriod = 300 * time.Millisecond
+
+// BatteryHysteresis is how far in volts the voltage has to recover above a
+// threshold to leave its level, the voltage rises once the load is reduced
+const BatteryHysteresis = .2
+
+// Battery monitors the battery voltage reported by the rover, a threshold of
+// 0 is disabled
+type Battery struct {
+	sync.Mutex
+	// Slow, Flash and Min are the voltages below which the levels start
+	Slow, Flash, Min float64
+	// Voltage is the running mean of the fresh reported voltages
+	Voltage float64
+	Level   BatteryLevel
+}
+
+// NewBattery creates a new battery monitor
+func NewBattery(slow, flash, min float64) *Battery {
+	return &Battery{
+		Slow:  slow,
+		Flash: flash,
+		Min:   min,
+	}
+}
+
+// Update updates the voltage from the rover state and returns the level, an
+// empty battery stays empty until the robot is restarted
+func (b *Battery) Update(state RoverState) BatteryLevel {
+	b.Lock()
+	defer b.Unlock()
+	if !state.Fresh(RoverStale) || state.Voltage <= 0 {
+		return b.Level
+	}
+	if b.Voltage == 0 {
+		b.Voltage = state.Voltage
+	} else {
+		b.Voltage = BatteryDecay*b.Voltage + (1-BatteryDecay)*state.Voltage
+	}
+	level := b.classify(b.Voltage)
+	if level < b.Level {
+		// an empty battery is latched because the voltage recovers once the
+		// motors stop, the other levels need a margin to recover
+		if b.Level == BatteryEmpty {
+			level = BatteryEmpty
+		} else {
+			level = b.classify(b.Voltage - BatteryHysteresis)
+			if level > b.Level {
+				level = b.Level
+			}
+		}
+	}
+	if level != b.Level {
+		fmt.Printf("battery %.2fV %s\n", b.Voltage, level)
+	}
+	b.Level = level
+	return level
+}
+
+// classify returns the level of a voltage
+func (b *Battery) classify(voltage float64) BatteryLevel {
+	below := func(threshold float64) bool {
+		return threshold > 0 && voltage < threshold
+	}
+	switch {
+	case below(b.Min):
+		return BatteryEmpty
+	case below(b.Flash):
+		return BatteryFlash
+	case below(b.Slow):
+		return BatterySlow
+	}
+	return BatteryNormal
+}
+
+// Get returns the battery level
+func (b *Battery) Get() BatteryLevel {
+	b.Lock()
+	defer b.Unlock()
+	return b.Level
+}
+
+// Mean returns the running mean of the battery voltage, 0 if none was
+// reported
+func (b *Battery) Mean() float64 {
+	b.Lock()
+	defer b.Unlock()
+	return b.Voltage
+}
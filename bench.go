@@ -0,0 +1,113 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// LoadFrames loads the images of a directory sorted by name as frames, so a
+// recorded session of numbered frames is replayed in order
+func LoadFrames(dir string) ([]Frame, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	var frames []Frame
+	for _, name := range names {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		img, _, err := image.Decode(f)
+		f.Close()
+		if err != nil {
+			// files that are not images are skipped
+			continue
+		}
+		bounds := img.Bounds()
+		gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+		draw.Draw(gray, gray.Bounds(), img, bounds.Min, draw.Src)
+		frames = append(frames, Frame{
+			Thumb: img,
+			Gray:  gray,
+		})
+	}
+	return frames, nil
+}
+
+// BenchSensors runs every registered sensor over the frames in a directory,
+// writes the latency, allocations and values of each frame to a csv file and
+// prints a summary of each sensor
+func BenchSensors(dir string) {
+	frames, err := LoadFrames(dir)
+	if err != nil {
+		panic(err)
+	}
+	if len(frames) == 0 {
+		panic(fmt.Errorf("no images in %s", dir))
+	}
+	f, err := os.Create(*FlagBenchOutput)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	writer := csv.NewWriter(f)
+	defer writer.Flush()
+	err = writer.Write([]string{"sensor", "frame", "latency_ns", "allocs", "values"})
+	if err != nil {
+		panic(err)
+	}
+
+	var before, after runtime.MemStats
+	for _, name := range SensorNames() {
+		sensor, err := NewSensor(name, noise())
+		if err != nil {
+			panic(err)
+		}
+		var latency time.Duration
+		var allocs uint64
+		for i := range frames {
+			runtime.ReadMemStats(&before)
+			start := time.Now()
+			values := sensor.Sense(&frames[i])
+			elapsed := time.Since(start)
+			runtime.ReadMemStats(&after)
+			latency += elapsed
+			allocs += after.Mallocs - before.Mallocs
+			record := []string{name, strconv.Itoa(i),
+				strconv.FormatInt(elapsed.Nanoseconds(), 10),
+				strconv.FormatUint(after.Mallocs-before.Mallocs, 10)}
+			for _, value := range values {
+				record = append(record, strconv.FormatFloat(value, 'f', -1, 64))
+			}
+			err := writer.Write(record)
+			if err != nil {
+				panic(err)
+			}
+		}
+		fmt.Printf("%s latency %v allocs %d\n", name,
+			latency/time.Duration(len(frames)), allocs/uint64(len(frames)))
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const (
+	// BridgePeriod is the time between the packets of the bridge client
+	BridgePeriod = 50 * time.Millisecond
+	// BridgeTimeout is how long the robot drives after the last packet
+	BridgeTimeout = 500 * time.Millisecond
+	// BridgeRepeat is how long an input is repeated in the packets so a
+	// dropped packet does not lose it
+	BridgeRepeat = time.Second
+)
+
+// BridgeInput is an input of a button of the remote game controller
+type BridgeInput struct {
+	// Seq is the sequence number of the input, an input is handled once
+	Seq  uint64
+	Name string
+	// Time is when the button was pressed on the client
+	Time time.Time `json:"-"`
+}
+
+// BridgePacket is the state of the remote game controller, it is sent as the
+// hex hmac of the json with the shared secret of the kill switch, a space and
+// the json
+type BridgePacket struct {
+	// Seq is the sequence number of the packet, older packets are dropped
+	Seq uint64
+	// Time is when the packet was sent in unix nanoseconds, packets older
+	// than KillWindow are dropped as replays
+	Time int64
+	// Axes are the raw game controller axes
+	Axes [sdl.CONTROLLER_AXIS_MAX]int16
+	// Inputs are the recent inputs of the buttons
+	Inputs []BridgeInput
+}
+
+// Bridge receives the game controller of a laptop over udp, so the operator
+// does not need the controller paired to the robot
+type Bridge struct {
+	sync.Mutex
+	// Secret is the shared secret of the packets
+	Secret []byte
+	// Axes are the axes of the last packet
+	Axes [sdl.CONTROLLER_AXIS_MAX]int16
+	// Until is when the last packet expires
+	Until time.Time
+	// Driving is true if the bridge was driving at the last call of Get
+	Driving bool
+	// Seq and InputSeq are the last sequence numbers of the packets and
+	// inputs
+	Seq, InputSeq uint64
+	// Inputs are the inputs of the buttons
+	Inputs chan Input
+}
+
+// NewBridge creates a new bridge
+func NewBridge(secret string) *Bridge {
+	return &Bridge{
+		Secret: []byte(secret),
+		Inputs: make(chan Input, 8),
+	}
+}
+
+// Receive handles a packet from the client
+func (b *Bridge) Receive(packet BridgePacket) {
+	b.Lock()
+	defer b.Unlock()
+	if packet.Seq <= b.Seq {
+		return
+	}
+	b.Seq = packet.Seq
+	b.Axes, b.Until = packet.Axes, time.Now().Add(BridgeTimeout)
+	for _, bridged := range packet.Inputs {
+		if bridged.Seq <= b.InputSeq {
+			continue
+		}
+		b.InputSeq = bridged.Seq
+		input, ok := ParseInput(bridged.Name)
+		if !ok || input.Held() {
+			fmt.Println("bridge: unknown input", bridged.Name)
+			continue
+		}
+		select {
+		case b.Inputs <- input:
+		default:
+		}
+	}
+}
+
+// Get returns the axes of the remote game controller, they are zero once the
+// packets stop, ok is false if the bridge is not driving now and was not at
+// the last call so it does not override the local joystick
+func (b *Bridge) Get(now time.Time) (axes [sdl.CONTROLLER_AXIS_MAX]int16, ok bool) {
+	b.Lock()
+	defer b.Unlock()
+	driving := now.Before(b.Until)
+	if driving {
+		axes = b.Axes
+	}
+	ok, b.Driving = driving || b.Driving, driving
+	return axes, ok
+}
+
+// Encode signs and encodes a packet with the secret
+func (b *Bridge) Encode(packet BridgePacket) ([]byte, error) {
+	data, err := json.Marshal(packet)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(Sign(b.Secret, string(data)) + " " + string(data)), nil
+}
+
+// Decode verifies and decodes a signed packet
+func (b *Bridge) Decode(data []byte, now time.Time) (BridgePacket, error) {
+	var packet BridgePacket
+	signature, message, found := strings.Cut(string(data), " ")
+	if !found || !hmac.Equal([]byte(signature), []byte(Sign(b.Secret, message))) {
+		return packet, fmt.Errorf("invalid bridge signature")
+	}
+	err := json.Unmarshal([]byte(message), &packet)
+	if err != nil {
+		return packet, err
+	}
+	if age := now.Sub(time.Unix(0, packet.Time)); age > KillWindow || age < -KillWindow {
+		return packet, fmt.Errorf("stale bridge packet")
+	}
+	return packet, nil
+}
+
+// Listen receives the signed packets on the udp address until the listener
+// fails, the secret can't be empty
+func (b *Bridge) Listen(address string) error {
+	if len(b.Secret) == 0 {
+		return fmt.Errorf("the bridge needs the kill secret")
+	}
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	buffer := make([]byte, 4096)
+	for {
+		n, from, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return err
+		}
+		packet, err := b.Decode(buffer[:n], time.Now())
+		if err != nil {
+			fmt.Println("bridge:", from, err)
+			continue
+		}
+		b.Receive(packet)
+	}
+}
+
+// BridgeClient reads the local game controller and streams it to the bridge
+// of the robot at the udp address signed with the secret
+func BridgeClient(address, secret string) {
+	if secret == "" {
+		panic("the bridge needs the kill secret")
+	}
+	bridge := NewBridge(secret)
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+	sdl.Init(sdl.INIT_GAMECONTROLLER)
+	defer sdl.Quit()
+	sdl.GameControllerEventState(sdl.ENABLE)
+	controllers := NewControllers(false)
+	buttons := NewButtons()
+	// the sequence numbers start at the time so a restarted client is not
+	// taken for old packets
+	var packet BridgePacket
+	packet.Seq = uint64(time.Now().UnixNano())
+	seq := packet.Seq
+	last := time.Now()
+	for {
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch t := event.(type) {
+			case *sdl.QuitEvent:
+				return
+			case *sdl.ControllerAxisEvent:
+				packet.Axes[t.Axis] = t.Value
+			case *sdl.ControllerButtonEvent:
+				if input, ok := buttons.Input(t.Button, t.State == sdl.PRESSED); ok {
+					seq++
+					packet.Inputs = append(packet.Inputs, BridgeInput{
+						Seq:  seq,
+						Name: input.String(),
+						Time: time.Now(),
+					})
+					fmt.Println("bridge:", input)
+				}
+			case *sdl.ControllerDeviceEvent:
+				if t.Type == sdl.CONTROLLERDEVICEADDED {
+					controllers.Open(int(t.Which))
+				} else if t.Type == sdl.CONTROLLERDEVICEREMOVED {
+					controllers.Close(t.Which)
+				}
+			}
+		}
+		if time.Since(last) >= BridgePeriod {
+			last = time.Now()
+			// the inputs are repeated until they are old
+			for len(packet.Inputs) > 0 && time.Since(packet.Inputs[0].Time) > BridgeRepeat {
+				packet.Inputs = packet.Inputs[1:]
+			}
+			packet.Seq++
+			packet.Time = time.Now().UnixNano()
+			data, err := bridge.Encode(packet)
+			if err != nil {
+				panic(err)
+			}
+			_, err = conn.Write(data)
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+		sdl.Delay(5)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// AxisCalibration records the extents and the rest positions of the game
+// controller axes
+type AxisCalibration struct {
+	// Min, Center and Max are the raw extents and the rest positions
+	Min, Center, Max [sdl.CONTROLLER_AXIS_MAX]int16
+}
+
+// NewAxisCalibration creates a new calibration from the rest positions of the
+// axes
+func NewAxisCalibration(rest [sdl.CONTROLLER_AXIS_MAX]int16) *AxisCalibration {
+	return &AxisCalibration{
+		Min:    rest,
+		Center: rest,
+		Max:    rest,
+	}
+}
+
+// Record records a value of an axis
+func (c *AxisCalibration) Record(axis int, value int16) {
+	if value < c.Min[axis] {
+		c.Min[axis] = value
+	}
+	if value > c.Max[axis] {
+		c.Max[axis] = value
+	}
+}
+
+// Apply sets the extents of the axis maps by name, an axis that was not
+// moved is left alone, a side of an axis that was not moved is the end of the
+// axis and a new axis gets the deadzone and the expo
+func (c *AxisCalibration) Apply(maps map[string]AxisMap, deadzone, expo float64) map[string]AxisMap {
+	if maps == nil {
+		maps = make(map[string]AxisMap)
+	}
+	for axis, name := range AxisNames {
+		if c.Min[axis] == c.Max[axis] {
+			continue
+		}
+		mapping, ok := maps[name]
+		if !ok {
+			mapping = NewAxisMap(deadzone, expo)
+		}
+		mapping.Min, mapping.Center, mapping.Max = c.Min[axis], c.Center[axis], c.Max[axis]
+		if mapping.Min == mapping.Center {
+			mapping.Min = -AxisMax
+		}
+		if mapping.Max == mapping.Center {
+			mapping.Max = AxisMax
+		}
+		maps[name] = mapping
+	}
+	return maps
+}
+
+// Calibrate records the extents of the axes of the first game controller for
+// the duration and writes them to the axes of the config file, the other
+// settings of the file are kept
+func Calibrate(path string, duration time.Duration, deadzone, expo float64) {
+	if path == "" {
+		panic("the calibration needs a config file")
+	}
+	sdl.Init(sdl.INIT_GAMECONTROLLER)
+	defer sdl.Quit()
+	sdl.GameControllerEventState(sdl.ENABLE)
+	var (
+		controller  *sdl.GameController
+		calibration *AxisCalibration
+		end         time.Time
+	)
+	fmt.Println("calibrate: connect a game controller and leave the sticks at rest")
+	for calibration == nil || time.Now().Before(end) {
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch t := event.(type) {
+			case *sdl.QuitEvent:
+				return
+			case *sdl.ControllerDeviceEvent:
+				if t.Type != sdl.CONTROLLERDEVICEADDED || controller != nil {
+					continue
+				}
+				controller = sdl.GameControllerOpen(int(t.Which))
+				if controller == nil {
+					continue
+				}
+				defer controller.Close()
+				// the axes are at rest when the controller is connected
+				var rest [sdl.CONTROLLER_AXIS_MAX]int16
+				for axis := range rest {
+					rest[axis] = controller.Axis(sdl.GameControllerAxis(axis))
+				}
+				calibration, end = NewAxisCalibration(rest), time.Now().Add(duration)
+				fmt.Printf("calibrate: move the sticks and the triggers of %s to their ends for %v\n",
+					controller.Name(), duration)
+			case *sdl.ControllerAxisEvent:
+				if calibration != nil {
+					calibration.Record(int(t.Axis), t.Value)
+				}
+			}
+		}
+		sdl.Delay(5)
+	}
+	config := make(map[string]json.RawMessage)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &config)
+		if err != nil {
+			panic(err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		panic(err)
+	}
+	var maps map[string]AxisMap
+	if axes, ok := config["Axes"]; ok {
+		err = json.Unmarshal(axes, &maps)
+		if err != nil {
+			panic(err)
+		}
+	}
+	maps = calibration.Apply(maps, deadzone, expo)
+	for axis, name := range AxisNames {
+		fmt.Printf("calibrate: %s min %d center %d max %d\n", name,
+			calibration.Min[axis], calibration.Center[axis], calibration.Max[axis])
+	}
+	config["Axes"], err = json.Marshal(maps)
+	if err != nil {
+		panic(err)
+	}
+	data, err = json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	err = os.WriteFile(path, append(data, '\n'), 0644)
+	if err != nil {
+		panic(err)
+	}
+}
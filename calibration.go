@@ -0,0 +1,63 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// CalibrationOffset centers the z-scores in the range of the minds
+	CalibrationOffset = 128
+	// CalibrationScale is the width of one standard deviation in the range of
+	// the minds
+	CalibrationScale = 32
+)
+
+// Calibration normalizes each value of the observation to a z-score from its
+// running mean and variance, so the minds behave the same when the sensors
+// are swapped
+type Calibration struct {
+	// Decay is the decay of the running mean and variance, 0 disables
+	// calibration
+	Decay     float64
+	Means     []float64
+	Variances []float64
+}
+
+// NewCalibration creates a new calibration with the given decay
+func NewCalibration(decay float64) Calibration {
+	return Calibration{
+		Decay: decay,
+	}
+}
+
+// Normalize returns the z-scores of the observation scaled into the range of
+// the minds and updates the running statistics
+func (c *Calibration) Normalize(observation []float64) []float64 {
+	if c.Decay <= 0 {
+		return observation
+	}
+	if len(c.Means) != len(observation) {
+		if len(c.Means) != 0 {
+			panic(fmt.Errorf("calibration: the observation has %d values, it had %d", len(observation), len(c.Means)))
+		}
+		c.Means = append([]float64(nil), observation...)
+		c.Variances = make([]float64, len(observation))
+	}
+	normalized := make([]float64, len(observation))
+	for i, value := range observation {
+		z := 0.0
+		if deviation := math.Sqrt(c.Variances[i]); deviation > 1e-9 {
+			z = (value - c.Means[i]) / deviation
+		}
+		normalized[i] = math.Max(math.Min(CalibrationOffset+CalibrationScale*z, 255), 0)
+		delta := value - c.Means[i]
+		c.Means[i] += (1 - c.Decay) * delta
+		c.Variances[i] = c.Decay * (c.Variances[i] + (1-c.Decay)*delta*delta)
+	}
+	return normalized
+}
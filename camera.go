@@ -0,0 +1,342 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Camera is a source of frames
+type Camera interface {
+	// Start streams frames until the camera is stopped
+	Start()
+	// Frames returns the channel the frames are streamed to
+	Frames() chan Frame
+	// Health returns the health metrics of the camera
+	Health() CameraHealth
+}
+
+// CameraHealth are the health metrics of a camera
+type CameraHealth struct {
+	Streamed, Dropped, DecodeErrors uint64
+	// FPS is the smoothed frame rate
+	FPS float64
+	// Since is the time since the last frame, or since the camera was
+	// created if there is no frame
+	Since time.Duration
+}
+
+// String returns a string representation of the CameraHealth
+func (c CameraHealth) String() string {
+	return fmt.Sprintf("fps %.1f streamed %d dropped %d decode errors %d since last frame %s",
+		c.FPS, c.Streamed, c.Dropped, c.DecodeErrors, c.Since.Round(time.Millisecond))
+}
+
+// FrameCounters counts the frames streamed, dropped and that failed to decode
+// by a camera and tracks the frame rate, the counters are updated by the
+// goroutine of the camera and read atomically
+type FrameCounters struct {
+	Streamed     uint64
+	Dropped      uint64
+	DecodeErrors uint64
+	// Last is the time of the last frame in unix nanoseconds
+	Last int64
+	// Interval is the smoothed interval between frames in nanoseconds
+	Interval int64
+}
+
+// Health returns the health metrics of the camera
+func (f *FrameCounters) Health() CameraHealth {
+	health := CameraHealth{
+		Streamed:     atomic.LoadUint64(&f.Streamed),
+		Dropped:      atomic.LoadUint64(&f.Dropped),
+		DecodeErrors: atomic.LoadUint64(&f.DecodeErrors),
+	}
+	if interval := atomic.LoadInt64(&f.Interval); interval > 0 {
+		health.FPS = float64(time.Second) / float64(interval)
+	}
+	last := atomic.LoadInt64(&f.Last)
+	if last == 0 {
+		atomic.CompareAndSwapInt64(&f.Last, 0, time.Now().UnixNano())
+		last = atomic.LoadInt64(&f.Last)
+	}
+	health.Since = time.Duration(time.Now().UnixNano() - last)
+	return health
+}
+
+// DecodeError counts a frame that failed to decode
+func (f *FrameCounters) DecodeError() {
+	atomic.AddUint64(&f.DecodeErrors, 1)
+}
+
+// Stamp stamps a frame with its sequence number and if missing its capture
+// time and updates the frame rate
+func (f *FrameCounters) Stamp(frame *Frame) {
+	frame.Sequence = atomic.AddUint64(&f.Streamed, 1)
+	if frame.Time.IsZero() {
+		frame.Time = time.Now()
+	}
+	now := time.Now().UnixNano()
+	if last := atomic.SwapInt64(&f.Last, now); last != 0 && frame.Sequence > 1 {
+		interval := now - last
+		if previous := atomic.LoadInt64(&f.Interval); previous > 0 {
+			interval = (7*previous + interval) / 8
+		}
+		atomic.StoreInt64(&f.Interval, interval)
+	}
+}
+
+// Send sends a frame without blocking, when the sensors are slower than the
+// camera the oldest frame is dropped so the latest frame wins and its
+// thumbnail is reused, the frame is stamped first
+func (f *FrameCounters) Send(images chan Frame, frame Frame) {
+	f.Stamp(&frame)
+	for {
+		select {
+		case images <- frame:
+			return
+		default:
+		}
+		select {
+		case dropped := <-images:
+			atomic.AddUint64(&f.Dropped, 1)
+			// nothing saw the dropped frame so its thumbnail is reused
+			Thumbnails.Release(&dropped)
+		default:
+		}
+	}
+}
+
+// CameraConfig is the configuration of a camera
+type CameraConfig struct {
+	// Source is the name the frames of the camera are tagged with
+	Source string
+	Device string
+	// Width, Height and FPS are the requested frame size and rate
+	Width, Height, FPS int
+	// MJPEG streams motion jpeg and Decode decodes it
+	MJPEG, Decode bool
+	// H264 streams h.264 and Hardware decodes the compressed frames in a
+	// stream decoder
+	H264, Hardware bool
+	// Status receives the connection status events of the camera
+	Status chan<- CameraStatus
+	// Controls are the exposure, gain and white balance of the camera
+	Controls CameraControls
+}
+
+// CameraStatus is a connection status event of a camera
+type CameraStatus struct {
+	Source    string
+	Device    string
+	Connected bool
+	// Err is why the camera disconnected
+	Err error
+}
+
+// CameraFactory creates a camera
+type CameraFactory func(config CameraConfig) Camera
+
+// Cameras is the registry of camera backends
+var Cameras = map[string]CameraFactory{
+	"v4l": func(config CameraConfig) Camera {
+		camera := NewV4LCamera(config.Device, config.Width, config.Height, config.FPS)
+		camera.Source = config.Source
+		camera.MJPEG = config.MJPEG
+		camera.Decode = config.Decode
+		camera.H264 = config.H264
+		camera.Hardware = config.Hardware
+		camera.Status = config.Status
+		camera.Controls = config.Controls
+		return camera
+	},
+}
+
+// CameraNames returns the sorted names of the camera backends
+func CameraNames() []string {
+	names := make([]string, 0, len(Cameras))
+	for name := range Cameras {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewCamera creates a new camera from the registry
+func NewCamera(backend string, config CameraConfig) (Camera, error) {
+	factory, ok := Cameras[backend]
+	if !ok {
+		return nil, fmt.Errorf("unknown camera backend %s, available backends: %v", backend, CameraNames())
+	}
+	return factory(config), nil
+}
+
+// ParseCameras parses comma separated source=device pairs into camera
+// configurations based on a template
+func ParseCameras(cameras string, template CameraConfig) ([]CameraConfig, error) {
+	var configs []CameraConfig
+	for _, pair := range strings.Split(cameras, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid camera %s", pair)
+		}
+		config := template
+		config.Source, config.Device = parts[0], parts[1]
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+// Watchdog detects cameras that stopped streaming frames
+type Watchdog struct {
+	Timeout time.Duration
+	Sources []string
+	Cameras []Camera
+	// Stalled are the sources that stopped streaming
+	Stalled map[string]bool
+}
+
+// NewWatchdog creates a new watchdog for the cameras, a timeout of 0 disables
+// the watchdog
+func NewWatchdog(timeout time.Duration, sources []string, cameras []Camera) *Watchdog {
+	return &Watchdog{
+		Timeout: timeout,
+		Sources: sources,
+		Cameras: cameras,
+		Stalled: make(map[string]bool),
+	}
+}
+
+// Check returns the sources that stopped streaming since the last check, a
+// source is reported again only after it has recovered
+func (w *Watchdog) Check() []string {
+	if w.Timeout <= 0 {
+		return nil
+	}
+	var stalled []string
+	for i, camera := range w.Cameras {
+		source := w.Sources[i]
+		if camera.Health().Since < w.Timeout {
+			delete(w.Stalled, source)
+		} else if !w.Stalled[source] {
+			w.Stalled[source] = true
+			stalled = append(stalled, source)
+		}
+	}
+	return stalled
+}
+
+// Rig fuses the latest observations of the sensor pipelines of multiple
+// cameras into one observation
+type Rig struct {
+	sync.Mutex
+	Sources []string
+	Latest  map[string][]float64
+	Frames  map[string]Frame
+	// Disconnected are the sources that are disconnected
+	Disconnected map[string]bool
+	// Widths are the widths of the last observations of the sources
+	Widths map[string]int
+	// Width is the width of the first observation of any source, used for
+	// the sources that have not reported yet
+	Width int
+}
+
+// NewRig creates a new rig for the camera sources
+func NewRig(sources []string) *Rig {
+	return &Rig{
+		Sources:      sources,
+		Latest:       make(map[string][]float64),
+		Frames:       make(map[string]Frame),
+		Disconnected: make(map[string]bool),
+		Widths:       make(map[string]int),
+	}
+}
+
+// SetStatus sets the connection status of a source, the latest observation of
+// a disconnected source is cleared
+func (r *Rig) SetStatus(status CameraStatus) {
+	r.Lock()
+	defer r.Unlock()
+	if status.Connected {
+		delete(r.Disconnected, status.Source)
+		return
+	}
+	r.Disconnected[status.Source] = true
+	delete(r.Latest, status.Source)
+	delete(r.Frames, status.Source)
+}
+
+// Connected returns true if none of the sources are disconnected
+func (r *Rig) Connected() bool {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.Disconnected) == 0
+}
+
+// Set sets the latest frame of a source and its observation, a frame with an
+// observation of another width than the last of the source is dropped and the
+// source is padded to the new width until its next frame
+func (r *Rig) Set(frame *Frame, observation []float64) {
+	r.Lock()
+	defer r.Unlock()
+	if r.Width == 0 {
+		r.Width = len(observation)
+	}
+	if width, ok := r.Widths[frame.Source]; !ok {
+		r.Widths[frame.Source] = len(observation)
+	} else if width != len(observation) {
+		fmt.Printf("the observation of %s has %d values, it had %d\n", frame.Source, len(observation), width)
+		r.Widths[frame.Source] = len(observation)
+		delete(r.Latest, frame.Source)
+		delete(r.Frames, frame.Source)
+		return
+	}
+	r.Latest[frame.Source] = observation
+	r.Frames[frame.Source] = *frame
+}
+
+// Frame returns the latest frames of the sources in order
+func (r *Rig) Frame() []Frame {
+	r.Lock()
+	defer r.Unlock()
+	frames := make([]Frame, 0, len(r.Sources))
+	for _, source := range r.Sources {
+		if frame, ok := r.Frames[source]; ok {
+			frames = append(frames, frame)
+		}
+	}
+	return frames
+}
+
+// Observation returns the concatenated latest observations of the sources in
+// order, a source without an observation contributes zeros of its width so
+// the width of the observation does not change
+func (r *Rig) Observation() []float64 {
+	r.Lock()
+	defer r.Unlock()
+	var observation []float64
+	for _, source := range r.Sources {
+		latest, ok := r.Latest[source]
+		if !ok {
+			width, found := r.Widths[source]
+			if !found {
+				width = r.Width
+			}
+			latest = make([]float64, width)
+		}
+		observation = append(observation, latest...)
+	}
+	return observation
+}
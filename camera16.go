@@ -0,0 +1,120 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/blackjack/webcam"
+)
+
+// Camera16 is a v4l camera with 16 bit little endian or 8 bit gray frames
+// such as a thermal or depth camera
+type Camera16 struct {
+	sync.Mutex
+	Stream bool
+	// Formats are the supported pixel formats in order of preference, a
+	// format whose fourcc ends in GREY is 8 bit
+	Formats []webcam.PixelFormat
+	Latest  *image.Gray16
+	// Updated is when the latest frame was read
+	Updated time.Time
+}
+
+// NewCamera16 creates a new 16 bit camera
+func NewCamera16(formats ...webcam.PixelFormat) *Camera16 {
+	return &Camera16{
+		Stream:  true,
+		Formats: formats,
+	}
+}
+
+// Start starts streaming
+func (c *Camera16) Start(device string) {
+	runtime.LockOSThread()
+	camera, err := webcam.Open(device)
+	if err != nil {
+		panic(err)
+	}
+	defer camera.Close()
+
+	supported := camera.GetSupportedFormats()
+	format, found := webcam.PixelFormat(0), false
+	for _, f := range c.Formats {
+		if _, ok := supported[f]; ok {
+			format, found = f, true
+			break
+		}
+	}
+	if !found {
+		panic(fmt.Errorf("%s does not support any of the formats %v", device, c.Formats))
+	}
+	sizes := FrameSizes(camera.GetSupportedFrameSizes(format))
+	if len(sizes) == 0 {
+		panic(fmt.Errorf("%s has no frame sizes", device))
+	}
+	size := sizes[0]
+	_, w, h, err := camera.SetImageFormat(format, size.MaxWidth, size.MaxHeight)
+	if err != nil {
+		panic(err)
+	}
+	err = camera.StartStreaming()
+	if err != nil {
+		panic(err)
+	}
+	defer camera.StopStreaming()
+
+	wide := format != ThermalGrey
+	for c.Stream {
+		err := camera.WaitForFrame(5)
+		switch err.(type) {
+		case nil:
+		case *webcam.Timeout:
+			fmt.Println(device, err)
+			continue
+		default:
+			panic(err)
+		}
+		frame, err := camera.ReadFrame()
+		if err != nil {
+			fmt.Println(device, err)
+			continue
+		}
+		img := image.NewGray16(image.Rect(0, 0, int(w), int(h)))
+		for i := range img.Pix[:len(img.Pix)/2] {
+			var value uint16
+			if wide {
+				if 2*i+1 >= len(frame) {
+					break
+				}
+				value = binary.LittleEndian.Uint16(frame[2*i:])
+			} else {
+				if i >= len(frame) {
+					break
+				}
+				value = uint16(frame[i]) << 8
+			}
+			binary.BigEndian.PutUint16(img.Pix[2*i:], value)
+		}
+		c.Lock()
+		c.Latest, c.Updated = img, time.Now()
+		c.Unlock()
+	}
+}
+
+// Get returns the latest frame, nil without a fresh frame
+func (c *Camera16) Get() *image.Gray16 {
+	c.Lock()
+	defer c.Unlock()
+	if time.Since(c.Updated) >= SensorStale {
+		return nil
+	}
+	return c.Latest
+}
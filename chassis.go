@@ -0,0 +1,329 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pointlander/as/rover"
+	"go.bug.st/serial"
+)
+
+// Chassis is the drive base of a robot, failures are reported by the driver
+// so the robot keeps running
+type Chassis interface {
+	// Drive sets the speeds of the wheels in meters per second
+	Drive(left, right float64)
+	// Lights sets the brightness of the lights, 0 is off and 255 is the
+	// brightest
+	Lights(pwm int)
+	// Gimbal points the pan tilt gimbal in degrees
+	Gimbal(x, y float64)
+	// Pin sets the pwm of a general purpose io pin, 0 is off and 255 is
+	// fully on
+	Pin(pin string, value int)
+	// Stop stops the motors at once, bypassing any queued commands
+	Stop()
+	// Telemetry is the telemetry reported by the chassis
+	Telemetry() *Telemetry
+	// Close closes the chassis
+	Close() error
+}
+
+// Arm is a robotic arm fitted to a chassis, the angles are in radians
+type Arm interface {
+	// Joints moves the joints of the arm
+	Joints(pose ArmPose)
+	// Grip moves the gripper
+	Grip(angle float64)
+}
+
+// ArmPose are the angles of the joints of an arm in radians
+type ArmPose struct {
+	Base, Shoulder, Elbow, Hand float64
+}
+
+const (
+	// GripOpen is the angle of the open gripper
+	GripOpen = 1.08
+	// GripClosed is the angle of the closed gripper
+	GripClosed = 3.14
+	// ArmAcc is the acceleration of the arm joints
+	ArmAcc = 10
+)
+
+// ArmHome is the folded pose of the arm
+var ArmHome = ArmPose{Base: 0, Shoulder: 0, Elbow: 1.57, Hand: GripClosed}
+
+// ChassisConfig is the configuration of a chassis
+type ChassisConfig struct {
+	// Device is the serial device, empty scans for it if the driver can
+	Device string
+	Baud   int
+	// Interval is the minimum time between commands
+	Interval time.Duration
+	// AckTimeout is how long a command waits for an acknowledgment
+	AckTimeout time.Duration
+	// LightPins are the io pins driven by the lights
+	LightPins []string
+}
+
+// Chassises is the registry of chassis drivers
+var Chassises = map[string]func(config ChassisConfig) (Chassis, error){
+	"waveshare":  NewWaveshare,
+	"sabertooth": NewSabertooth,
+}
+
+// NewChassis creates a chassis from the registry
+func NewChassis(name string, config ChassisConfig) (Chassis, error) {
+	driver, ok := Chassises[name]
+	if !ok {
+		names := make([]string, 0, len(Chassises))
+		for name := range Chassises {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown chassis %s, available chassis: %v", name, names)
+	}
+	return driver(config)
+}
+
+// Waveshare is the waveshare rover controller speaking json over serial
+type Waveshare struct {
+	sync.Mutex
+	Link     *Link
+	Commands *rover.Writer
+	State    *Telemetry
+	Setup    []rover.Command
+	// Reported are the stats of the commands last reported
+	Reported rover.Stats
+	// Done is closed once the commands are written
+	Done chan struct{}
+	// Light is the state of the light pins, the light command always sets
+	// all of them
+	Light rover.LightCmd
+	// LightPins are the light pins driven by the lights, the others are left to
+	// the named outputs
+	LightPins []string
+}
+
+// NewWaveshare opens the waveshare rover controller
+func NewWaveshare(config ChassisConfig) (Chassis, error) {
+	var light rover.LightCmd
+	for _, pin := range config.LightPins {
+		if !light.Set(pin, 0) {
+			return nil, fmt.Errorf("the lights can't drive pin %s, the pins are %v", pin, rover.LightPins)
+		}
+	}
+	telemetry := NewTelemetry()
+	link, device, err := NewLink(config.Device, config.Baud, telemetry)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("rover controller on", device)
+	w := &Waveshare{
+		Link:     link,
+		Commands: rover.NewWriter(link, 16, config.Interval, config.AckTimeout),
+		State:    telemetry,
+		// setup turns on the continuous telemetry feedback
+		Setup:     []rover.Command{rover.ModuleCmd{Main: 2, Module: 0}, rover.FeedbackCmd{On: 1}},
+		Done:      make(chan struct{}),
+		LightPins: config.LightPins,
+	}
+	if config.AckTimeout > 0 {
+		// the echo is turned on first so the setup is acknowledged
+		w.Setup = append([]rover.Command{rover.EchoCmd{On: 1}}, w.Setup...)
+	}
+	// a controller that reset while the link was down is configured again
+	link.Connect = func(port serial.Port) {
+		for _, command := range w.Setup {
+			data, err := rover.Marshal(command)
+			if err != nil {
+				panic(err)
+			}
+			_, err = port.Write(data)
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+	go func() {
+		defer close(w.Done)
+		err := w.Commands.Run()
+		if err != nil {
+			panic(err)
+		}
+	}()
+	telemetry.Lines = w.Commands.Ack
+	go func() {
+		err := telemetry.Read(link)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}()
+	for _, command := range w.Setup {
+		w.Commands.Send(command)
+	}
+	return w, nil
+}
+
+// Drive queues a drive command and reports the commands that failed
+func (w *Waveshare) Drive(left, right float64) {
+	w.Commands.Send(rover.DriveCmd{Left: left, Right: right})
+	if stats := w.Commands.Counts(); stats.Dropped != w.Reported.Dropped ||
+		stats.Unacknowledged != w.Reported.Unacknowledged {
+		fmt.Println("rover commands:", stats)
+		w.Reported = stats
+	}
+}
+
+// Lights queues a light command that sets the pins of the lights
+func (w *Waveshare) Lights(pwm int) {
+	w.Lock()
+	defer w.Unlock()
+	for _, pin := range w.LightPins {
+		w.Light.Set(pin, pwm)
+	}
+	w.Commands.Send(w.Light)
+}
+
+// GimbalSpeed and GimbalAcc are the speed and acceleration of the gimbal, 0
+// is the fastest
+const (
+	GimbalSpeed = 0
+	GimbalAcc   = 0
+)
+
+// Gimbal queues a gimbal command
+func (w *Waveshare) Gimbal(x, y float64) {
+	w.Commands.Send(rover.GimbalCmd{X: x, Y: y, Speed: GimbalSpeed, Acc: GimbalAcc})
+}
+
+// Pin queues a light command that sets a light pin
+func (w *Waveshare) Pin(pin string, value int) {
+	w.Lock()
+	defer w.Unlock()
+	if !w.Light.Set(pin, value) {
+		fmt.Println("unknown pin", pin)
+		return
+	}
+	w.Commands.Send(w.Light)
+}
+
+// Joints queues an arm command
+func (w *Waveshare) Joints(pose ArmPose) {
+	w.Commands.Send(rover.ArmCmd{
+		Base:     pose.Base,
+		Shoulder: pose.Shoulder,
+		Elbow:    pose.Elbow,
+		Hand:     pose.Hand,
+		Acc:      ArmAcc,
+	})
+}
+
+// Grip queues a gripper command
+func (w *Waveshare) Grip(angle float64) {
+	w.Commands.Send(rover.GripperCmd{Rad: angle, Acc: ArmAcc})
+}
+
+// Stop stops the motors ahead of the queued commands and drops the drive
+// command that is not written yet
+func (w *Waveshare) Stop() {
+	err := w.Commands.Stop(rover.DriveCmd{})
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// Telemetry is the telemetry reported by the rover controller
+func (w *Waveshare) Telemetry() *Telemetry {
+	return w.State
+}
+
+// Close writes the queued commands and closes the serial link
+func (w *Waveshare) Close() error {
+	w.Commands.Close()
+	select {
+	case <-w.Done:
+	case <-time.After(time.Second):
+	}
+	return w.Link.Close()
+}
+
+// Sabertooth is a sabertooth motor driver in simplified serial mode, motor 1
+// is the left wheels and motor 2 is the right wheels
+type Sabertooth struct {
+	sync.Mutex
+	Port  serial.Port
+	State *Telemetry
+}
+
+// NewSabertooth opens a sabertooth motor driver, the device is required
+// because the driver does not respond to a probe
+func NewSabertooth(config ChassisConfig) (Chassis, error) {
+	if config.Device == "" {
+		return nil, fmt.Errorf("the sabertooth requires a serial device")
+	}
+	port, err := serial.Open(config.Device, &serial.Mode{BaudRate: config.Baud})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("sabertooth on", config.Device)
+	telemetry := NewTelemetry()
+	telemetry.SetLink(true, nil)
+	return &Sabertooth{
+		Port:  port,
+		State: telemetry,
+	}, nil
+}
+
+// write writes the command bytes to the driver
+func (s *Sabertooth) write(data ...byte) {
+	s.Lock()
+	defer s.Unlock()
+	_, err := s.Port.Write(data)
+	if err != nil {
+		fmt.Println("sabertooth:", err)
+	}
+}
+
+// Drive sets the speeds of the motors, 1 is full reverse, 64 is stop and 127
+// is full forward for motor 1 and 128, 192 and 255 for motor 2
+func (s *Sabertooth) Drive(left, right float64) {
+	scale := func(speed float64, stop byte) byte {
+		value := math.Round(63 * speed / RoverSpeedMax)
+		value = math.Max(-63, math.Min(value, 63))
+		return byte(int(stop) + int(value))
+	}
+	s.write(scale(left, 64), scale(right, 192))
+}
+
+// Lights does nothing, the sabertooth has no lights
+func (s *Sabertooth) Lights(pwm int) {}
+
+// Gimbal does nothing, the sabertooth has no gimbal
+func (s *Sabertooth) Gimbal(x, y float64) {}
+
+// Pin does nothing, the sabertooth has no io pins
+func (s *Sabertooth) Pin(pin string, value int) {}
+
+// Stop stops both motors
+func (s *Sabertooth) Stop() {
+	s.write(0)
+}
+
+// Telemetry is empty, the sabertooth reports nothing
+func (s *Sabertooth) Telemetry() *Telemetry {
+	return s.State
+}
+
+// Close closes the serial port
+func (s *Sabertooth) Close() error {
+	return s.Port.Close()
+}
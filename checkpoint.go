@@ -0,0 +1,124 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Checkpointer periodically saves a mind to timestamped files and keeps only
+// the most recent ones
+type Checkpointer struct {
+	Directory string
+	Name      string
+	Every     int
+	Keep      int
+	Steps     int
+}
+
+// NewCheckpointer creates a new checkpointer for the named mind
+func NewCheckpointer(directory, name string, every, keep int) *Checkpointer {
+	return &Checkpointer{
+		Directory: directory,
+		Name:      name,
+		Every:     every,
+		Keep:      keep,
+	}
+}
+
+// Step counts a step of the mind and saves a checkpoint every Every steps
+func (c *Checkpointer) Step(mind Mind) error {
+	if c == nil || c.Every <= 0 {
+		return nil
+	}
+	c.Steps++
+	if c.Steps%c.Every != 0 {
+		return nil
+	}
+	return c.Save(mind)
+}
+
+// Save saves a checkpoint of the mind and rotates the old checkpoints
+func (c *Checkpointer) Save(mind Mind) error {
+	err := os.MkdirAll(c.Directory, 0700)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.gob", c.Name, time.Now().UTC().Format("20060102T150405.000000000"))
+	path := filepath.Join(c.Directory, name)
+	temp := path + ".tmp"
+	f, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	err = mind.Save(f)
+	if err != nil {
+		f.Close()
+		os.Remove(temp)
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+	err = os.Rename(temp, path)
+	if err != nil {
+		return err
+	}
+	return c.rotate()
+}
+
+// Checkpoints returns the checkpoints of the mind from oldest to newest
+func (c *Checkpointer) Checkpoints() ([]string, error) {
+	entries, err := os.ReadDir(c.Directory)
+	if err != nil {
+		return nil, err
+	}
+	var checkpoints []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, c.Name+"-") || !strings.HasSuffix(name, ".gob") {
+			continue
+		}
+		checkpoints = append(checkpoints, filepath.Join(c.Directory, name))
+	}
+	sort.Strings(checkpoints)
+	return checkpoints, nil
+}
+
+// rotate removes all but the newest Keep checkpoints
+func (c *Checkpointer) rotate() error {
+	if c.Keep <= 0 {
+		return nil
+	}
+	checkpoints, err := c.Checkpoints()
+	if err != nil {
+		return err
+	}
+	for len(checkpoints) > c.Keep {
+		err := os.Remove(checkpoints[0])
+		if err != nil {
+			return err
+		}
+		checkpoints = checkpoints[1:]
+	}
+	return nil
+}
+
+// LoadMind loads the state of a mind from a checkpoint file
+func LoadMind(mind Mind, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return mind.Load(f)
+}
@@ -0,0 +1,124 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// CliffFloor is the fraction of the bottom of the frame that sees the
+	// floor
+	CliffFloor = .25
+	// CliffDecay is the decay of the running mean of the floor brightness
+	CliffDecay = .95
+	// CliffHold is how long an edge seen by the camera is remembered
+	CliffHold = time.Second
+)
+
+// Cliff detects an edge in front of the robot from a downward facing distance
+// sensor in the telemetry or a sudden change of the floor brightness seen by
+// a camera
+type Cliff struct {
+	sync.Mutex
+	Telemetry *Telemetry
+	// Key is the telemetry key of the distance to the floor in centimeters,
+	// empty disables the sensor
+	Key string
+	// Max is the distance to the floor beyond which there is an edge
+	Max float64
+	// Source is the camera that sees the floor
+	Source string
+	// Threshold is the relative change of the floor brightness that is an
+	// edge, 0 disables the camera
+	Threshold float64
+	// Floor is the running mean of the floor brightness
+	Floor float64
+	// Seen is when the camera last saw an edge
+	Seen time.Time
+	// Changed is when the floor brightness started to differ, zero while it
+	// matches
+	Changed time.Time
+	// Reported is true while an edge is reported
+	Reported bool
+}
+
+// NewCliff creates a new cliff detector
+func NewCliff(telemetry *Telemetry, key string, max float64, source string, threshold float64) *Cliff {
+	return &Cliff{
+		Telemetry: telemetry,
+		Key:       key,
+		Max:       max,
+		Source:    source,
+		Threshold: threshold,
+	}
+}
+
+// Observe looks for a sudden change of the floor brightness in a frame
+func (c *Cliff) Observe(frame *Frame) {
+	if c.Threshold <= 0 || frame.Source != c.Source || frame.Gray == nil {
+		return
+	}
+	gray := frame.Gray
+	bounds := gray.Bounds()
+	top := bounds.Max.Y - int(math.Ceil(CliffFloor*float64(bounds.Dy())))
+	sum, count := 0.0, 0
+	for y := top; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			sum += float64(gray.GrayAt(x, y).Y)
+			count++
+		}
+	}
+	if count == 0 {
+		return
+	}
+	brightness := sum / float64(count)
+	c.Lock()
+	defer c.Unlock()
+	if c.Floor == 0 {
+		c.Floor = brightness
+		return
+	}
+	if math.Abs(brightness-c.Floor) > c.Threshold*math.Max(c.Floor, 1) {
+		now := time.Now()
+		if c.Changed.IsZero() {
+			c.Changed = now
+		}
+		// the edge is not learned as the floor, unless it lasts longer than
+		// an edge is held so a change of the lighting does not block the
+		// robot for good
+		if now.Sub(c.Changed) < CliffHold {
+			c.Seen = now
+			return
+		}
+		c.Floor, c.Changed = brightness, time.Time{}
+		return
+	}
+	c.Changed = time.Time{}
+	c.Floor = CliffDecay*c.Floor + (1-CliffDecay)*brightness
+}
+
+// Edge returns true if there is an edge in front of the robot
+func (c *Cliff) Edge() bool {
+	edge := false
+	if c.Key != "" {
+		// a sensor that stops reporting is taken for an edge
+		distance, ok := c.Telemetry.Fresh(c.Key, SensorStale)
+		edge = !ok || distance > c.Max
+	}
+	c.Lock()
+	defer c.Unlock()
+	edge = edge || (!c.Seen.IsZero() && time.Since(c.Seen) < CliffHold)
+	if edge != c.Reported {
+		c.Reported = edge
+		if edge {
+			fmt.Println("cliff: edge detected, forward motion blocked")
+		}
+	}
+	return edge
+}
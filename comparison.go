@@ -0,0 +1,100 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"math/rand"
+	"os"
+	"strconv"
+)
+
+// Comparison runs a shadow mind on the same inputs as the mind in control and
+// logs the actions and predicted entropies of both for offline comparison
+type Comparison struct {
+	Shadow Mind
+	Rng    *rand.Rand
+	File   *os.File
+	Writer *csv.Writer
+	Steps  int
+}
+
+// NewComparison creates a new comparison with a shadow mind that logs to a csv
+// file
+func NewComparison(name string, seed int64, path string) (*Comparison, error) {
+	rng := rand.New(rand.NewSource(seed))
+	shadow, err := NewMind(name, rng, int(ActionCount))
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer := csv.NewWriter(f)
+	err = writer.Write([]string{"step", "entropy", "control", "shadow",
+		"control_prediction", "shadow_prediction", "control_entropy", "shadow_entropy"})
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Comparison{
+		Shadow: shadow,
+		Rng:    rng,
+		File:   f,
+		Writer: writer,
+	}, nil
+}
+
+// prediction returns the estimate of a mind for an action
+func prediction(introspection Introspection, action int) float64 {
+	if action < len(introspection.Estimates) {
+		return introspection.Estimates[action]
+	}
+	return 0
+}
+
+// Step steps the shadow mind with the inputs of the control mind and logs the
+// results
+func (c *Comparison) Step(control Mind, action int, observation []float64, rewards []float64, mask []bool) error {
+	if c == nil {
+		return nil
+	}
+	shadow := c.Shadow.Step(c.Rng, observation, rewards, mask)
+	a, b := control.Introspect(), c.Shadow.Introspect()
+	format := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	err := c.Writer.Write([]string{
+		strconv.Itoa(c.Steps),
+		format(Scalar(observation)),
+		TypeAction(action).String(),
+		TypeAction(shadow).String(),
+		format(prediction(a, action)),
+		format(prediction(b, shadow)),
+		format(a.Entropy),
+		format(b.Entropy),
+	})
+	c.Steps++
+	if err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return c.Writer.Error()
+}
+
+// Close closes the comparison log
+func (c *Comparison) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.Writer.Flush()
+	err := c.Writer.Error()
+	if err != nil {
+		c.File.Close()
+		return err
+	}
+	return c.File.Close()
+}
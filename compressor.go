@@ -0,0 +1,185 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pointlander/compress"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// Compressor is a compressor used to estimate kolmogorov complexity
+type Compressor interface {
+	// Compress compresses the input into the output
+	Compress(input []byte, output io.Writer)
+}
+
+// Mark1Compressor is the mark1 compressor
+type Mark1Compressor struct{}
+
+// Compress compresses with mark1
+func (Mark1Compressor) Compress(input []byte, output io.Writer) {
+	compress.Mark1Compress1(input, output)
+}
+
+// GzipCompressor is the gzip compressor
+type GzipCompressor struct{}
+
+// Compress compresses with gzip
+func (GzipCompressor) Compress(input []byte, output io.Writer) {
+	writer, err := gzip.NewWriterLevel(output, gzip.BestCompression)
+	if err != nil {
+		panic(err)
+	}
+	_, err = writer.Write(input)
+	if err != nil {
+		panic(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// LZMACompressor is the lzma compressor
+type LZMACompressor struct{}
+
+// Compress compresses with lzma
+func (LZMACompressor) Compress(input []byte, output io.Writer) {
+	writer, err := lzma.NewWriter(output)
+	if err != nil {
+		panic(err)
+	}
+	_, err = writer.Write(input)
+	if err != nil {
+		panic(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// FlateCompressor is the flate compressor
+type FlateCompressor struct{}
+
+// Compress compresses with flate
+func (FlateCompressor) Compress(input []byte, output io.Writer) {
+	writer, err := flate.NewWriter(output, flate.BestCompression)
+	if err != nil {
+		panic(err)
+	}
+	_, err = writer.Write(input)
+	if err != nil {
+		panic(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// zstdEncoder is shared by the zstd compressors because creating an encoder is
+// expensive and EncodeAll is safe for concurrent use
+var zstdEncoder = func() *zstd.Encoder {
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression),
+		zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		panic(err)
+	}
+	return encoder
+}()
+
+// ZstdCompressor is the zstd compressor
+type ZstdCompressor struct{}
+
+// Compress compresses with zstd
+func (ZstdCompressor) Compress(input []byte, output io.Writer) {
+	_, err := output.Write(zstdEncoder.EncodeAll(input, nil))
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Bzip2Compressor is the bzip2 compressor
+type Bzip2Compressor struct{}
+
+// Compress compresses with bzip2
+func (Bzip2Compressor) Compress(input []byte, output io.Writer) {
+	writer, err := bzip2.NewWriter(output, &bzip2.WriterConfig{Level: bzip2.BestCompression})
+	if err != nil {
+		panic(err)
+	}
+	_, err = writer.Write(input)
+	if err != nil {
+		panic(err)
+	}
+	err = writer.Close()
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Compressors is the registry of compressors
+var Compressors = map[string]Compressor{
+	"mark1": Mark1Compressor{},
+	"gzip":  GzipCompressor{},
+	"lzma":  LZMACompressor{},
+	"flate": FlateCompressor{},
+	"zstd":  ZstdCompressor{},
+	"bzip2": Bzip2Compressor{},
+}
+
+// NewCompressor looks up a compressor in the registry
+func NewCompressor(name string) (Compressor, error) {
+	compressor, ok := Compressors[name]
+	if !ok {
+		names := make([]string, 0, len(Compressors))
+		for name := range Compressors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown compressor %s, available compressors: %v", name, names)
+	}
+	return compressor, nil
+}
+
+// Complexity estimates the kolmogorov complexity of data
+type Complexity interface {
+	// Complexity returns the estimated complexity of data in bytes
+	Complexity(data []byte) int
+}
+
+// CompressorComplexity estimates complexity as the compressed size, the
+// output buffer is reused between estimates
+type CompressorComplexity struct {
+	Compressor Compressor
+	Output     bytes.Buffer
+}
+
+// Complexity returns the compressed size of data
+func (c *CompressorComplexity) Complexity(data []byte) int {
+	c.Output.Reset()
+	c.Compressor.Compress(data, &c.Output)
+	return c.Output.Len()
+}
+
+// NewComplexity creates a complexity estimator from a compressor in the
+// registry
+func NewComplexity(name string) (Complexity, error) {
+	compressor, err := NewCompressor(name)
+	if err != nil {
+		return nil, err
+	}
+	return &CompressorComplexity{Compressor: compressor}, nil
+}
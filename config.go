@@ -0,0 +1,58 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// Config is the json configuration file
+type Config struct {
+	Fusion FusionConfig
+	// Pipeline are the preprocessing stages applied to the frames of the
+	// cameras before they are sensed
+	Pipeline []StageConfig
+	// Speed are the gains of the closed loop speed control of the wheels
+	Speed SpeedConfig
+	// Actions replace the default effects of the actions by name
+	Actions map[string]Effect
+	// Outputs are the named outputs on the io pins of the controller
+	Outputs map[string]OutputConfig
+	// Fence is the boundary the robot is confined to
+	Fence FenceConfig
+	// Drive is the drive mode of the sticks, tank, arcade or car, empty is
+	// tank
+	Drive string
+	// Axes are the maps of the game controller axes by name, leftx, lefty,
+	// rightx, righty, lefttrigger and righttrigger, an axis replaces the
+	// deadzone and expo flags
+	Axes map[string]AxisMap
+}
+
+// DefaultConfig is the configuration used without a configuration file
+var DefaultConfig = Config{
+	Fusion: FusionConfig{
+		Mode: FusionSum,
+		Sensors: []FusionInput{
+			{Name: "ksensor", Weight: 1},
+		},
+	},
+}
+
+// LoadConfig loads a configuration file, an empty path is the default
+// configuration
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig
+	if path == "" {
+		return config, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(data, &config)
+	return config, err
+}
@@ -0,0 +1,164 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/blackjack/webcam"
+)
+
+const (
+	// ControlAutoWhiteBalance is the v4l2 automatic white balance control
+	ControlAutoWhiteBalance webcam.ControlID = 0x0098090c
+	// ControlAutoGain is the v4l2 automatic gain control
+	ControlAutoGain webcam.ControlID = 0x00980912
+	// ControlGain is the v4l2 gain control
+	ControlGain webcam.ControlID = 0x00980913
+	// ControlWhiteBalance is the v4l2 white balance temperature control
+	ControlWhiteBalance webcam.ControlID = 0x0098091a
+	// ControlExposureAuto is the v4l2 exposure mode control
+	ControlExposureAuto webcam.ControlID = 0x009a0901
+	// ControlExposure is the v4l2 absolute exposure control in 100us units
+	ControlExposure webcam.ControlID = 0x009a0902
+	// ExposureManual is the manual exposure mode
+	ExposureManual = 1
+)
+
+const (
+	// AutoExposureTarget is the target mean brightness of the frames
+	AutoExposureTarget = 128
+	// AutoExposureDeadband is the brightness error that is tolerated
+	AutoExposureDeadband = 16
+	// AutoExposureInterval is the number of frames between adjustments so the
+	// camera settles
+	AutoExposureInterval = 8
+)
+
+// CameraControls are the exposure, gain and white balance of a camera, a
+// negative value leaves the control automatic
+type CameraControls struct {
+	// Exposure is the exposure in 100us units
+	Exposure int32
+	Gain     int32
+	// WhiteBalance is the white balance temperature in kelvin
+	WhiteBalance int32
+	// Auto adjusts the exposure so the entropy sensors aren't dominated by
+	// under or over exposure
+	Auto bool
+}
+
+// Apply sets the controls of a camera, controls the camera doesn't support
+// are skipped
+func (c CameraControls) Apply(camera *webcam.Webcam) {
+	controls := camera.GetControls()
+	set := func(id webcam.ControlID, value int32) {
+		if _, ok := controls[id]; !ok {
+			return
+		}
+		err := camera.SetControl(id, value)
+		if err != nil {
+			fmt.Println(controls[id].Name, err)
+		}
+	}
+	if c.Exposure >= 0 || c.Auto {
+		set(ControlExposureAuto, ExposureManual)
+	}
+	if c.Exposure >= 0 {
+		set(ControlExposure, c.Exposure)
+	}
+	if c.Gain >= 0 {
+		set(ControlAutoGain, 0)
+		set(ControlGain, c.Gain)
+	}
+	if c.WhiteBalance >= 0 {
+		set(ControlAutoWhiteBalance, 0)
+		set(ControlWhiteBalance, c.WhiteBalance)
+	}
+}
+
+// AutoExposure adjusts the exposure so the mean brightness of the frames is
+// the target brightness
+type AutoExposure struct {
+	Target   float64
+	Min, Max int32
+	Value    int32
+	Frames   int
+}
+
+// NewAutoExposure creates an auto exposure for the exposure control of a
+// camera, false is returned if the camera has no exposure control
+func NewAutoExposure(camera *webcam.Webcam) (*AutoExposure, bool) {
+	control, ok := camera.GetControls()[ControlExposure]
+	if !ok {
+		return nil, false
+	}
+	value, err := camera.GetControl(ControlExposure)
+	if err != nil {
+		return nil, false
+	}
+	return &AutoExposure{
+		Target: AutoExposureTarget,
+		Min:    control.Min,
+		Max:    control.Max,
+		Value:  value,
+	}, true
+}
+
+// Brightness is the mean brightness of an image
+func Brightness(gray *image.Gray) float64 {
+	bounds, sum := gray.Bounds(), 0.0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			sum += float64(gray.GrayAt(x, y).Y)
+		}
+	}
+	if count := bounds.Dx() * bounds.Dy(); count > 0 {
+		return sum / float64(count)
+	}
+	return 0
+}
+
+// Adjust returns the exposure for a frame and true if it changed, the
+// exposure is scaled by at most a factor of two per adjustment
+func (a *AutoExposure) Adjust(gray *image.Gray) (int32, bool) {
+	a.Frames++
+	if a.Frames < AutoExposureInterval {
+		return a.Value, false
+	}
+	a.Frames = 0
+	brightness := Brightness(gray)
+	if brightness > a.Target-AutoExposureDeadband && brightness < a.Target+AutoExposureDeadband {
+		return a.Value, false
+	}
+	ratio := 2.0
+	if brightness > 0 {
+		ratio = a.Target / brightness
+	}
+	if ratio > 2 {
+		ratio = 2
+	} else if ratio < .5 {
+		ratio = .5
+	}
+	value := int32(float64(a.Value) * ratio)
+	if value == a.Value {
+		if ratio > 1 {
+			value++
+		} else {
+			value--
+		}
+	}
+	if value < a.Min {
+		value = a.Min
+	} else if value > a.Max {
+		value = a.Max
+	}
+	if value == a.Value {
+		return a.Value, false
+	}
+	a.Value = value
+	return value, true
+}
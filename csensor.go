@@ -0,0 +1,88 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"image"
+	"image/color"
+)
+
+// CSensor is a color sensor that senses the Y, Cb and Cr planes of a frame
+// separately with kolmogorov sensors
+type CSensor struct {
+	// Bands is the number of frequency bands per plane, 0 senses a single
+	// fused value
+	Bands  int
+	Planes [3]KSensor
+}
+
+// NewCSensor creates a new color sensor
+func NewCSensor(bands int, compressor string) *CSensor {
+	c := CSensor{
+		Bands: bands,
+	}
+	for i := range c.Planes {
+		c.Planes[i].Bands = bands
+		complexity, err := NewComplexity(compressor)
+		if err != nil {
+			panic(err)
+		}
+		c.Planes[i].Complexity = complexity
+	}
+	return &c
+}
+
+// planes splits the thumbnail of a frame into Y, Cb and Cr planes, a frame
+// without a thumbnail is sensed as gray with neutral chroma
+func (c *CSensor) planes(frame *Frame) [3]*image.Gray {
+	var planes [3]*image.Gray
+	if frame.Thumb == nil {
+		bounds := frame.Gray.Bounds()
+		planes[0] = frame.Gray
+		for i := 1; i < 3; i++ {
+			planes[i] = image.NewGray(bounds)
+			for j := range planes[i].Pix {
+				planes[i].Pix[j] = 128
+			}
+		}
+		return planes
+	}
+	bounds := frame.Thumb.Bounds()
+	for i := range planes {
+		planes[i] = image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	}
+	for x := 0; x < bounds.Dx(); x++ {
+		for y := 0; y < bounds.Dy(); y++ {
+			pixel := color.YCbCrModel.Convert(frame.Thumb.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.YCbCr)
+			planes[0].SetGray(x, y, color.Gray{Y: pixel.Y})
+			planes[1].SetGray(x, y, color.Gray{Y: pixel.Cb})
+			planes[2].SetGray(x, y, color.Gray{Y: pixel.Cr})
+		}
+	}
+	return planes
+}
+
+// Image returns the thumbnail, the color planes are split from it
+func (c *CSensor) Image() string {
+	return InputThumb
+}
+
+// Sense senses the color planes of a frame, the band values of the planes are
+// concatenated and the single values are fused by averaging
+func (c *CSensor) Sense(frame *Frame) []float64 {
+	planes := c.planes(frame)
+	if c.Bands > 0 {
+		values := make([]float64, 0, 3*c.Bands)
+		for i, plane := range planes {
+			values = append(values, c.Planes[i].SenseBands(plane)...)
+		}
+		return values
+	}
+	sum := 0.0
+	for i, plane := range planes {
+		sum += c.Planes[i].SenseGray(plane)
+	}
+	return []float64{sum / 3}
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/gob"
+	"io"
+	"math"
+	"math/rand"
+)
+
+// CuriosityLearningRate is the learning rate of the curiosity predictive model
+const CuriosityLearningRate = .1
+
+// CuriosityMind is a mind that selects the actions with the largest
+// prediction error of the next entropy
+type CuriosityMind struct {
+	Seed    int64
+	Actions int
+	History History
+	// Predictions are the predicted next entropy for each context and action
+	Predictions map[Context][]float64
+	// Errors are the running prediction errors for each context and action
+	Errors      map[Context][]float64
+	State       Context
+	Normalized  []float64
+	Action      int
+	Initialized bool
+	Visits      []uint64
+	Schedule    Schedule
+}
+
+// NewCuriosityMind creates a new curiosity mind
+func NewCuriosityMind(rng *rand.Rand, actions int) CuriosityMind {
+	c := CuriosityMind{
+		Seed:    rng.Int63(),
+		Actions: actions,
+	}
+	c.Reset()
+	return c
+}
+
+// Step steps the curiosity mind
+func (c *CuriosityMind) Step(rng *rand.Rand, observation []float64, rewards []float64, mask []bool) int {
+	entropy := Scalar(observation)
+	if c.Initialized {
+		predictions, errors := c.Predictions[c.State], c.Errors[c.State]
+		delta := entropy - predictions[c.Action]
+		errors[c.Action] = math.Max((errors[c.Action]+math.Abs(delta)/256+Total(rewards))/2, 0)
+		predictions[c.Action] += CuriosityLearningRate * delta
+	}
+	c.History.Add(Symbol(observation))
+	c.State = c.History.Context()
+	errors, ok := c.Errors[c.State]
+	if !ok {
+		errors = make([]float64, c.Actions)
+		for i := range errors {
+			errors[i] = 1
+		}
+		c.Errors[c.State] = errors
+		predictions := make([]float64, c.Actions)
+		for i := range predictions {
+			predictions[i] = entropy
+		}
+		c.Predictions[c.State] = predictions
+	}
+	c.Normalized = ApplyMask(softmax(errors, c.Schedule.Temperature(.1, entropy)), mask)
+	sum, action, selected := 0.0, 0, rng.Float64()
+	for i, value := range c.Normalized {
+		sum += value
+		if sum > selected {
+			action = i
+			break
+		}
+	}
+	c.History.Set(byte(action))
+	c.Action = action
+	c.Initialized = true
+	c.Visits[action]++
+	return action
+}
+
+// Reset resets the curiosity mind
+func (c *CuriosityMind) Reset() {
+	rng := rand.New(rand.NewSource(c.Seed))
+	c.History = NewHistory(rng, Size)
+	c.Predictions = make(map[Context][]float64)
+	c.Errors = make(map[Context][]float64)
+	c.State = Context{}
+	c.Normalized = nil
+	c.Action = 0
+	c.Initialized = false
+	c.Visits = make([]uint64, c.Actions)
+	c.Schedule.Reset()
+}
+
+// Introspect returns a snapshot of the curiosity mind, the estimates are the
+// predicted next entropy for each action in the current context
+func (c *CuriosityMind) Introspect() Introspection {
+	return NewIntrospection(c.Action, c.Normalized, c.Visits, c.Predictions[c.State])
+}
+
+// Save saves the curiosity mind
+func (c *CuriosityMind) Save(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(c)
+}
+
+// Load loads the curiosity mind
+func (c *CuriosityMind) Load(r io.Reader) error {
+	*c = CuriosityMind{}
+	err := gob.NewDecoder(r).Decode(c)
+	if c.Predictions == nil {
+		c.Predictions = make(map[Context][]float64)
+	}
+	if c.Errors == nil {
+		c.Errors = make(map[Context][]float64)
+	}
+	c.Visits = visits(c.Visits, c.Actions)
+	return err
+}
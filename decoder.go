@@ -0,0 +1,76 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"os/exec"
+)
+
+// StreamDecoder decodes a compressed camera stream in an ffmpeg process off
+// the go heap, h.264 is decoded by the v4l2 memory to memory hardware decoder
+// of the raspberry pi and motion jpeg by the simd jpeg decoder of ffmpeg
+type StreamDecoder struct {
+	Width, Height int
+	Cmd           *exec.Cmd
+	Input         io.WriteCloser
+	Output        *bufio.Reader
+}
+
+// NewStreamDecoder starts a decoder for a mjpeg or h264 stream
+func NewStreamDecoder(codec string, width, height int) (*StreamDecoder, error) {
+	decoder := codec
+	if codec == "h264" {
+		decoder = "h264_v4l2m2m"
+	}
+	cmd := exec.Command("ffmpeg", "-hide_banner", "-loglevel", "error",
+		"-fflags", "nobuffer", "-flags", "low_delay",
+		"-f", codec, "-c:v", decoder, "-i", "pipe:0",
+		"-f", "rawvideo", "-pix_fmt", "yuv420p", "pipe:1")
+	input, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	output, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	return &StreamDecoder{
+		Width:  width,
+		Height: height,
+		Cmd:    cmd,
+		Input:  input,
+		Output: bufio.NewReaderSize(output, width*height*3/2),
+	}, nil
+}
+
+// Write writes a compressed frame to the decoder
+func (s *StreamDecoder) Write(frame []byte) error {
+	_, err := s.Input.Write(frame)
+	return err
+}
+
+// Read reads a decoded frame
+func (s *StreamDecoder) Read() (*image.YCbCr, error) {
+	frame, err := ReadI420(s.Output, s.Width, s.Height)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = fmt.Errorf("%s exited", s.Cmd.Path)
+	}
+	return frame, err
+}
+
+// Close stops the decoder
+func (s *StreamDecoder) Close() error {
+	s.Input.Close()
+	s.Cmd.Process.Kill()
+	return s.Cmd.Wait()
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+
+	"github.com/blackjack/webcam"
+)
+
+const (
+	// DepthZ16 is the fourcc of 16 bit depth frames in millimeters
+	DepthZ16 = webcam.PixelFormat('Z' | '1'<<8 | '6'<<16 | ' '<<24)
+	// DepthMax is the maximum sensed depth in millimeters
+	DepthMax = 4000
+	// DepthBins is the number of depth histogram bins
+	DepthBins = 64
+)
+
+// DepthCamera is a realsense style depth camera that is a v4l device with 16
+// bit depth frames in millimeters, 0 is no depth
+type DepthCamera struct {
+	*Camera16
+}
+
+// NewDepthCamera creates a new depth camera
+func NewDepthCamera() *DepthCamera {
+	return &DepthCamera{
+		Camera16: NewCamera16(DepthZ16),
+	}
+}
+
+// Nearest returns the depth of the nearest obstacle in millimeters, ok is
+// false without a fresh frame, a frame without depth is the maximum depth
+func (d *DepthCamera) Nearest() (nearest float64, ok bool) {
+	img := d.Get()
+	if img == nil {
+		return DepthMax, false
+	}
+	nearest = math.Inf(1)
+	bounds := img.Bounds()
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			if value := float64(img.Gray16At(x, y).Y); value > 0 && value < nearest {
+				nearest = value
+			}
+		}
+	}
+	return math.Min(nearest, DepthMax), true
+}
+
+// Sense senses the latest depth frame and returns the entropy of the depth
+// histogram and the nearness of the nearest obstacle, both scaled to 0 to 255
+func (d *DepthCamera) Sense() []float64 {
+	img := d.Get()
+	if img == nil {
+		return []float64{0, 0}
+	}
+	histogram := make([]float64, DepthBins)
+	bounds := img.Bounds()
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			value := float64(img.Gray16At(x, y).Y)
+			if value == 0 {
+				continue
+			}
+			histogram[int(math.Min(value, DepthMax-1)*DepthBins/DepthMax)]++
+		}
+	}
+	nearest, _ := d.Nearest()
+	return []float64{
+		255 * Shannon(histogram) / math.Log2(DepthBins),
+		255 * (1 - nearest/DepthMax),
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "math"
+
+// DistanceSensor is an ultrasonic distance sensor reported in the rover
+// telemetry
+type DistanceSensor struct {
+	Telemetry *Telemetry
+	// Key is the telemetry key of the distance in centimeters
+	Key string
+	// Max is the maximum sensed distance in centimeters
+	Max float64
+}
+
+// NewDistanceSensor creates a new distance sensor
+func NewDistanceSensor(telemetry *Telemetry, key string, max float64) *DistanceSensor {
+	return &DistanceSensor{
+		Telemetry: telemetry,
+		Key:       key,
+		Max:       max,
+	}
+}
+
+// Distance returns the distance in centimeters, ok is false without a fresh
+// reading, a reading without an echo is the maximum distance
+func (d *DistanceSensor) Distance() (distance float64, ok bool) {
+	distance, ok = d.Telemetry.Fresh(d.Key, SensorStale)
+	if !ok {
+		return d.Max, false
+	}
+	if distance <= 0 {
+		return d.Max, true
+	}
+	return math.Min(distance, d.Max), true
+}
+
+// Sense returns the nearness of an obstacle as a sensor channel from 0 at the
+// maximum distance to 255 at contact
+func (d *DistanceSensor) Sense() float64 {
+	distance, _ := d.Distance()
+	return 255 * (1 - distance/d.Max)
+}
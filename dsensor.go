@@ -0,0 +1,101 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// DCTBlock is the block size of the dct sensor
+	DCTBlock = 8
+	// DCTBins is the number of quantized coefficient histogram bins
+	DCTBins = 32
+	// DCTQuantization is the quantization step of the dct coefficients
+	DCTQuantization = 16
+)
+
+// DCTBasis is the 8 point dct-ii basis
+var DCTBasis = func() (basis [DCTBlock][DCTBlock]float64) {
+	for u := 0; u < DCTBlock; u++ {
+		c := math.Sqrt(2.0 / DCTBlock)
+		if u == 0 {
+			c = math.Sqrt(1.0 / DCTBlock)
+		}
+		for x := 0; x < DCTBlock; x++ {
+			basis[u][x] = c * math.Cos(float64(2*x+1)*float64(u)*math.Pi/(2*DCTBlock))
+		}
+	}
+	return basis
+}()
+
+// DSensor is a dct sensor that senses the entropy of the quantized ac
+// coefficients of 8x8 blocks like jpeg
+type DSensor struct{}
+
+// Sense senses the gray image of a frame, the entropy is the mean of the
+// entropy of each block
+func (d *DSensor) Sense(frame *Frame) []float64 {
+	img := frame.Gray
+	bounds := img.Bounds()
+	sum, count := 0.0, 0
+	for bx := bounds.Min.X; bx < bounds.Max.X; bx += DCTBlock {
+		for by := bounds.Min.Y; by < bounds.Max.Y; by += DCTBlock {
+			sum += Shannon(d.Block(img, bx, by))
+			count++
+		}
+	}
+	if count == 0 {
+		return []float64{0}
+	}
+	return []float64{sum / float64(count)}
+}
+
+// Block computes the dct of the block at x, y and returns the histogram of
+// the quantized ac coefficients, pixels outside of the image repeat the edge
+func (d *DSensor) Block(img *image.Gray, x, y int) []float64 {
+	bounds := img.Bounds()
+	var block, rows [DCTBlock][DCTBlock]float64
+	for i := 0; i < DCTBlock; i++ {
+		for j := 0; j < DCTBlock; j++ {
+			px, py := x+i, y+j
+			if px >= bounds.Max.X {
+				px = bounds.Max.X - 1
+			}
+			if py >= bounds.Max.Y {
+				py = bounds.Max.Y - 1
+			}
+			block[i][j] = float64(img.GrayAt(px, py).Y) - 128
+		}
+	}
+	for i := 0; i < DCTBlock; i++ {
+		for v := 0; v < DCTBlock; v++ {
+			for j := 0; j < DCTBlock; j++ {
+				rows[i][v] += DCTBasis[v][j] * block[i][j]
+			}
+		}
+	}
+	histogram := make([]float64, DCTBins)
+	for u := 0; u < DCTBlock; u++ {
+		for v := 0; v < DCTBlock; v++ {
+			if u == 0 && v == 0 {
+				continue
+			}
+			coefficient := 0.0
+			for i := 0; i < DCTBlock; i++ {
+				coefficient += DCTBasis[u][i] * rows[i][v]
+			}
+			bin := int(math.Round(coefficient/DCTQuantization)) + DCTBins/2
+			if bin < 0 {
+				bin = 0
+			} else if bin >= DCTBins {
+				bin = DCTBins - 1
+			}
+			histogram[bin]++
+		}
+	}
+	return histogram
+}
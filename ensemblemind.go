@@ -0,0 +1,210 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+func init() {
+	// registered here because the ensemble creates its children from the registry
+	Minds["ensemble"] = func(rng *rand.Rand, actions int) Mind {
+		mind := NewEnsembleMind(rng, actions, strings.Split(*FlagEnsemble, ","))
+		return &mind
+	}
+	Children["ensemble"] = func() []string {
+		return strings.Split(*FlagEnsemble, ",")
+	}
+}
+
+// EnsembleMind is a mind that votes across multiple minds
+type EnsembleMind struct {
+	Actions int
+	Names   []string
+	Minds   []Mind
+	// Outcomes is the running average of the entropy change for each action
+	Outcomes []float64
+	// Errors is the running average of the entropy change prediction error of
+	// each mind
+	Errors      []float64
+	Weights     []float64
+	Predictions []float64
+	Normalized  []float64
+	Action      int
+	Entropy     float64
+	Initialized bool
+	Visits      []uint64
+}
+
+// NewEnsembleMind creates a new ensemble mind from the named minds
+func NewEnsembleMind(rng *rand.Rand, actions int, names []string) EnsembleMind {
+	e := EnsembleMind{
+		Actions: actions,
+		Names:   names,
+	}
+	for _, name := range names {
+		mind, err := NewMind(name, rng, actions)
+		if err != nil {
+			panic(err)
+		}
+		e.Minds = append(e.Minds, mind)
+	}
+	e.Reset()
+	return e
+}
+
+// distribution returns the action distribution of a mind
+func distribution(mind Mind, action, actions int) []float64 {
+	if normalized := mind.Introspect().Distribution; len(normalized) == actions {
+		return normalized
+	}
+	normalized := make([]float64, actions)
+	normalized[action] = 1
+	return normalized
+}
+
+// Step steps the ensemble mind
+func (e *EnsembleMind) Step(rng *rand.Rand, observation []float64, rewards []float64, mask []bool) int {
+	entropy := Scalar(observation)
+	if e.Initialized {
+		delta := entropy - e.Entropy
+		e.Outcomes[e.Action] = (e.Outcomes[e.Action] + delta) / 2
+		for i, prediction := range e.Predictions {
+			e.Errors[i] = (e.Errors[i] + math.Abs(delta-prediction)) / 2
+		}
+	}
+	e.Entropy = entropy
+
+	errors := make([]float64, len(e.Errors))
+	for i, value := range e.Errors {
+		errors[i] = -value
+	}
+	e.Weights = softmax(errors, 1)
+
+	e.Normalized = make([]float64, e.Actions)
+	for i, mind := range e.Minds {
+		action := mind.Step(rng, observation, rewards, mask)
+		normalized := distribution(mind, action, e.Actions)
+		prediction := 0.0
+		for a, value := range normalized {
+			e.Normalized[a] += e.Weights[i] * value
+			prediction += value * e.Outcomes[a]
+		}
+		e.Predictions[i] = prediction
+	}
+	e.Normalized = ApplyMask(e.Normalized, mask)
+
+	sum, action, selected := 0.0, 0, rng.Float64()
+	for i, value := range e.Normalized {
+		sum += value
+		if sum > selected {
+			action = i
+			break
+		}
+	}
+	e.Action = action
+	e.Initialized = true
+	e.Visits[action]++
+	return action
+}
+
+// Reset resets the ensemble mind
+func (e *EnsembleMind) Reset() {
+	for _, mind := range e.Minds {
+		mind.Reset()
+	}
+	e.Outcomes = make([]float64, e.Actions)
+	e.Errors = make([]float64, len(e.Minds))
+	e.Weights = make([]float64, len(e.Minds))
+	e.Predictions = make([]float64, len(e.Minds))
+	e.Normalized = nil
+	e.Action = 0
+	e.Entropy = 0
+	e.Initialized = false
+	e.Visits = make([]uint64, e.Actions)
+}
+
+// Introspect returns a snapshot of the ensemble mind, the estimates are the
+// average entropy change of each action and the details are the weights of
+// the minds
+func (e *EnsembleMind) Introspect() Introspection {
+	introspection := NewIntrospection(e.Action, e.Normalized, e.Visits, e.Outcomes)
+	for i, weight := range e.Weights {
+		introspection.Details[e.Names[i]] = weight
+	}
+	return introspection
+}
+
+// EnsembleState is the serialized state of the ensemble mind
+type EnsembleState struct {
+	Outcomes    []float64
+	Errors      []float64
+	Weights     []float64
+	Predictions []float64
+	Normalized  []float64
+	Action      int
+	Entropy     float64
+	Initialized bool
+	Visits      []uint64
+	Minds       [][]byte
+}
+
+// Save saves the ensemble mind
+func (e *EnsembleMind) Save(w io.Writer) error {
+	state := EnsembleState{
+		Outcomes:    e.Outcomes,
+		Errors:      e.Errors,
+		Weights:     e.Weights,
+		Predictions: e.Predictions,
+		Normalized:  e.Normalized,
+		Action:      e.Action,
+		Entropy:     e.Entropy,
+		Initialized: e.Initialized,
+		Visits:      e.Visits,
+	}
+	for _, mind := range e.Minds {
+		buffer := bytes.Buffer{}
+		err := mind.Save(&buffer)
+		if err != nil {
+			return err
+		}
+		state.Minds = append(state.Minds, buffer.Bytes())
+	}
+	return gob.NewEncoder(w).Encode(state)
+}
+
+// Load loads the ensemble mind
+func (e *EnsembleMind) Load(r io.Reader) error {
+	state := EnsembleState{}
+	err := gob.NewDecoder(r).Decode(&state)
+	if err != nil {
+		return err
+	}
+	e.Reset()
+	for i, data := range state.Minds {
+		if i >= len(e.Minds) {
+			break
+		}
+		err := e.Minds[i].Load(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+	}
+	copy(e.Outcomes, state.Outcomes)
+	copy(e.Errors, state.Errors)
+	copy(e.Weights, state.Weights)
+	copy(e.Predictions, state.Predictions)
+	e.Normalized = state.Normalized
+	e.Action = state.Action
+	e.Entropy = state.Entropy
+	e.Initialized = state.Initialized
+	copy(e.Visits, state.Visits)
+	return nil
+}
@@ -8,53 +8,86 @@ import (
 	"image"
 	"math"
 	"math/cmplx"
-
-	"github.com/mjibson/go-dsp/dsputils"
-	"github.com/mjibson/go-dsp/fft"
 )
 
 // ESensor is an entropy sensor
 type ESensor struct {
-	ImgBuffer *dsputils.Matrix
+	// Input is the image of the frame that is sensed: gray, thumb, or full
+	Input string
+	// Bands is the number of frequency bands, 0 senses a single value
+	Bands int
+	// Preprocess crops and downsamples the image before the fft
+	Preprocess Preprocess
+	Spectrum   *Spectrum
+}
+
+// Image returns the image of the frame that is sensed
+func (e *ESensor) Image() string {
+	return e.Input
 }
 
-// Sense senses an image
-func (e *ESensor) Sense(img *image.Gray) float64 {
+// Sense senses the input image of a frame
+func (e *ESensor) Sense(frame *Frame) []float64 {
+	img := e.Preprocess.Prepare(frame.Input(e.Input))
+	if e.Bands > 0 {
+		return e.SenseBands(img)
+	}
+	return []float64{e.SenseGray(img)}
+}
+
+// transform adds an image to the spectrum and computes the fft
+func (e *ESensor) transform(img *image.Gray) []complex128 {
 	dx := img.Bounds().Dx()
 	dy := img.Bounds().Dy()
-	if e.ImgBuffer == nil {
-		e.ImgBuffer = dsputils.MakeMatrix(make([]complex128, FFTDepth*dx*dy), []int{FFTDepth, dx, dy})
-	}
-	for d := FFTDepth - 1; d > 0; d-- {
-		for x := 0; x < dx; x++ {
-			for y := 0; y < dy; y++ {
-				e.ImgBuffer.SetValue(e.ImgBuffer.Value([]int{d - 1, x, y}), []int{d, x, y})
-			}
-		}
+	if e.Spectrum == nil || e.Spectrum.Width != dx || e.Spectrum.Height != dy {
+		e.Spectrum = NewSpectrum(FFTDepth, dx, dy)
 	}
+	pixels := e.Spectrum.Pixels
 	for x := 0; x < dx; x++ {
 		for y := 0; y < dy; y++ {
-			g := img.GrayAt(x, y)
-			e.ImgBuffer.SetValue(complex(float64(g.Y)/256, 0), []int{0, x, y})
+			pixels[x*dy+y] = float64(img.GrayAt(x, y).Y) / 256
 		}
 	}
-	freq := fft.FFTN(e.ImgBuffer)
+	return e.Spectrum.Transform()
+}
+
+// SenseGray senses an image
+func (e *ESensor) SenseGray(img *image.Gray) float64 {
+	freq := e.transform(img)
 	sum := 0.0
-	for i := 0; i < FFTDepth; i++ {
-		for x := 0; x < dx; x++ {
-			for y := 0; y < dy; y++ {
-				sum += cmplx.Abs(freq.Value([]int{i, x, y}))
-			}
-		}
+	for _, value := range freq {
+		sum += cmplx.Abs(value)
+	}
+	if sum == 0 {
+		return 0
 	}
 	entropy := 0.0
-	for i := 0; i < FFTDepth; i++ {
-		for x := 0; x < dx; x++ {
-			for y := 0; y < dy; y++ {
-				value := cmplx.Abs(freq.Value([]int{i, x, y})) / sum
-				entropy += value * math.Log2(value)
-			}
+	for _, value := range freq {
+		value := cmplx.Abs(value) / sum
+		if value > 0 {
+			entropy -= value * math.Log2(value)
+		}
+	}
+	return entropy
+}
+
+// SenseBands senses an image and returns the entropy of each frequency band
+func (e *ESensor) SenseBands(img *image.Gray) []float64 {
+	freq := e.transform(img)
+	bands := e.Spectrum.Bands(e.Bands)
+	sums := make([]float64, e.Bands)
+	for i, band := range bands {
+		sums[band] += cmplx.Abs(freq[i])
+	}
+	entropies := make([]float64, e.Bands)
+	for i, band := range bands {
+		if sums[band] == 0 {
+			continue
+		}
+		value := cmplx.Abs(freq[i]) / sums[band]
+		if value > 0 {
+			entropies[band] -= value * math.Log2(value)
 		}
 	}
-	return -entropy
+	return entropies
 }
@@ -0,0 +1,100 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EStop is a latching emergency stop, while it is engaged the manual and the
+// autonomous drive commands are ignored
+type EStop struct {
+	sync.Mutex
+	Engaged bool
+	Reason  string
+	Since   time.Time
+	// Stop stops the motors without going through the control loop
+	Stop func()
+	// Notify is called with the reason each time the stop is engaged
+	Notify func(reason string)
+	// Secret is the shared secret of the kill switch, it is needed to clear
+	// the stop over http, without it the stop is only cleared at the robot
+	Secret []byte
+}
+
+// NewEStop creates a new emergency stop
+func NewEStop(stop func(), secret string) *EStop {
+	return &EStop{
+		Stop:   stop,
+		Secret: []byte(secret),
+	}
+}
+
+// Engage stops the motors and latches the emergency stop
+func (e *EStop) Engage(reason string) {
+	e.Lock()
+	engaged := !e.Engaged
+	if engaged {
+		e.Engaged, e.Reason, e.Since = true, reason, time.Now()
+		fmt.Println("emergency stop engaged by", reason)
+	}
+	e.Unlock()
+	e.Stop()
+	if engaged && e.Notify != nil {
+		e.Notify(reason)
+	}
+}
+
+// Clear releases the emergency stop
+func (e *EStop) Clear() {
+	e.Lock()
+	defer e.Unlock()
+	if e.Engaged {
+		fmt.Println("emergency stop cleared")
+	}
+	e.Engaged, e.Reason, e.Since = false, "", time.Time{}
+}
+
+// Get returns true if the emergency stop is engaged
+func (e *EStop) Get() bool {
+	e.Lock()
+	defer e.Unlock()
+	return e.Engaged
+}
+
+// ServeHTTP serves the emergency stop, a post engages it, a delete with the
+// secret as the bearer token clears it and the state is returned as json
+func (e *EStop) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		e.Engage("http " + r.RemoteAddr)
+	case http.MethodDelete:
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if len(e.Secret) == 0 || !hmac.Equal([]byte(token), e.Secret) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		e.Clear()
+	case http.MethodGet:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	e.Lock()
+	state := struct {
+		Engaged bool
+		Reason  string
+		Since   time.Time
+	}{e.Engaged, e.Reason, e.Since}
+	e.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
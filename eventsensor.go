@@ -0,0 +1,73 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+func init() {
+	// registered here because the event sensor creates its sensor from the
+	// registry
+	Sensors["event"] = func() Sensor {
+		sensor, err := NewEventSensor(*FlagEventSensor, *FlagEventThreshold)
+		if err != nil {
+			panic(err)
+		}
+		return sensor
+	}
+}
+
+// EventSensor emulates an event camera, a frame is only sensed when it
+// differs from the last sensed frame by more than a threshold and frames
+// without an event sense as zero, so an idle scene costs almost nothing
+type EventSensor struct {
+	Sensor Sensor
+	// Threshold is the mean absolute gray difference of an event
+	Threshold float64
+	Last      *image.Gray
+	// Channels is the number of values of the last event
+	Channels int
+}
+
+// NewEventSensor creates a new event sensor that senses events with the
+// named sensor
+func NewEventSensor(name string, threshold float64) (*EventSensor, error) {
+	if name == "event" {
+		return nil, fmt.Errorf("event sensor can not contain itself")
+	}
+	sensor, err := NewSensor(name, NoiseConfig{})
+	if err != nil {
+		return nil, err
+	}
+	return &EventSensor{
+		Sensor:    sensor,
+		Threshold: threshold,
+		Channels:  1,
+	}, nil
+}
+
+// Sense senses a frame if it is an event
+func (e *EventSensor) Sense(frame *Frame) []float64 {
+	img := frame.Gray
+	if e.Last != nil && e.Last.Bounds() == img.Bounds() {
+		bounds, difference := img.Bounds(), 0.0
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				difference += math.Abs(float64(img.GrayAt(x, y).Y) - float64(e.Last.GrayAt(x, y).Y))
+			}
+		}
+		if difference/float64(bounds.Dx()*bounds.Dy()) <= e.Threshold {
+			return make([]float64, e.Channels)
+		}
+	}
+	e.Last = image.NewGray(img.Bounds())
+	copy(e.Last.Pix, img.Pix)
+	values := e.Sensor.Sense(frame)
+	e.Channels = len(values)
+	return values
+}
@@ -0,0 +1,194 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FenceHorizon is how far ahead in seconds a motion is predicted to decide if
+// it leaves the fence
+const FenceHorizon = 1.0
+
+// FenceConfig is a circular or polygonal boundary the robot is confined to
+type FenceConfig struct {
+	// GPS is true if the points are latitude and longitude in degrees,
+	// otherwise they are odometry positions in meters
+	GPS bool
+	// Center and Radius in meters are a circular fence
+	Center [2]float64
+	Radius float64
+	// Polygon are the vertices of a polygonal fence, it is used instead of
+	// the circle if it has at least 3 vertices
+	Polygon [][2]float64
+	// Margin is the distance in meters from the boundary within which motion
+	// toward the boundary is suppressed
+	Margin float64
+}
+
+// ParseGeofence parses a circular gps fence from lat,lon,radius in meters
+func ParseGeofence(fence string) (FenceConfig, error) {
+	config := FenceConfig{GPS: true}
+	parts := strings.Split(fence, ",")
+	if len(parts) != 3 {
+		return config, fmt.Errorf("invalid geofence %s", fence)
+	}
+	var values [3]float64
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return config, err
+		}
+		values[i] = value
+	}
+	config.Center, config.Radius = [2]float64{values[0], values[1]}, values[2]
+	return config, nil
+}
+
+// Fence confines the robot to a boundary using the odometry or the gps, the
+// positions are in meters east and north of the origin of the fence
+type Fence struct {
+	sync.Mutex
+	Config     FenceConfig
+	Kinematics Kinematics
+	Odometry   *Odometry
+	GPS        *GPS
+	// Origin is the latitude and longitude of the origin of a gps fence
+	Origin [2]float64
+	// Center and Polygon are the fence in meters
+	Center  [2]float64
+	Polygon [][2]float64
+	// Near is true while the robot is within the margin
+	Near bool
+}
+
+// NewFence creates a new fence, nil if the config has no boundary
+func NewFence(config FenceConfig, kinematics Kinematics, odometry *Odometry, gps *GPS) *Fence {
+	if config.Radius <= 0 && len(config.Polygon) < 3 {
+		return nil
+	}
+	if config.GPS && gps == nil {
+		panic("a gps fence needs the gps")
+	}
+	f := &Fence{
+		Config:     config,
+		Kinematics: kinematics,
+		Odometry:   odometry,
+		GPS:        gps,
+		Origin:     config.Center,
+	}
+	if len(config.Polygon) >= 3 && config.GPS {
+		f.Origin = config.Polygon[0]
+	}
+	f.Center = f.local(config.Center)
+	for _, point := range config.Polygon {
+		f.Polygon = append(f.Polygon, f.local(point))
+	}
+	return f
+}
+
+// local converts a point of the config into meters
+func (f *Fence) local(point [2]float64) [2]float64 {
+	if !f.Config.GPS {
+		return point
+	}
+	radians := math.Pi / 180
+	return [2]float64{
+		(point[1] - f.Origin[1]) * radians * EarthRadius * math.Cos(f.Origin[0]*radians),
+		(point[0] - f.Origin[0]) * radians * EarthRadius,
+	}
+}
+
+// Locate returns the pose of the robot in the frame of the fence, ok is false
+// without a gps fix
+func (f *Fence) Locate() (pose Pose, ok bool) {
+	if !f.Config.GPS {
+		return f.Odometry.Get(), true
+	}
+	lat, lon, ok := f.GPS.Position()
+	if !ok {
+		return pose, false
+	}
+	position := f.local([2]float64{lat, lon})
+	heading, _ := f.GPS.Telemetry.Get(GPSKeys[3])
+	// the gps heading is clockwise from north
+	return Pose{
+		X:     position[0],
+		Y:     position[1],
+		Theta: math.Pi/2 - heading*math.Pi/180,
+	}, true
+}
+
+// Clearance returns the distance in meters from a position to the boundary,
+// negative outside of the fence
+func (f *Fence) Clearance(x, y float64) float64 {
+	if len(f.Polygon) < 3 {
+		return f.Config.Radius - math.Hypot(x-f.Center[0], y-f.Center[1])
+	}
+	inside, nearest := false, math.Inf(1)
+	for i := range f.Polygon {
+		a, b := f.Polygon[i], f.Polygon[(i+1)%len(f.Polygon)]
+		if (a[1] > y) != (b[1] > y) && x < a[0]+(y-a[1])*(b[0]-a[0])/(b[1]-a[1]) {
+			inside = !inside
+		}
+		dx, dy := b[0]-a[0], b[1]-a[1]
+		t := 0.0
+		if length := dx*dx + dy*dy; length > 0 {
+			t = math.Max(0, math.Min(1, ((x-a[0])*dx+(y-a[1])*dy)/length))
+		}
+		nearest = math.Min(nearest, math.Hypot(x-a[0]-t*dx, y-a[1]-t*dy))
+	}
+	if !inside {
+		return -nearest
+	}
+	return nearest
+}
+
+// Outward returns true if the speeds of the wheels in meters per second move
+// the robot at the pose toward the boundary while it is within the margin
+func (f *Fence) Outward(pose Pose, left, right float64) bool {
+	if left == 0 && right == 0 {
+		return false
+	}
+	clearance := f.Clearance(pose.X, pose.Y)
+	linear, angular := f.Kinematics.Velocity(left, right)
+	theta := pose.Theta + angular*FenceHorizon/2
+	x := pose.X + linear*FenceHorizon*math.Cos(theta)
+	y := pose.Y + linear*FenceHorizon*math.Sin(theta)
+	next := f.Clearance(x, y)
+	return next < f.Config.Margin && next < clearance
+}
+
+// Check records the clearance of the robot in the telemetry and reports when
+// the robot enters or leaves the margin, ok is false without a position
+func (f *Fence) Check(telemetry *Telemetry) (pose Pose, ok bool) {
+	pose, ok = f.Locate()
+	if !ok {
+		return pose, false
+	}
+	clearance := f.Clearance(pose.X, pose.Y)
+	telemetry.Set("fence", clearance)
+	f.Lock()
+	defer f.Unlock()
+	near := clearance < f.Config.Margin
+	if near != f.Near {
+		f.Near = near
+		if near {
+			fmt.Printf("fence: %.2f meters from the boundary, outward motion suppressed\n", clearance)
+		} else {
+			fmt.Println("fence: clear of the boundary")
+		}
+	}
+	value := 0.0
+	if near {
+		value = 1
+	}
+	telemetry.Set("fence_near", value)
+	return pose, true
+}
@@ -0,0 +1,263 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FlightFramePeriod is the minimum time between the frames of a camera kept
+// by the flight recorder, so the window fits in memory
+const FlightFramePeriod = 500 * time.Millisecond
+
+// FlightHoldoff is the minimum time between the incidents of the same reason,
+// so a burst of collisions is saved once
+const FlightHoldoff = 10 * time.Second
+
+// Incident is the metadata saved with an incident
+type Incident struct {
+	// Reason is what caused the incident
+	Reason string
+	Time   time.Time
+	// Detail describes the incident
+	Detail string
+}
+
+// FlightStep is a decision of the mind
+type FlightStep struct {
+	Time time.Time
+	// Observation are the entropy values the mind observed
+	Observation []float64
+	Action      string
+}
+
+// FlightCommand is a command sent to the chassis
+type FlightCommand struct {
+	Time    time.Time
+	Command string
+}
+
+// FlightTelemetry is a sample of the telemetry values
+type FlightTelemetry struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// FlightRecorder keeps the frames, steps, commands and telemetry of the last
+// window and saves them as an incident for post-mortem analysis
+type FlightRecorder struct {
+	sync.Mutex
+	// Window is how far back the recorder keeps, 0 keeps nothing
+	Window time.Duration
+	// Directory is where the incidents are saved
+	Directory string
+	Frames    []Frame
+	Steps     []FlightStep
+	Commands  []FlightCommand
+	Telemetry []FlightTelemetry
+	// Kept is when the last frame of each camera was kept
+	Kept map[string]time.Time
+	// Dumped is when the last incident of each reason was dumped
+	Dumped map[string]time.Time
+	// Count is the number of incidents
+	Count int
+	// Stop stops the motors before a crash is saved
+	Stop func()
+}
+
+// NewFlightRecorder creates a new flight recorder
+func NewFlightRecorder(window time.Duration, directory string) *FlightRecorder {
+	return &FlightRecorder{
+		Window:    window,
+		Directory: directory,
+		Kept:      make(map[string]time.Time),
+		Dumped:    make(map[string]time.Time),
+	}
+}
+
+// expired returns the number of leading entries older than the window
+func (f *FlightRecorder) expired(count int, at func(i int) time.Time) int {
+	i, oldest := 0, time.Now().Add(-f.Window)
+	for i < count && at(i).Before(oldest) {
+		i++
+	}
+	return i
+}
+
+// Frame keeps a frame of a camera
+func (f *FlightRecorder) Frame(frame *Frame) {
+	if f.Window <= 0 {
+		return
+	}
+	f.Lock()
+	defer f.Unlock()
+	if time.Since(f.Kept[frame.Source]) < FlightFramePeriod {
+		return
+	}
+	f.Kept[frame.Source] = time.Now()
+	f.Frames = append(f.Frames, *frame)
+	f.Frames = f.Frames[f.expired(len(f.Frames), func(i int) time.Time { return f.Frames[i].Time }):]
+}
+
+// Step keeps a decision of the mind
+func (f *FlightRecorder) Step(observation []float64, action string) {
+	if f.Window <= 0 {
+		return
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.Steps = append(f.Steps, FlightStep{
+		Time:        time.Now(),
+		Observation: append([]float64{}, observation...),
+		Action:      action,
+	})
+	f.Steps = f.Steps[f.expired(len(f.Steps), func(i int) time.Time { return f.Steps[i].Time }):]
+}
+
+// Command keeps a command sent to the chassis
+func (f *FlightRecorder) Command(format string, a ...interface{}) {
+	if f.Window <= 0 {
+		return
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.Commands = append(f.Commands, FlightCommand{
+		Time:    time.Now(),
+		Command: fmt.Sprintf(format, a...),
+	})
+	f.Commands = f.Commands[f.expired(len(f.Commands), func(i int) time.Time { return f.Commands[i].Time }):]
+}
+
+// Sample keeps a sample of the telemetry values
+func (f *FlightRecorder) Sample(telemetry *Telemetry) {
+	if f.Window <= 0 {
+		return
+	}
+	values := telemetry.Copy()
+	f.Lock()
+	defer f.Unlock()
+	f.Telemetry = append(f.Telemetry, FlightTelemetry{
+		Time:   time.Now(),
+		Values: values,
+	})
+	f.Telemetry = f.Telemetry[f.expired(len(f.Telemetry), func(i int) time.Time { return f.Telemetry[i].Time }):]
+}
+
+// Dump saves the incident and the recorded window in the background, unless
+// an incident of the same reason was dumped within the holdoff or the recorder
+// is disabled
+func (f *FlightRecorder) Dump(reason, detail string) {
+	if f.Window <= 0 {
+		return
+	}
+	f.Lock()
+	if time.Since(f.Dumped[reason]) < FlightHoldoff {
+		f.Unlock()
+		return
+	}
+	f.Dumped[reason] = time.Now()
+	f.Unlock()
+	go func() {
+		err := f.Save(reason, detail)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}()
+}
+
+// Save saves the incident and the recorded window in a directory named by the
+// time and reason of the incident
+func (f *FlightRecorder) Save(reason, detail string) error {
+	fmt.Println("incident:", reason, detail)
+	f.Lock()
+	f.Count++
+	incident := Incident{
+		Reason: reason,
+		Time:   time.Now(),
+		Detail: detail,
+	}
+	frames := append([]Frame{}, f.Frames...)
+	records := map[string]interface{}{
+		"incident.json":  incident,
+		"steps.json":     append([]FlightStep{}, f.Steps...),
+		"commands.json":  append([]FlightCommand{}, f.Commands...),
+		"telemetry.json": append([]FlightTelemetry{}, f.Telemetry...),
+	}
+	f.Unlock()
+	directory := filepath.Join(f.Directory, fmt.Sprintf("%s-%s",
+		incident.Time.Format("20060102-150405"), reason))
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		return err
+	}
+	for name, record := range records {
+		data, err := json.MarshalIndent(record, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(filepath.Join(directory, name), data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return NewSnapshots(directory).Take(frames, reason)
+}
+
+// Crash saves a crash incident if the goroutine is panicking and panics again,
+// it is deferred at the top of the goroutines
+func (f *FlightRecorder) Crash() {
+	if r := recover(); r != nil {
+		// saving the incident takes a while, so the motors are stopped first
+		if f.Stop != nil {
+			f.Stop()
+		}
+		err := f.Save("crash", fmt.Sprint(r))
+		if err != nil {
+			fmt.Println(err)
+		}
+		panic(r)
+	}
+}
+
+// FlightChassis records the commands sent to a chassis
+type FlightChassis struct {
+	Chassis
+	Recorder *FlightRecorder
+}
+
+// Drive records and sends a drive command
+func (f *FlightChassis) Drive(left, right float64) {
+	f.Recorder.Command("drive %.3f %.3f", left, right)
+	f.Chassis.Drive(left, right)
+}
+
+// Lights records and sends a light command
+func (f *FlightChassis) Lights(pwm int) {
+	f.Recorder.Command("lights %d", pwm)
+	f.Chassis.Lights(pwm)
+}
+
+// Gimbal records and sends a gimbal command
+func (f *FlightChassis) Gimbal(x, y float64) {
+	f.Recorder.Command("gimbal %.1f %.1f", x, y)
+	f.Chassis.Gimbal(x, y)
+}
+
+// Pin records and sends a pin command
+func (f *FlightChassis) Pin(pin string, value int) {
+	f.Recorder.Command("pin %s %d", pin, value)
+	f.Chassis.Pin(pin, value)
+}
+
+// Stop records and stops the motors
+func (f *FlightChassis) Stop() {
+	f.Recorder.Command("stop")
+	f.Chassis.Stop()
+}
@@ -0,0 +1,79 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"image"
+	"math"
+)
+
+const (
+	// FlowBlock is the block size of the block matching optical flow
+	FlowBlock = 4
+	// FlowRadius is the search radius of the block matching optical flow
+	FlowRadius = 2
+	// FlowBins is the number of motion magnitude histogram bins
+	FlowBins = 8
+)
+
+// FSensor is an optical flow sensor that senses the entropy of the motion
+// magnitudes between consecutive frames
+type FSensor struct {
+	Last *image.Gray
+}
+
+// Sense senses the motion between the gray image of a frame and the last
+// frame
+func (f *FSensor) Sense(frame *Frame) []float64 {
+	img := frame.Gray
+	last := f.Last
+	f.Last = image.NewGray(img.Bounds())
+	copy(f.Last.Pix, img.Pix)
+	if last == nil || last.Bounds() != img.Bounds() {
+		return []float64{0}
+	}
+	return []float64{Shannon(f.Flow(last, img))}
+}
+
+// Flow computes the block matching optical flow from a to b and returns the
+// histogram of the motion magnitudes
+func (f *FSensor) Flow(a, b *image.Gray) []float64 {
+	bounds := a.Bounds()
+	histogram := make([]float64, FlowBins)
+	max := math.Sqrt(2) * FlowRadius
+	for bx := bounds.Min.X; bx+FlowBlock <= bounds.Max.X; bx += FlowBlock {
+		for by := bounds.Min.Y; by+FlowBlock <= bounds.Max.Y; by += FlowBlock {
+			best, dx, dy := math.MaxInt, 0, 0
+			for sx := -FlowRadius; sx <= FlowRadius; sx++ {
+				for sy := -FlowRadius; sy <= FlowRadius; sy++ {
+					if bx+sx < bounds.Min.X || by+sy < bounds.Min.Y ||
+						bx+sx+FlowBlock > bounds.Max.X || by+sy+FlowBlock > bounds.Max.Y {
+						continue
+					}
+					sad := 0
+					for x := 0; x < FlowBlock; x++ {
+						for y := 0; y < FlowBlock; y++ {
+							d := int(a.GrayAt(bx+x, by+y).Y) - int(b.GrayAt(bx+sx+x, by+sy+y).Y)
+							if d < 0 {
+								d = -d
+							}
+							sad += d
+						}
+					}
+					if sad < best || (sad == best && sx*sx+sy*sy < dx*dx+dy*dy) {
+						best, dx, dy = sad, sx, sy
+					}
+				}
+			}
+			magnitude := math.Sqrt(float64(dx*dx + dy*dy))
+			bin := int(magnitude / max * FlowBins)
+			if bin >= FlowBins {
+				bin = FlowBins - 1
+			}
+			histogram[bin]++
+		}
+	}
+	return histogram
+}
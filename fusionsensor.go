@@ -0,0 +1,122 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+func init() {
+	// registered here because the fusion sensor creates its sensors from the
+	// registry
+	Sensors["fusion"] = func() Sensor {
+		config, err := LoadConfig(*FlagConfig)
+		if err != nil {
+			panic(err)
+		}
+		sensor, err := NewFusionSensor(config.Fusion)
+		if err != nil {
+			panic(err)
+		}
+		return sensor
+	}
+}
+
+const (
+	// FusionSum sums the weighted mean value of each sensor
+	FusionSum = "sum"
+	// FusionMax takes the maximum weighted mean value of the sensors
+	FusionMax = "max"
+	// FusionConcat concatenates the weighted values of the sensors
+	FusionConcat = "concat"
+)
+
+// FusionInput is a sensor of the fusion sensor, its weight and the noise
+// injected into its frames
+type FusionInput struct {
+	Name   string
+	Weight float64
+	Noise  NoiseConfig
+}
+
+// FusionConfig is the configuration of the fusion sensor
+type FusionConfig struct {
+	// Mode is sum, max, or concat
+	Mode    string
+	Sensors []FusionInput
+}
+
+// FusionSensor runs multiple sensors concurrently and combines their values
+type FusionSensor struct {
+	Mode    string
+	Weights []float64
+	Sensors []Sensor
+}
+
+// NewFusionSensor creates a new fusion sensor
+func NewFusionSensor(config FusionConfig) (*FusionSensor, error) {
+	switch config.Mode {
+	case FusionSum, FusionMax, FusionConcat:
+	default:
+		return nil, fmt.Errorf("unknown fusion mode %s", config.Mode)
+	}
+	if len(config.Sensors) == 0 {
+		return nil, fmt.Errorf("fusion sensor has no sensors")
+	}
+	f := FusionSensor{
+		Mode: config.Mode,
+	}
+	for _, input := range config.Sensors {
+		if input.Name == "fusion" {
+			return nil, fmt.Errorf("fusion sensor can not contain itself")
+		}
+		sensor, err := NewSensor(input.Name, input.Noise)
+		if err != nil {
+			return nil, err
+		}
+		f.Sensors = append(f.Sensors, sensor)
+		f.Weights = append(f.Weights, input.Weight)
+	}
+	return &f, nil
+}
+
+// Sense senses a frame with each sensor concurrently and combines the values
+func (f *FusionSensor) Sense(frame *Frame) []float64 {
+	outputs := make([][]float64, len(f.Sensors))
+	var wait sync.WaitGroup
+	for i, sensor := range f.Sensors {
+		wait.Add(1)
+		go func(i int, sensor Sensor) {
+			defer wait.Done()
+			outputs[i] = sensor.Sense(frame)
+		}(i, sensor)
+	}
+	wait.Wait()
+
+	switch f.Mode {
+	case FusionMax:
+		max := math.Inf(-1)
+		for i, output := range outputs {
+			max = math.Max(max, f.Weights[i]*Scalar(output))
+		}
+		return []float64{max}
+	case FusionConcat:
+		var values []float64
+		for i, output := range outputs {
+			for _, value := range output {
+				values = append(values, f.Weights[i]*value)
+			}
+		}
+		return values
+	default:
+		sum := 0.0
+		for i, output := range outputs {
+			sum += f.Weights[i] * Scalar(output)
+		}
+		return []float64{sum}
+	}
+}
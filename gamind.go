@@ -0,0 +1,174 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/gob"
+	"io"
+	"math/rand"
+	"sort"
+)
+
+const (
+	// GAPopulation is the number of policies in the population
+	GAPopulation = 16
+	// GALevels is the number of quantized entropy levels of a policy
+	GALevels = 16
+	// GAMutation is the per gene mutation probability
+	GAMutation = .05
+)
+
+// GAMind is a genetic algorithm mind, each policy of the population maps
+// quantized entropy to actions and is evaluated over a window of steps
+type GAMind struct {
+	Seed       int64
+	Actions    int
+	Window     int
+	Population [][]int
+	Fitness    []float64
+	Current    int
+	Steps      int
+	Generation int
+	Action     int
+	Started    bool
+	Visits     []uint64
+}
+
+// NewGAMind creates a new genetic algorithm mind
+func NewGAMind(rng *rand.Rand, actions, window int) GAMind {
+	if window < 1 {
+		window = 1
+	}
+	g := GAMind{
+		Seed:    rng.Int63(),
+		Actions: actions,
+		Window:  window,
+	}
+	g.Reset()
+	return g
+}
+
+// evolve creates the next generation with tournament selection, uniform
+// crossover, and mutation, the best policy is kept
+func (g *GAMind) evolve(rng *rand.Rand) {
+	indexes := make([]int, len(g.Population))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return g.Fitness[indexes[i]] > g.Fitness[indexes[j]]
+	})
+	tournament := func() []int {
+		a, b := rng.Intn(len(g.Population)), rng.Intn(len(g.Population))
+		if g.Fitness[a] > g.Fitness[b] {
+			return g.Population[a]
+		}
+		return g.Population[b]
+	}
+	next := make([][]int, 0, len(g.Population))
+	best := make([]int, GALevels)
+	copy(best, g.Population[indexes[0]])
+	next = append(next, best)
+	for len(next) < len(g.Population) {
+		a, b := tournament(), tournament()
+		child := make([]int, GALevels)
+		for i := range child {
+			if rng.Intn(2) == 0 {
+				child[i] = a[i]
+			} else {
+				child[i] = b[i]
+			}
+			if rng.Float64() < GAMutation {
+				child[i] = rng.Intn(g.Actions)
+			}
+		}
+		next = append(next, child)
+	}
+	g.Population = next
+	g.Fitness = make([]float64, len(g.Population))
+	g.Generation++
+}
+
+// Step steps the genetic algorithm mind
+func (g *GAMind) Step(rng *rand.Rand, observation []float64, rewards []float64, mask []bool) int {
+	entropy := Scalar(observation)
+	if g.Started {
+		g.Fitness[g.Current] += (entropy/256 + Total(rewards)) / float64(g.Window)
+		g.Steps++
+		if g.Steps >= g.Window {
+			g.Steps = 0
+			g.Current++
+			if g.Current >= len(g.Population) {
+				g.Current = 0
+				g.evolve(rng)
+			}
+		}
+	}
+	action := g.Population[g.Current][Level(entropy, GALevels)]
+	if Masked(mask, action) {
+		var legal []int
+		for i := 0; i < g.Actions; i++ {
+			if !Masked(mask, i) {
+				legal = append(legal, i)
+			}
+		}
+		if len(legal) > 0 {
+			action = legal[rng.Intn(len(legal))]
+		}
+	}
+	g.Action = action
+	g.Started = true
+	g.Visits[action]++
+	return action
+}
+
+// Reset resets the genetic algorithm mind
+func (g *GAMind) Reset() {
+	rng := rand.New(rand.NewSource(g.Seed))
+	g.Population = make([][]int, GAPopulation)
+	for i := range g.Population {
+		policy := make([]int, GALevels)
+		for j := range policy {
+			policy[j] = rng.Intn(g.Actions)
+		}
+		g.Population[i] = policy
+	}
+	g.Fitness = make([]float64, GAPopulation)
+	g.Current = 0
+	g.Steps = 0
+	g.Generation = 0
+	g.Action = 0
+	g.Started = false
+	g.Visits = make([]uint64, g.Actions)
+}
+
+// Introspect returns a snapshot of the genetic algorithm mind, the
+// distribution is deterministic and the estimates are the fitness of the
+// current policy for each action it selects
+func (g *GAMind) Introspect() Introspection {
+	distribution := make([]float64, g.Actions)
+	distribution[g.Action] = 1
+	introspection := NewIntrospection(g.Action, distribution, g.Visits, nil)
+	introspection.Details["generation"] = float64(g.Generation)
+	introspection.Details["policy"] = float64(g.Current)
+	introspection.Details["fitness"] = g.Fitness[g.Current]
+	return introspection
+}
+
+// Save saves the genetic algorithm mind
+func (g *GAMind) Save(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(g)
+}
+
+// Load loads the genetic algorithm mind
+func (g *GAMind) Load(r io.Reader) error {
+	*g = GAMind{}
+	err := gob.NewDecoder(r).Decode(g)
+	if len(g.Fitness) != len(g.Population) {
+		g.Fitness = make([]float64, len(g.Population))
+	}
+	g.Visits = visits(g.Visits, g.Actions)
+	return err
+}
@@ -4,14 +4,17 @@ go 1.19
 
 require (
 	github.com/blackjack/webcam v0.6.1
-	github.com/mjibson/go-dsp v0.0.0-20180508042940-11479a337f12
+	github.com/dsnet/compress v0.0.1
+	github.com/klauspost/compress v1.17.4
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
 	github.com/pointlander/compress v1.1.1-0.20230129195249-46dfb34ef5b9
+	github.com/ulikunitz/xz v0.5.12
 	github.com/veandco/go-sdl2 v0.4.38
 	go.bug.st/serial v1.6.2
+	golang.org/x/sys v0.14.0
+	gonum.org/v1/gonum v0.14.0
 )
 
 require (
 	github.com/creack/goselect v0.1.2 // indirect
-	golang.org/x/sys v0.14.0 // indirect
 )
@@ -0,0 +1,83 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "math"
+
+// Governor scales the maximum speed down as the nearest obstacle seen by the
+// ultrasonic sensor, the lidar or the depth camera gets closer
+type Governor struct {
+	Distance *DistanceSensor
+	Lidar    *Lidar
+	Depth    *DepthCamera
+	// Near is the distance in centimeters at and below which the speed is
+	// scaled by Min
+	Near float64
+	// Far is the distance in centimeters at and beyond which the speed is not
+	// scaled, 0 disables the governor
+	Far float64
+	// Min is the scale of the speed at the near distance
+	Min float64
+	// Curve is the exponent of the scale between the near and far distances,
+	// 1 is linear and larger values slow down later
+	Curve float64
+}
+
+// Nearest returns the distance in centimeters of the nearest obstacle seen by
+// any of the sensors, a sensor without a fresh reading sees an obstacle at the
+// near distance, ok is false without a sensor
+func (g *Governor) Nearest() (nearest float64, ok bool) {
+	nearest = math.Inf(1)
+	sense := func(distance float64, fresh bool) {
+		if !fresh {
+			distance = g.Near
+		}
+		nearest, ok = math.Min(nearest, distance), true
+	}
+	if g.Distance != nil {
+		d, fresh := g.Distance.Distance()
+		sense(d, fresh)
+	}
+	if g.Lidar != nil {
+		d, fresh := g.Lidar.Nearest()
+		sense(d/10, fresh)
+	}
+	if g.Depth != nil {
+		d, fresh := g.Depth.Nearest()
+		sense(d/10, fresh)
+	}
+	return nearest, ok
+}
+
+// Scale returns the scale of the speed for an obstacle at the distance in
+// centimeters
+func (g *Governor) Scale(distance float64) float64 {
+	if g.Far <= 0 || distance >= g.Far {
+		return 1
+	}
+	if distance <= g.Near || g.Far <= g.Near {
+		return g.Min
+	}
+	x := (distance - g.Near) / (g.Far - g.Near)
+	curve := g.Curve
+	if curve <= 0 {
+		curve = 1
+	}
+	return g.Min + (1-g.Min)*math.Pow(x, curve)
+}
+
+// Limit scales the forward speeds of the wheels by the nearest obstacle and
+// returns the scale, backing away from an obstacle is not slowed down
+func (g *Governor) Limit(left, right float64) (float64, float64, float64) {
+	if g.Far <= 0 || left+right <= 0 {
+		return left, right, 1
+	}
+	nearest, ok := g.Nearest()
+	if !ok {
+		return left, right, 1
+	}
+	scale := g.Scale(nearest)
+	return left * scale, right * scale, scale
+}
@@ -0,0 +1,147 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// GPSKnots is meters per second in a knot
+	GPSKnots = 0.514444
+	// GPSSpeedMax is the speed in meters per second sensed as 255
+	GPSSpeedMax = 5
+	// EarthRadius is the mean radius of the earth in meters
+	EarthRadius = 6371000
+	// GPSStale is the age after which a fix is ignored, a receiver reports
+	// about once a second
+	GPSStale = 3 * time.Second
+)
+
+var (
+	// GPSKeys are the telemetry keys of the latitude, longitude, speed in
+	// meters per second and heading in degrees
+	GPSKeys = [4]string{"lat", "lon", "speed", "heading"}
+)
+
+// GPS reads nmea sentences from a gps receiver into the telemetry
+type GPS struct {
+	Telemetry *Telemetry
+}
+
+// NewGPS creates a new gps
+func NewGPS(telemetry *Telemetry) *GPS {
+	return &GPS{
+		Telemetry: telemetry,
+	}
+}
+
+// Read reads nmea sentences until the reader fails
+func (g *GPS) Read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		err := g.Parse(scanner.Text())
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Parse parses a nmea sentence, only valid rmc sentences update the telemetry
+func (g *GPS) Parse(sentence string) error {
+	sentence = strings.TrimSpace(sentence)
+	if !strings.HasPrefix(sentence, "$") {
+		return nil
+	}
+	if index := strings.Index(sentence, "*"); index >= 0 {
+		checksum, err := strconv.ParseUint(sentence[index+1:], 16, 8)
+		if err != nil {
+			return err
+		}
+		sum := byte(0)
+		for _, c := range []byte(sentence[1:index]) {
+			sum ^= c
+		}
+		if sum != byte(checksum) {
+			return fmt.Errorf("invalid nmea checksum %s", sentence)
+		}
+		sentence = sentence[:index]
+	}
+	fields := strings.Split(sentence, ",")
+	if len(fields[0]) < 6 || fields[0][3:6] != "RMC" {
+		return nil
+	}
+	if len(fields) < 9 || fields[2] != "A" {
+		return nil
+	}
+	lat, err := coordinate(fields[3], fields[4])
+	if err != nil {
+		return err
+	}
+	lon, err := coordinate(fields[5], fields[6])
+	if err != nil {
+		return err
+	}
+	speed, heading := 0.0, 0.0
+	if fields[7] != "" {
+		speed, err = strconv.ParseFloat(fields[7], 64)
+		if err != nil {
+			return err
+		}
+	}
+	if fields[8] != "" {
+		heading, err = strconv.ParseFloat(fields[8], 64)
+		if err != nil {
+			return err
+		}
+	}
+	g.Telemetry.Set(GPSKeys[0], lat)
+	g.Telemetry.Set(GPSKeys[1], lon)
+	g.Telemetry.Set(GPSKeys[2], speed*GPSKnots)
+	g.Telemetry.Set(GPSKeys[3], heading)
+	return nil
+}
+
+// coordinate parses a nmea ddmm.mmmm coordinate and hemisphere into degrees
+func coordinate(value, hemisphere string) (float64, error) {
+	raw, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	degrees := math.Floor(raw / 100)
+	degrees += (raw - 100*degrees) / 60
+	if hemisphere == "S" || hemisphere == "W" {
+		degrees = -degrees
+	}
+	return degrees, nil
+}
+
+// Position returns the latitude and longitude, ok is false without a fresh
+// fix
+func (g *GPS) Position() (lat, lon float64, ok bool) {
+	lat, ok = g.Telemetry.Fresh(GPSKeys[0], GPSStale)
+	if !ok {
+		return 0, 0, false
+	}
+	lon, ok = g.Telemetry.Fresh(GPSKeys[1], GPSStale)
+	return lat, lon, ok
+}
+
+// Sense returns the speed and heading as sensor channels from 0 to 255
+func (g *GPS) Sense() []float64 {
+	speed, _ := g.Telemetry.Get(GPSKeys[2])
+	heading, _ := g.Telemetry.Get(GPSKeys[3])
+	return []float64{
+		255 * math.Min(speed, GPSSpeedMax) / GPSSpeedMax,
+		255 * heading / 360,
+	}
+}
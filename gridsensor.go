@@ -0,0 +1,71 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// GridSensor divides the frame into a grid and senses the complexity of each
+// cell in bits per pixel, the cells are ordered by row
+type GridSensor struct {
+	Columns, Rows int
+	Complexity    Complexity
+	Cell          []byte
+}
+
+// NewGridSensor creates a new grid sensor from a grid of the form
+// columnsxrows
+func NewGridSensor(grid string, complexity Complexity) (*GridSensor, error) {
+	parts := strings.Split(grid, "x")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid grid %s", grid)
+	}
+	columns, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	rows, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	if columns < 1 || rows < 1 {
+		return nil, fmt.Errorf("invalid grid %s", grid)
+	}
+	return &GridSensor{
+		Columns:    columns,
+		Rows:       rows,
+		Complexity: complexity,
+	}, nil
+}
+
+// Sense senses the complexity of each cell of the gray image of a frame
+func (g *GridSensor) Sense(frame *Frame) []float64 {
+	img := frame.Gray
+	bounds := img.Bounds()
+	values := make([]float64, 0, g.Columns*g.Rows)
+	for j := 0; j < g.Rows; j++ {
+		for i := 0; i < g.Columns; i++ {
+			cell := image.Rect(
+				bounds.Min.X+i*bounds.Dx()/g.Columns, bounds.Min.Y+j*bounds.Dy()/g.Rows,
+				bounds.Min.X+(i+1)*bounds.Dx()/g.Columns, bounds.Min.Y+(j+1)*bounds.Dy()/g.Rows)
+			g.Cell = g.Cell[:0]
+			for y := cell.Min.Y; y < cell.Max.Y; y++ {
+				for x := cell.Min.X; x < cell.Max.X; x++ {
+					g.Cell = append(g.Cell, img.GrayAt(x, y).Y)
+				}
+			}
+			if len(g.Cell) == 0 {
+				values = append(values, 0)
+				continue
+			}
+			values = append(values, 8*float64(g.Complexity.Complexity(g.Cell))/float64(len(g.Cell)))
+		}
+	}
+	return values
+}
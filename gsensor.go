@@ -0,0 +1,59 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "math"
+
+const (
+	// EdgeThreshold is the sobel gradient magnitude of an edge
+	EdgeThreshold = 128
+	// EdgeBins is the number of edge orientation histogram bins
+	EdgeBins = 8
+)
+
+// GSensor is a gradient sensor that runs a sobel edge detector and senses the
+// edge density and the entropy of the edge orientations
+type GSensor struct{}
+
+// Sense senses the gray image of a frame, the edge density is scaled to 0
+// to 16
+func (g *GSensor) Sense(frame *Frame) []float64 {
+	img := frame.Gray
+	bounds := img.Bounds()
+	at := func(x, y int) float64 {
+		return float64(img.GrayAt(x, y).Y)
+	}
+	histogram := make([]float64, EdgeBins)
+	edges, pixels := 0.0, 0.0
+	for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
+		for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) -
+				at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) -
+				at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			pixels++
+			magnitude := math.Sqrt(gx*gx + gy*gy)
+			if magnitude < EdgeThreshold {
+				continue
+			}
+			edges++
+			// orientations are folded into [0, pi) because an edge has no
+			// direction
+			orientation := math.Atan2(gy, gx)
+			if orientation < 0 {
+				orientation += math.Pi
+			}
+			bin := int(orientation / math.Pi * EdgeBins)
+			if bin >= EdgeBins {
+				bin = EdgeBins - 1
+			}
+			histogram[bin] += magnitude
+		}
+	}
+	if pixels == 0 {
+		return []float64{0, 0}
+	}
+	return []float64{16 * edges / pixels, Shannon(histogram)}
+}
@@ -0,0 +1,40 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+// HabituationOffset centers the habituated entropy in the range of the minds
+const HabituationOffset = 128
+
+// Habituation subtracts an adaptive baseline, the running mean of the entropy,
+// so the minds seek novelty rather than absolute complexity
+type Habituation struct {
+	// Decay is the decay of the running mean, 0 disables habituation
+	Decay float64
+	// Means are the running means of each value of the observation
+	Means []float64
+}
+
+// NewHabituation creates a new habituation with the given decay
+func NewHabituation(decay float64) Habituation {
+	return Habituation{
+		Decay: decay,
+	}
+}
+
+// Adapt returns the novelty of the observation and updates the baseline
+func (h *Habituation) Adapt(observation []float64) []float64 {
+	if h.Decay <= 0 {
+		return observation
+	}
+	if len(h.Means) != len(observation) {
+		h.Means = append([]float64(nil), observation...)
+	}
+	novelty := make([]float64, len(observation))
+	for i, entropy := range observation {
+		novelty[i] = entropy - h.Means[i] + HabituationOffset
+		h.Means[i] = h.Decay*h.Means[i] + (1-h.Decay)*entropy
+	}
+	return novelty
+}
@@ -0,0 +1,201 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"math/rand"
+)
+
+func init() {
+	// registered here because the low level minds are created from the registry
+	Minds["hierarchical"] = func(rng *rand.Rand, actions int) Mind {
+		mind := NewHierarchicalMind(rng, actions, *FlagHierarchyPeriod, *FlagHierarchyLow)
+		return &mind
+	}
+	Children["hierarchical"] = func() []string {
+		return []string{*FlagHierarchyLow}
+	}
+}
+
+// Behavior is a high level behavior
+type Behavior uint
+
+const (
+	// BehaviorExplore seeks complexity
+	BehaviorExplore Behavior = iota
+	// BehaviorApproach seeks increases in complexity, such as approaching a light
+	BehaviorApproach
+	// BehaviorRetreat avoids complexity
+	BehaviorRetreat
+	// BehaviorCount is the number of behaviors
+	BehaviorCount
+)
+
+// String returns a string representation of the Behavior
+func (b Behavior) String() string {
+	switch b {
+	case BehaviorExplore:
+		return "explore"
+	case BehaviorApproach:
+		return "approach"
+	case BehaviorRetreat:
+		return "retreat"
+	default:
+		return "unknown"
+	}
+}
+
+// Shape shapes the observation seen by the low level mind of the behavior
+func (b Behavior) Shape(observation, last []float64) []float64 {
+	shaped := make([]float64, len(observation))
+	for i, entropy := range observation {
+		switch b {
+		case BehaviorApproach:
+			previous := 0.0
+			if i < len(last) {
+				previous = last[i]
+			}
+			shaped[i] = 128 + 8*(entropy-previous)
+		case BehaviorRetreat:
+			shaped[i] = 256 - entropy
+		default:
+			shaped[i] = entropy
+		}
+	}
+	return shaped
+}
+
+// HierarchicalMind is a two level mind, a slow top level markov mind selects
+// a behavior every Period steps and a fast low level mind per behavior selects
+// the actions
+type HierarchicalMind struct {
+	Actions  int
+	Period   int
+	Count    int
+	Sum      float64
+	Reward   float64
+	Last     []float64
+	Behavior Behavior
+	Top      MarkovMind
+	Low      []Mind
+}
+
+// NewHierarchicalMind creates a new hierarchical mind
+func NewHierarchicalMind(rng *rand.Rand, actions, period int, low string) HierarchicalMind {
+	if period < 1 {
+		period = 1
+	}
+	h := HierarchicalMind{
+		Actions: actions,
+		Period:  period,
+		Top:     NewMarkovMind(rng, int(BehaviorCount)),
+	}
+	for i := 0; i < int(BehaviorCount); i++ {
+		mind, err := NewMind(low, rng, actions)
+		if err != nil {
+			panic(err)
+		}
+		h.Low = append(h.Low, mind)
+	}
+	return h
+}
+
+// Step steps the hierarchical mind
+func (h *HierarchicalMind) Step(rng *rand.Rand, observation []float64, rewards []float64, mask []bool) int {
+	h.Sum += Scalar(observation)
+	h.Reward += Total(rewards)
+	h.Count++
+	if h.Count >= h.Period {
+		h.Behavior = Behavior(h.Top.Step(rng, []float64{h.Sum / float64(h.Count)}, []float64{h.Reward}, nil))
+		h.Sum, h.Reward, h.Count = 0, 0, 0
+	}
+	action := h.Low[h.Behavior].Step(rng, h.Behavior.Shape(observation, h.Last), rewards, mask)
+	h.Last = append(h.Last[:0], observation...)
+	return action
+}
+
+// Reset resets the hierarchical mind
+func (h *HierarchicalMind) Reset() {
+	h.Count, h.Sum, h.Reward, h.Last = 0, 0, 0, nil
+	h.Behavior = BehaviorExplore
+	h.Top.Reset()
+	for _, mind := range h.Low {
+		mind.Reset()
+	}
+}
+
+// Introspect returns a snapshot of the low level mind of the current behavior
+func (h *HierarchicalMind) Introspect() Introspection {
+	introspection := h.Low[h.Behavior].Introspect()
+	introspection.Details["behavior"] = float64(h.Behavior)
+	return introspection
+}
+
+// HierarchicalState is the serialized state of the hierarchical mind
+type HierarchicalState struct {
+	Count    int
+	Sum      float64
+	Reward   float64
+	Last     []float64
+	Behavior Behavior
+	Top      MarkovMind
+	Low      [][]byte
+}
+
+// Save saves the hierarchical mind
+func (h *HierarchicalMind) Save(w io.Writer) error {
+	state := HierarchicalState{
+		Count:    h.Count,
+		Sum:      h.Sum,
+		Reward:   h.Reward,
+		Last:     h.Last,
+		Behavior: h.Behavior,
+		Top:      h.Top,
+	}
+	for _, mind := range h.Low {
+		buffer := bytes.Buffer{}
+		err := mind.Save(&buffer)
+		if err != nil {
+			return err
+		}
+		state.Low = append(state.Low, buffer.Bytes())
+	}
+	return gob.NewEncoder(w).Encode(state)
+}
+
+// Load loads the hierarchical mind
+func (h *HierarchicalMind) Load(r io.Reader) error {
+	state := HierarchicalState{}
+	err := gob.NewDecoder(r).Decode(&state)
+	if err != nil {
+		return err
+	}
+	h.Reset()
+	for i, data := range state.Low {
+		if i >= len(h.Low) {
+			break
+		}
+		err := h.Low[i].Load(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+	}
+	h.Count = state.Count
+	h.Sum = state.Sum
+	h.Reward = state.Reward
+	h.Last = state.Last
+	h.Behavior = state.Behavior
+	h.Top = state.Top
+	if h.Top.Markov == nil {
+		h.Top.Markov = make(map[Context][]float64)
+	}
+	if h.Top.Used == nil {
+		h.Top.Used = make(map[Context]uint64)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math/rand"
+)
+
+// History is a ring buffer of interleaved entropy and action symbols
+type History struct {
+	Buffer      []byte
+	StateIndex  int
+	ActionIndex int
+}
+
+// NewHistory creates a new history filled with random symbols
+func NewHistory(rng *rand.Rand, size int) History {
+	buffer := make([]byte, size)
+	for i := range buffer {
+		buffer[i] = byte(rng.Intn(256))
+	}
+	return History{
+		Buffer:      buffer,
+		StateIndex:  0,
+		ActionIndex: 1,
+	}
+}
+
+// Add adds an entropy symbol to the history and advances to the next action
+// slot
+func (h *History) Add(symbol byte) {
+	h.StateIndex = (h.StateIndex + 2) % len(h.Buffer)
+	h.Buffer[h.StateIndex] = symbol
+	h.ActionIndex = (h.ActionIndex + 2) % len(h.Buffer)
+}
+
+// Set sets the symbol of the current action slot
+func (h *History) Set(symbol byte) {
+	h.Buffer[h.ActionIndex] = symbol
+}
+
+// State returns the entropy symbol i steps in the past
+func (h *History) State(i int) byte {
+	index := (h.StateIndex - 2*i) % len(h.Buffer)
+	if index < 0 {
+		index += len(h.Buffer)
+	}
+	return h.Buffer[index]
+}
+
+// Context returns the markov context of the last two entropy symbols
+func (h *History) Context() Context {
+	return Context{h.State(1), h.State(0)}
+}
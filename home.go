@@ -0,0 +1,64 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"sync"
+)
+
+// Trail records the path of the robot from the odometry as breadcrumbs so it
+// can return along it
+type Trail struct {
+	sync.Mutex
+	// Spacing is the distance in meters between the breadcrumbs
+	Spacing float64
+	// Home is where the robot started
+	Home Waypoint
+	// Breadcrumbs are the recorded positions from the oldest
+	Breadcrumbs []Waypoint
+}
+
+// NewTrail creates a new trail starting at the home pose
+func NewTrail(spacing float64, home Pose) *Trail {
+	return &Trail{
+		Spacing: spacing,
+		Home:    Waypoint{X: home.X, Y: home.Y},
+	}
+}
+
+// Record drops a breadcrumb if the robot moved far enough from the last one
+func (t *Trail) Record(pose Pose) {
+	t.Lock()
+	defer t.Unlock()
+	last := t.Home
+	if n := len(t.Breadcrumbs); n > 0 {
+		last = t.Breadcrumbs[n-1]
+	}
+	if math.Hypot(pose.X-last.X, pose.Y-last.Y) >= t.Spacing {
+		t.Breadcrumbs = append(t.Breadcrumbs, Waypoint{X: pose.X, Y: pose.Y})
+	}
+}
+
+// Return returns the waypoints back to the home pose, along the trail from
+// the newest breadcrumb or straight home
+func (t *Trail) Return(retrace bool) []Waypoint {
+	t.Lock()
+	defer t.Unlock()
+	var waypoints []Waypoint
+	if retrace {
+		for i := len(t.Breadcrumbs) - 1; i >= 0; i-- {
+			waypoints = append(waypoints, t.Breadcrumbs[i])
+		}
+	}
+	return append(waypoints, t.Home)
+}
+
+// Arrived trims the trail once the robot is home
+func (t *Trail) Arrived() {
+	t.Lock()
+	defer t.Unlock()
+	t.Breadcrumbs = nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "image"
+
+// HSensor is a histogram sensor that senses the shannon entropy of the gray
+// pixel histogram, it is cheap enough for low power boards
+type HSensor struct {
+	// Tiles is the number of tiles per side, each tile is a channel, 0 or 1
+	// senses the whole frame
+	Tiles int
+}
+
+// Sense senses the gray image of a frame
+func (h *HSensor) Sense(frame *Frame) []float64 {
+	img := frame.Gray
+	bounds := img.Bounds()
+	tiles := h.Tiles
+	if tiles < 1 {
+		tiles = 1
+	}
+	entropies := make([]float64, 0, tiles*tiles)
+	for i := 0; i < tiles; i++ {
+		for j := 0; j < tiles; j++ {
+			tile := image.Rect(
+				bounds.Min.X+i*bounds.Dx()/tiles, bounds.Min.Y+j*bounds.Dy()/tiles,
+				bounds.Min.X+(i+1)*bounds.Dx()/tiles, bounds.Min.Y+(j+1)*bounds.Dy()/tiles)
+			entropies = append(entropies, Shannon(Histogram(img, tile)))
+		}
+	}
+	return entropies
+}
+
+// Histogram returns the histogram of the gray pixels in a rectangle
+func Histogram(img *image.Gray, rect image.Rectangle) []float64 {
+	histogram := make([]float64, 256)
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			histogram[img.GrayAt(x, y).Y]++
+		}
+	}
+	return histogram
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "math"
+
+// IMUAccelMax is the full scale of the raw acceleration reported by the rover
+const IMUAccelMax = 32768
+
+var (
+	// IMUAngles are the telemetry keys of the roll, pitch and yaw in degrees
+	IMUAngles = [3]string{"r", "p", "y"}
+	// IMUAccels are the telemetry keys of the raw acceleration
+	IMUAccels = [3]string{"ax", "ay", "az"}
+)
+
+// IMU is the inertial measurement unit reported in the rover telemetry
+type IMU struct {
+	Telemetry *Telemetry
+	// Bump is the change in raw acceleration between steps that is a collision
+	Bump float64
+	// Tilt is the roll or pitch in degrees that is a tilt
+	Tilt float64
+	Last [3]float64
+}
+
+// NewIMU creates a new imu
+func NewIMU(telemetry *Telemetry, bump, tilt float64) *IMU {
+	return &IMU{
+		Telemetry: telemetry,
+		Bump:      bump,
+		Tilt:      tilt,
+	}
+}
+
+// Orientation returns the roll, pitch and yaw in degrees
+func (i *IMU) Orientation() (orientation [3]float64) {
+	for j, key := range IMUAngles {
+		orientation[j], _ = i.Telemetry.Get(key)
+	}
+	return orientation
+}
+
+// Acceleration returns the raw acceleration
+func (i *IMU) Acceleration() (acceleration [3]float64) {
+	for j, key := range IMUAccels {
+		acceleration[j], _ = i.Telemetry.Get(key)
+	}
+	return acceleration
+}
+
+// Sense returns the orientation and acceleration as sensor channels from 0
+// to 255
+func (i *IMU) Sense() []float64 {
+	values := make([]float64, 0, 6)
+	for _, angle := range i.Orientation() {
+		values = append(values, 255*(angle+180)/360)
+	}
+	for _, accel := range i.Acceleration() {
+		accel = math.Max(math.Min(accel, IMUAccelMax), -IMUAccelMax)
+		values = append(values, 255*(accel+IMUAccelMax)/(2*IMUAccelMax))
+	}
+	return values
+}
+
+// Bumped returns true if the acceleration changed by more than the bump
+// threshold since the last call
+func (i *IMU) Bumped() bool {
+	acceleration, jerk := i.Acceleration(), 0.0
+	for j, value := range acceleration {
+		delta := value - i.Last[j]
+		jerk += delta * delta
+	}
+	last := i.Last
+	i.Last = acceleration
+	if last == [3]float64{} {
+		return false
+	}
+	return math.Sqrt(jerk) > i.Bump
+}
+
+// Tilted returns true if the roll or pitch exceeds the tilt threshold
+func (i *IMU) Tilted() bool {
+	orientation := i.Orientation()
+	return math.Abs(orientation[0]) > i.Tilt || math.Abs(orientation[1]) > i.Tilt
+}
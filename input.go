@@ -0,0 +1,198 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "github.com/veandco/go-sdl2/sdl"
+
+// Input is a command of the operator from a game controller button or a key
+type Input int
+
+const (
+	// InputNone does nothing
+	InputNone Input = iota
+	// InputForward drives forward while it is held
+	InputForward
+	// InputBackward drives backward while it is held
+	InputBackward
+	// InputLeft turns left while it is held
+	InputLeft
+	// InputRight turns right while it is held
+	InputRight
+	// InputMode toggles between the manual and the autonomous mode
+	InputMode
+	// InputSpeed cycles the speed
+	InputSpeed
+	// InputLights toggles the lights
+	InputLights
+	// InputThumbsUp rewards the mind
+	InputThumbsUp
+	// InputSnapshot takes a snapshot
+	InputSnapshot
+	// InputEStop engages the emergency stop
+	InputEStop
+	// InputClear clears the emergency stop
+	InputClear
+	// InputGripOpen opens the gripper
+	InputGripOpen
+	// InputGripClose closes the gripper
+	InputGripClose
+	// InputArmHome folds the arm
+	InputArmHome
+	// InputHome returns to the start
+	InputHome
+	// InputWaypoint adds the current pose as a waypoint
+	InputWaypoint
+	// InputClearWaypoints clears the waypoints
+	InputClearWaypoints
+	// InputNavigate starts and stops the navigation
+	InputNavigate
+	// InputSkip skips the current waypoint
+	InputSkip
+	// InputDriveMode cycles the drive mode of the sticks
+	InputDriveMode
+	// InputCount is the number of inputs
+	InputCount
+)
+
+// String returns the name of the input
+func (i Input) String() string {
+	switch i {
+	case InputForward:
+		return "forward"
+	case InputBackward:
+		return "backward"
+	case InputLeft:
+		return "left"
+	case InputRight:
+		return "right"
+	case InputMode:
+		return "mode"
+	case InputSpeed:
+		return "speed"
+	case InputLights:
+		return "lights"
+	case InputThumbsUp:
+		return "thumbs-up"
+	case InputSnapshot:
+		return "snapshot"
+	case InputEStop:
+		return "estop"
+	case InputClear:
+		return "clear"
+	case InputGripOpen:
+		return "grip-open"
+	case InputGripClose:
+		return "grip-close"
+	case InputArmHome:
+		return "arm-home"
+	case InputHome:
+		return "home"
+	case InputWaypoint:
+		return "waypoint"
+	case InputClearWaypoints:
+		return "clear-waypoints"
+	case InputNavigate:
+		return "navigate"
+	case InputSkip:
+		return "skip"
+	case InputDriveMode:
+		return "drive-mode"
+	}
+	return "none"
+}
+
+// ParseInput parses the name of an input
+func ParseInput(name string) (Input, bool) {
+	for input := InputForward; input < InputCount; input++ {
+		if input.String() == name {
+			return input, true
+		}
+	}
+	return InputNone, false
+}
+
+// Held returns true if the input drives while it is held
+func (i Input) Held() bool {
+	return i >= InputForward && i <= InputRight
+}
+
+// ControllerInputs are the inputs of the game controller buttons
+var ControllerInputs = map[uint8]Input{
+	sdl.CONTROLLER_BUTTON_A:             InputMode,
+	sdl.CONTROLLER_BUTTON_B:             InputSpeed,
+	sdl.CONTROLLER_BUTTON_X:             InputLights,
+	sdl.CONTROLLER_BUTTON_Y:             InputThumbsUp,
+	sdl.CONTROLLER_BUTTON_LEFTSHOULDER:  InputSnapshot,
+	sdl.CONTROLLER_BUTTON_RIGHTSHOULDER: InputEStop,
+	sdl.CONTROLLER_BUTTON_BACK:          InputClear,
+	sdl.CONTROLLER_BUTTON_START:         InputGripOpen,
+	sdl.CONTROLLER_BUTTON_GUIDE:         InputGripClose,
+	sdl.CONTROLLER_BUTTON_LEFTSTICK:     InputArmHome,
+	sdl.CONTROLLER_BUTTON_RIGHTSTICK:    InputHome,
+	sdl.CONTROLLER_BUTTON_DPAD_UP:       InputWaypoint,
+	sdl.CONTROLLER_BUTTON_DPAD_DOWN:     InputClearWaypoints,
+	sdl.CONTROLLER_BUTTON_DPAD_LEFT:     InputNavigate,
+	sdl.CONTROLLER_BUTTON_DPAD_RIGHT:    InputSkip,
+}
+
+// ControllerCombos are the inputs of a game controller button pressed while
+// another is held, by the held and the pressed button
+var ControllerCombos = map[[2]uint8]Input{
+	{sdl.CONTROLLER_BUTTON_BACK, sdl.CONTROLLER_BUTTON_START}: InputDriveMode,
+}
+
+// Buttons are the held game controller buttons, the input of a button that
+// is held for a combo is handled when it is released without a combo so a
+// combo never triggers it
+type Buttons struct {
+	Held map[uint8]bool
+	// Combined are the held buttons that were used in a combo
+	Combined map[uint8]bool
+}
+
+// NewButtons creates new game controller buttons
+func NewButtons() *Buttons {
+	return &Buttons{
+		Held:     make(map[uint8]bool),
+		Combined: make(map[uint8]bool),
+	}
+}
+
+// Modifier returns true if the button is held for a combo
+func Modifier(button uint8) bool {
+	for combo := range ControllerCombos {
+		if combo[0] == button {
+			return true
+		}
+	}
+	return false
+}
+
+// Input returns the input of a pressed or released game controller button, a
+// combo with a held button takes precedence over the button alone
+func (b *Buttons) Input(button uint8, pressed bool) (Input, bool) {
+	if pressed {
+		b.Held[button] = true
+		for combo, input := range ControllerCombos {
+			if combo[1] == button && b.Held[combo[0]] {
+				b.Combined[combo[0]] = true
+				return input, true
+			}
+		}
+		if Modifier(button) {
+			return InputNone, false
+		}
+		input, ok := ControllerInputs[button]
+		return input, ok
+	}
+	combined := b.Combined[button]
+	delete(b.Held, button)
+	delete(b.Combined, button)
+	if Modifier(button) && !combined {
+		input, ok := ControllerInputs[button]
+		return input, ok
+	}
+	return InputNone, false
+}
@@ -0,0 +1,201 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// AxisMax is the largest magnitude of a joystick axis
+const AxisMax = 32767
+
+// AxisNames are the names of the game controller axes in the config file,
+// the same as the names of sdl
+var AxisNames = [sdl.CONTROLLER_AXIS_MAX]string{
+	sdl.CONTROLLER_AXIS_LEFTX:        "leftx",
+	sdl.CONTROLLER_AXIS_LEFTY:        "lefty",
+	sdl.CONTROLLER_AXIS_RIGHTX:       "rightx",
+	sdl.CONTROLLER_AXIS_RIGHTY:       "righty",
+	sdl.CONTROLLER_AXIS_TRIGGERLEFT:  "lefttrigger",
+	sdl.CONTROLLER_AXIS_TRIGGERRIGHT: "righttrigger",
+}
+
+const (
+	// AxisLinear is the linear response curve
+	AxisLinear = "linear"
+	// AxisExpo blends the linear response with a cubic response
+	AxisExpo = "expo"
+)
+
+// AxisMap maps the raw value of a joystick axis to a proportional command
+type AxisMap struct {
+	// Deadzone is the fraction of the axis around the center that maps to 0
+	Deadzone float64
+	// Saturation is the fraction of the axis beyond which it maps to 1, 0 is
+	// the end of the axis
+	Saturation float64
+	// Curve is the response curve, linear or expo, empty is expo
+	Curve string
+	// Expo blends the linear response with a cubic response, 0 is linear and
+	// 1 is cubic
+	Expo float64
+	// Min, Center and Max are the raw extents and the rest position of the
+	// axis recorded by the calibration, equal extents are the full range
+	// centered at 0 and an extent at the center is the end of the axis
+	Min, Center, Max int16
+}
+
+// NewAxisMap creates a new axis map
+func NewAxisMap(deadzone, expo float64) AxisMap {
+	return AxisMap{
+		Deadzone:   math.Max(0, math.Min(deadzone, .99)),
+		Saturation: 1,
+		Curve:      AxisExpo,
+		Expo:       math.Max(0, math.Min(expo, 1)),
+	}
+}
+
+// Map maps a raw axis value to [-1, 1], the range between the deadzone and
+// the saturation is rescaled so the response starts at 0 and ends at 1
+func (a AxisMap) Map(value int16) float64 {
+	min, center, max := float64(a.Min), float64(a.Center), float64(a.Max)
+	if a.Min == a.Max {
+		min, center, max = -AxisMax, 0, AxisMax
+	}
+	// a side without an extent is the full range of the axis
+	if max <= center {
+		max = AxisMax
+	}
+	if min >= center {
+		min = -AxisMax
+	}
+	x, v := 0.0, float64(value)
+	if v > center && max > center {
+		x = (v - center) / (max - center)
+	} else if v < center && center > min {
+		x = (v - center) / (center - min)
+	}
+	x = math.Max(-1, math.Min(x, 1))
+	deadzone := math.Max(0, math.Min(a.Deadzone, .99))
+	saturation := a.Saturation
+	if saturation <= deadzone || saturation > 1 {
+		saturation = 1
+	}
+	magnitude := math.Abs(x)
+	if magnitude <= deadzone {
+		return 0
+	}
+	magnitude = math.Min((magnitude-deadzone)/(saturation-deadzone), 1)
+	if a.Curve != AxisLinear {
+		expo := math.Max(0, math.Min(a.Expo, 1))
+		magnitude = (1-expo)*magnitude + expo*magnitude*magnitude*magnitude
+	}
+	return math.Copysign(magnitude, x)
+}
+
+// AxisMaps are the maps of the game controller axes
+type AxisMaps [sdl.CONTROLLER_AXIS_MAX]AxisMap
+
+// NewAxisMaps creates the maps of the game controller axes from the deadzone
+// and the expo, an axis of the config by name replaces them
+func NewAxisMaps(deadzone, expo float64, config map[string]AxisMap) (AxisMaps, error) {
+	var maps AxisMaps
+	for i := range maps {
+		maps[i] = NewAxisMap(deadzone, expo)
+	}
+	for name, mapping := range config {
+		found := false
+		for i, axis := range AxisNames {
+			if axis == name {
+				maps[i], found = mapping, true
+				break
+			}
+		}
+		if !found {
+			return maps, fmt.Errorf("unknown axis %s", name)
+		}
+	}
+	return maps, nil
+}
+
+// Map maps the raw value of an axis
+func (a *AxisMaps) Map(axes [sdl.CONTROLLER_AXIS_MAX]int16, axis int) float64 {
+	return a[axis].Map(axes[axis])
+}
+
+// DriveMode is how the sticks of the game controller drive the wheels
+type DriveMode int
+
+const (
+	// DriveTank the left and right sticks drive the left and right wheels
+	DriveTank DriveMode = iota
+	// DriveArcade the left stick throttles and steers
+	DriveArcade
+	// DriveCar the right trigger throttles, the left trigger reverses and
+	// the left stick steers, the robot does not turn in place
+	DriveCar
+	// DriveModeCount is the number of drive modes
+	DriveModeCount
+)
+
+// String returns the name of the drive mode
+func (d DriveMode) String() string {
+	switch d {
+	case DriveTank:
+		return "tank"
+	case DriveArcade:
+		return "arcade"
+	case DriveCar:
+		return "car"
+	}
+	return "unknown"
+}
+
+// ParseDriveMode parses the name of a drive mode, empty is tank
+func ParseDriveMode(name string) (DriveMode, error) {
+	if name == "" {
+		return DriveTank, nil
+	}
+	for mode := DriveTank; mode < DriveModeCount; mode++ {
+		if mode.String() == name {
+			return mode, nil
+		}
+	}
+	return DriveTank, fmt.Errorf("unknown drive mode %s", name)
+}
+
+// Next returns the next drive mode
+func (d DriveMode) Next() DriveMode {
+	return (d + 1) % DriveModeCount
+}
+
+// Trigger returns true if the drive mode uses the left trigger, otherwise it
+// sets the brightness of the lights
+func (d DriveMode) Trigger() bool {
+	return d == DriveCar
+}
+
+// Mix mixes the game controller axes into the proportional speeds of the
+// wheels, up on a stick is negative
+func (d DriveMode) Mix(axes [sdl.CONTROLLER_AXIS_MAX]int16, mapping *AxisMaps) (left, right float64) {
+	clamp := func(x float64) float64 {
+		return math.Max(-1, math.Min(1, x))
+	}
+	switch d {
+	case DriveArcade:
+		throttle := -mapping.Map(axes, sdl.CONTROLLER_AXIS_LEFTY)
+		steer := mapping.Map(axes, sdl.CONTROLLER_AXIS_LEFTX)
+		return clamp(throttle + steer), clamp(throttle - steer)
+	case DriveCar:
+		throttle := mapping.Map(axes, sdl.CONTROLLER_AXIS_TRIGGERRIGHT) -
+			mapping.Map(axes, sdl.CONTROLLER_AXIS_TRIGGERLEFT)
+		steer := mapping.Map(axes, sdl.CONTROLLER_AXIS_LEFTX) * math.Abs(throttle)
+		return clamp(throttle + steer), clamp(throttle - steer)
+	}
+	return -mapping.Map(axes, sdl.CONTROLLER_AXIS_LEFTY), -mapping.Map(axes, sdl.CONTROLLER_AXIS_RIGHTY)
+}
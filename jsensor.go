@@ -0,0 +1,38 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"image/jpeg"
+)
+
+// JPEGQuality is the quality frames without an encoded frame are encoded with
+const JPEGQuality = 75
+
+// JSensor is a jpeg sensor that uses the size of the motion jpeg frame as a
+// complexity estimate without decoding it, frames without an encoded frame
+// are encoded from their gray image
+type JSensor struct {
+	Buffer bytes.Buffer
+}
+
+// Sense senses the encoded size of a frame in bits per pixel
+func (j *JSensor) Sense(frame *Frame) []float64 {
+	encoded := frame.Encoded
+	if encoded == nil {
+		j.Buffer.Reset()
+		err := jpeg.Encode(&j.Buffer, frame.Gray, &jpeg.Options{Quality: JPEGQuality})
+		if err != nil {
+			panic(err)
+		}
+		encoded = j.Buffer.Bytes()
+	}
+	config, err := jpeg.DecodeConfig(bytes.NewReader(encoded))
+	if err != nil || config.Width*config.Height == 0 {
+		return []float64{0}
+	}
+	return []float64{8 * float64(len(encoded)) / float64(config.Width*config.Height)}
+}
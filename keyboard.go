@@ -0,0 +1,193 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+	"golang.org/x/sys/unix"
+)
+
+// KeyboardTap is how long a key of the terminal drives, the terminal does not
+// report releases so a held key drives by repeating
+const KeyboardTap = 500 * time.Millisecond
+
+// KeyInputs are the inputs of the keys of the preview window
+var KeyInputs = map[sdl.Keycode]Input{
+	sdl.K_w:      InputForward,
+	sdl.K_UP:     InputForward,
+	sdl.K_s:      InputBackward,
+	sdl.K_DOWN:   InputBackward,
+	sdl.K_a:      InputLeft,
+	sdl.K_LEFT:   InputLeft,
+	sdl.K_d:      InputRight,
+	sdl.K_RIGHT:  InputRight,
+	sdl.K_m:      InputMode,
+	sdl.K_f:      InputSpeed,
+	sdl.K_l:      InputLights,
+	sdl.K_t:      InputThumbsUp,
+	sdl.K_p:      InputSnapshot,
+	sdl.K_SPACE:  InputEStop,
+	sdl.K_c:      InputClear,
+	sdl.K_h:      InputHome,
+	sdl.K_ESCAPE: InputEStop,
+}
+
+// TerminalInputs are the inputs of the keys of the terminal, the arrow keys
+// are escape sequences that end in A to D
+var TerminalInputs = map[byte]Input{
+	'w': InputForward,
+	's': InputBackward,
+	'a': InputLeft,
+	'd': InputRight,
+	'm': InputMode,
+	'f': InputSpeed,
+	'l': InputLights,
+	't': InputThumbsUp,
+	'p': InputSnapshot,
+	' ': InputEStop,
+	'c': InputClear,
+	'h': InputHome,
+}
+
+// TerminalArrows are the inputs of the final bytes of the arrow keys
+var TerminalArrows = map[byte]Input{
+	'A': InputForward,
+	'B': InputBackward,
+	'C': InputRight,
+	'D': InputLeft,
+}
+
+// Keyboard drives the robot with the keys of the preview window or the
+// terminal, so it can be driven without a joystick
+type Keyboard struct {
+	sync.Mutex
+	// Held are the inputs of the keys of the window that are held down
+	Held map[Input]bool
+	// Until is when each tapped input of the terminal is released
+	Until map[Input]time.Time
+	// Driving is true if an input was held at the last call of Speeds
+	Driving bool
+	// Inputs are the inputs of the terminal that are not held
+	Inputs chan Input
+	// restore is the state of the terminal before it was made raw
+	restore *unix.Termios
+}
+
+// NewKeyboard creates a new keyboard
+func NewKeyboard() *Keyboard {
+	return &Keyboard{
+		Held:   make(map[Input]bool),
+		Until:  make(map[Input]time.Time),
+		Inputs: make(chan Input, 8),
+	}
+}
+
+// Press holds an input until it is released
+func (k *Keyboard) Press(input Input) {
+	k.Lock()
+	defer k.Unlock()
+	k.Held[input] = true
+}
+
+// Release releases an input
+func (k *Keyboard) Release(input Input) {
+	k.Lock()
+	defer k.Unlock()
+	delete(k.Held, input)
+}
+
+// Tap holds an input for the tap time
+func (k *Keyboard) Tap(input Input) {
+	k.Lock()
+	defer k.Unlock()
+	k.Until[input] = time.Now().Add(KeyboardTap)
+}
+
+// Speeds returns the proportional speeds of the wheels of the held inputs,
+// ok is false if no input is held now or was held at the last call so the
+// keyboard does not override the joystick
+func (k *Keyboard) Speeds(now time.Time) (left, right float64, ok bool) {
+	k.Lock()
+	defer k.Unlock()
+	held := func(input Input) float64 {
+		if k.Held[input] || now.Before(k.Until[input]) {
+			return 1
+		}
+		return 0
+	}
+	linear := held(InputForward) - held(InputBackward)
+	angular := held(InputLeft) - held(InputRight)
+	driving := linear != 0 || angular != 0
+	ok, k.Driving = driving || k.Driving, driving
+	left = math.Max(-1, math.Min(1, linear-angular))
+	right = math.Max(-1, math.Min(1, linear+angular))
+	return left, right, ok
+}
+
+// Terminal makes the terminal raw and reads its keys until it fails, the held
+// inputs are tapped and the others are sent on the inputs
+func (k *Keyboard) Terminal() error {
+	fd := int(os.Stdin.Fd())
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+	restore := *termios
+	termios.Lflag &^= unix.ICANON | unix.ECHO
+	termios.Cc[unix.VMIN], termios.Cc[unix.VTIME] = 1, 0
+	err = unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+	if err != nil {
+		return err
+	}
+	k.Lock()
+	k.restore = &restore
+	k.Unlock()
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		key, err := reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		input, ok := TerminalInputs[key]
+		if key == 0x1b {
+			// an arrow key is escape [ and a letter
+			if next, err := reader.ReadByte(); err != nil || next != '[' {
+				continue
+			}
+			final, err := reader.ReadByte()
+			if err != nil {
+				return err
+			}
+			input, ok = TerminalArrows[final]
+		}
+		if !ok {
+			continue
+		}
+		if input.Held() {
+			k.Tap(input)
+			continue
+		}
+		select {
+		case k.Inputs <- input:
+		default:
+		}
+	}
+}
+
+// Close restores the terminal
+func (k *Keyboard) Close() error {
+	k.Lock()
+	defer k.Unlock()
+	if k.restore == nil {
+		return nil
+	}
+	return unix.IoctlSetTermios(int(os.Stdin.Fd()), unix.TCSETS, k.restore)
+}
@@ -0,0 +1,129 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KillWindow is how old a kill packet can be before it is rejected as a
+// replay
+const KillWindow = 5 * time.Second
+
+// Kill is a remote kill switch that engages the emergency stop on an
+// authenticated http request or udp packet from a phone or a second machine
+type Kill struct {
+	sync.Mutex
+	EStop *EStop
+	// Secret is the shared secret of the kill commands
+	Secret []byte
+	// Last is the time stamp of the last accepted kill packet, older packets
+	// are replays
+	Last int64
+}
+
+// NewKill creates a new kill switch, the secret can't be empty
+func NewKill(estop *EStop, secret string) *Kill {
+	if secret == "" {
+		panic("the kill switch needs a secret")
+	}
+	return &Kill{
+		EStop:  estop,
+		Secret: []byte(secret),
+	}
+}
+
+// Sign returns the hex hmac of a message with the secret
+func Sign(secret []byte, message string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns the hex hmac of a message
+func (k *Kill) Sign(message string) string {
+	return Sign(k.Secret, message)
+}
+
+// Packet returns a kill packet for the time, used by the sending side
+func (k *Kill) Packet(now time.Time) string {
+	message := fmt.Sprintf("kill %d", now.UnixNano())
+	return message + " " + k.Sign(message)
+}
+
+// Verify returns nil if the packet is a fresh kill command signed with the
+// secret, a packet is "kill <unix nanoseconds> <hex hmac of the rest>"
+func (k *Kill) Verify(packet string, now time.Time) error {
+	fields := strings.Fields(packet)
+	if len(fields) != 3 || fields[0] != "kill" {
+		return fmt.Errorf("invalid kill packet")
+	}
+	stamp, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return err
+	}
+	expected := k.Sign(fields[0] + " " + fields[1])
+	if !hmac.Equal([]byte(expected), []byte(fields[2])) {
+		return fmt.Errorf("invalid kill signature")
+	}
+	if age := now.Sub(time.Unix(0, stamp)); age > KillWindow || age < -KillWindow {
+		return fmt.Errorf("stale kill packet")
+	}
+	k.Lock()
+	defer k.Unlock()
+	if stamp <= k.Last {
+		return fmt.Errorf("replayed kill packet")
+	}
+	k.Last = stamp
+	return nil
+}
+
+// Listen engages the emergency stop on each valid kill packet received on the
+// udp address until the listener fails
+func (k *Kill) Listen(address string) error {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	buffer := make([]byte, 256)
+	for {
+		n, from, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return err
+		}
+		err = k.Verify(string(buffer[:n]), time.Now())
+		if err != nil {
+			fmt.Println("kill:", from, err)
+			continue
+		}
+		k.EStop.Engage("kill " + from.String())
+	}
+}
+
+// ServeHTTP engages the emergency stop on a post with the secret as the bearer
+// token
+func (k *Kill) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !hmac.Equal([]byte(token), k.Secret) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	k.EStop.Engage("kill " + r.RemoteAddr)
+	w.WriteHeader(http.StatusNoContent)
+}
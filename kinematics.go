@@ -0,0 +1,85 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Kinematics is the kinematics of a differential drive
+type Kinematics struct {
+	// TrackWidth is the distance between the wheels in meters
+	TrackWidth float64
+}
+
+// Wheels converts a linear velocity in meters per second and an angular
+// velocity in radians per second, counterclockwise is positive, into the
+// speeds of the wheels
+func (k Kinematics) Wheels(linear, angular float64) (left, right float64) {
+	return linear - angular*k.TrackWidth/2, linear + angular*k.TrackWidth/2
+}
+
+// Velocity converts the speeds of the wheels into a linear and an angular
+// velocity
+func (k Kinematics) Velocity(left, right float64) (linear, angular float64) {
+	return (left + right) / 2, (right - left) / k.TrackWidth
+}
+
+// Pose is a position in meters and a heading in radians relative to where
+// the robot started
+type Pose struct {
+	X, Y, Theta float64
+}
+
+// Odometry estimates the pose of the robot by integrating the speeds of the
+// wheels
+type Odometry struct {
+	sync.Mutex
+	Kinematics Kinematics
+	Pose       Pose
+	Last       time.Time
+}
+
+// NewOdometry creates a new odometry
+func NewOdometry(trackWidth float64) *Odometry {
+	return &Odometry{
+		Kinematics: Kinematics{TrackWidth: trackWidth},
+	}
+}
+
+// Integrate moves the pose by the speeds of the wheels over the time in
+// seconds
+func (o *Odometry) Integrate(left, right, dt float64) Pose {
+	o.Lock()
+	defer o.Unlock()
+	linear, angular := o.Kinematics.Velocity(left, right)
+	// the midpoint heading is used for the arc
+	theta := o.Pose.Theta + angular*dt/2
+	o.Pose.X += linear * dt * math.Cos(theta)
+	o.Pose.Y += linear * dt * math.Sin(theta)
+	o.Pose.Theta = math.Remainder(o.Pose.Theta+angular*dt, 2*math.Pi)
+	return o.Pose
+}
+
+// Update integrates the speeds of the wheels over the time since the last
+// update
+func (o *Odometry) Update(left, right float64) Pose {
+	now := time.Now()
+	dt := 0.0
+	if !o.Last.IsZero() {
+		dt = now.Sub(o.Last).Seconds()
+	}
+	o.Last = now
+	return o.Integrate(left, right, dt)
+}
+
+// Get returns the estimated pose
+func (o *Odometry) Get() Pose {
+	o.Lock()
+	defer o.Unlock()
+	return o.Pose
+}
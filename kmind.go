@@ -6,71 +6,114 @@ package main
 
 import (
 	"bytes"
+	"encoding/gob"
+	"io"
 	"math"
 	"math/rand"
-
-	"github.com/pointlander/compress"
 )
 
 // KMind is a kolmogorov complexity mind
 type KMind struct {
+	Seed         int64
+	Actions      int
+	Length       int
+	Compressor   string
 	ActionBuffer []byte
-	ActionState  []byte
-	StateIndex   int
-	ActionIndex  int
+	History      History
 	Filter       []float64
+	Normalized   []float64
+	Action       int
+	Visits       []uint64
+	Schedule     Schedule
 }
 
-// NewKMind creates a new kolmogorv mind
-func NewKMind(rng *rand.Rand) KMind {
-	actionBuffer := make([]byte, Size)
-	actionState := make([]byte, Size)
-	for i := range actionState {
-		actionState[i] = byte(rng.Intn(256))
-		actionBuffer[i] = byte(rng.Intn(256))
+// NewKMind creates a new kolmogorv mind with the given buffer length and
+// compressor
+func NewKMind(rng *rand.Rand, actions, length int, compressor string) KMind {
+	if _, err := NewCompressor(compressor); err != nil {
+		panic(err)
 	}
-	filter := make([]float64, ActionCount)
-	return KMind{
-		ActionBuffer: actionBuffer,
-		ActionState:  actionState,
-		StateIndex:   0,
-		ActionIndex:  1,
-		Filter:       filter,
+	k := KMind{
+		Seed:       rng.Int63(),
+		Actions:    actions,
+		Length:     length,
+		Compressor: compressor,
 	}
+	k.Reset()
+	return k
+}
+
+// Reset resets the kolmogorov complexity mind
+func (k *KMind) Reset() {
+	rng := rand.New(rand.NewSource(k.Seed))
+	k.History = NewHistory(rng, k.Length)
+	actionBuffer := make([]byte, k.Length)
+	for i := range actionBuffer {
+		actionBuffer[i] = byte(rng.Intn(256))
+	}
+	k.ActionBuffer = actionBuffer
+	k.Filter = make([]float64, k.Actions)
+	k.Normalized = nil
+	k.Action = 0
+	k.Visits = make([]uint64, k.Actions)
+	k.Schedule.Reset()
 }
 
 // KMind steps the kolmogorov complexity mind
-func (k *KMind) Step(rng *rand.Rand, entropy float64) int {
-	k.StateIndex = (k.StateIndex + 2) % Size
-	k.ActionState[k.StateIndex] = byte(math.Round(entropy))
-	k.ActionIndex = (k.ActionIndex + 2) % Size
-	entropies := make([]float64, ActionCount)
-	for a := 0; a < int(ActionCount); a++ {
+func (k *KMind) Step(rng *rand.Rand, observation []float64, rewards []float64, mask []bool) int {
+	entropy := Scalar(observation)
+	if last := int(k.ActionBuffer[0]); last < k.Actions {
+		k.Filter[last] += Total(rewards)
+	}
+	compressor := Compressors[k.Compressor]
+	k.History.Add(Symbol(observation))
+	entropies := make([]float64, k.Actions)
+	for a := 0; a < k.Actions; a++ {
 		pre := byte(a)
 		for i, value := range k.ActionBuffer[:len(k.ActionBuffer)-1] {
 			k.ActionBuffer[i], pre = pre, value
 		}
 		output := bytes.Buffer{}
-		compress.Mark1Compress1(k.ActionBuffer, &output)
-		entropy := 256 * float64(output.Len()) / Size
-		k.ActionState[k.ActionIndex] = byte(math.Round(entropy))
+		compressor.Compress(k.ActionBuffer, &output)
+		entropy := 256 * float64(output.Len()) / float64(k.Length)
+		k.History.Set(byte(math.Round(entropy)))
 		output = bytes.Buffer{}
-		compress.Mark1Compress1(k.ActionState, &output)
-		entropies[a] = float64(output.Len()) / Size
+		compressor.Compress(k.History.Buffer, &output)
+		entropies[a] = float64(output.Len()) / float64(k.Length)
 	}
 	for i, value := range entropies {
 		k.Filter[i] = (k.Filter[i] + value) / 2
 	}
-	normalized := softmax(k.Filter, .4)
+	k.Normalized = ApplyMask(softmax(k.Filter, k.Schedule.Temperature(.4, entropy)), mask)
 	sum, action, selected := 0.0, 0, rng.Float64()
-	for i, value := range normalized {
+	for i, value := range k.Normalized {
 		sum += value
 		if sum > selected {
 			action = i
 			break
 		}
 	}
-	k.ActionState[k.ActionIndex] = byte(math.Round(256 * entropies[action]))
+	k.History.Set(byte(math.Round(256 * entropies[action])))
 	k.ActionBuffer[0] = byte(action)
+	k.Action = action
+	k.Visits[action]++
 	return action
 }
+
+// Introspect returns a snapshot of the kolmogorov complexity mind
+func (k *KMind) Introspect() Introspection {
+	return NewIntrospection(k.Action, k.Normalized, k.Visits, k.Filter)
+}
+
+// Save saves the kolmogorov complexity mind
+func (k *KMind) Save(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(k)
+}
+
+// Load loads the kolmogorov complexity mind
+func (k *KMind) Load(r io.Reader) error {
+	*k = KMind{}
+	err := gob.NewDecoder(r).Decode(k)
+	k.Visits = visits(k.Visits, k.Actions)
+	return err
+}
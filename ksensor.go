@@ -5,76 +5,113 @@
 package main
 
 import (
-	"bytes"
 	"image"
 	"math"
 	"math/cmplx"
-	"math/rand"
-
-	"github.com/mjibson/go-dsp/dsputils"
-	"github.com/mjibson/go-dsp/fft"
-	"github.com/pointlander/compress"
 )
 
 // KSensor is a kolmogorov sensor
 type KSensor struct {
-	ImgBuffer *dsputils.Matrix
+	// Input is the image of the frame that is sensed, empty is gray
+	Input string
+	// Bands is the number of frequency bands, 0 senses a single value
+	Bands int
+	// Preprocess crops and downsamples the image before the fft
+	Preprocess Preprocess
+	Spectrum   *Spectrum
+	// Complexity estimates the complexity of the spectrum, nil is mark1
+	Complexity Complexity
+	// State and States are reused between frames
+	State  []byte
+	States [][]byte
+}
+
+// Image returns the image of the frame that is sensed
+func (k *KSensor) Image() string {
+	return k.Input
 }
 
-// Sense senses an image
-func (k *KSensor) Sense(rng *rand.Rand, img *image.Gray) float64 {
+// Sense senses the input image of a frame
+func (k *KSensor) Sense(frame *Frame) []float64 {
+	img := k.Preprocess.Prepare(frame.Input(k.Input))
+	if k.Bands > 0 {
+		return k.SenseBands(img)
+	}
+	return []float64{k.SenseGray(img)}
+}
+
+// transform adds an image to the spectrum and computes the fft
+func (k *KSensor) transform(img *image.Gray) []complex128 {
 	dx := img.Bounds().Dx()
 	dy := img.Bounds().Dy()
-	if k.ImgBuffer == nil {
-		k.ImgBuffer = dsputils.MakeMatrix(make([]complex128, FFTDepth*dx*dy), []int{FFTDepth, dx, dy})
-	}
-	for d := FFTDepth - 1; d > 0; d-- {
-		for x := 0; x < dx; x++ {
-			for y := 0; y < dy; y++ {
-				k.ImgBuffer.SetValue(k.ImgBuffer.Value([]int{d - 1, x, y}), []int{d, x, y})
-			}
-		}
+	if k.Spectrum == nil || k.Spectrum.Width != dx || k.Spectrum.Height != dy {
+		k.Spectrum = NewSpectrum(FFTDepth, dx, dy)
 	}
+	pixels := k.Spectrum.Pixels
 	for x := 0; x < dx; x++ {
 		for y := 0; y < dy; y++ {
-			g := float64(img.GrayAt(x, y).Y)
-			if rng != nil {
-				g += 3 * rng.NormFloat64()
-				if g < 0 {
-					g = 0
-				} else if g > 255 {
-					g = 255
-				}
-			}
-			k.ImgBuffer.SetValue(complex(g/255, 0), []int{0, x, y})
+			pixels[x*dy+y] = float64(img.GrayAt(x, y).Y) / 255
 		}
 	}
-	freq := fft.FFTN(k.ImgBuffer)
-	sum := 0.0
-	sumPhase := 0.0
-	for i := 0; i < FFTDepth; i++ {
-		for x := 0; x < dx; x++ {
-			for y := 0; y < dy; y++ {
-				value := freq.Value([]int{i, x, y})
-				sum += cmplx.Abs(value)
-				sumPhase += cmplx.Phase(value) + math.Pi
-			}
-		}
+	return k.Spectrum.Transform()
+}
+
+// sums returns the sum of the magnitudes and shifted phases of the fft
+func (k *KSensor) sums(freq []complex128) (sum, sumPhase float64) {
+	for _, value := range freq {
+		sum += cmplx.Abs(value)
+		sumPhase += cmplx.Phase(value) + math.Pi
 	}
-	state, index := make([]byte, 2*FFTDepth*dx*dy), 0
-	for i := 0; i < FFTDepth; i++ {
-		for x := 0; x < dx; x++ {
-			for y := 0; y < dy; y++ {
-				value := freq.Value([]int{i, x, y})
-				state[index] = byte(255 * cmplx.Abs(value) / sum)
-				index++
-				state[index] = byte(255 * (cmplx.Phase(value) + math.Pi) / sumPhase)
-				index++
-			}
-		}
+	return sum, sumPhase
+}
+
+// compress returns the compressed size of a state
+func (k *KSensor) compress(state []byte) int {
+	if k.Complexity == nil {
+		k.Complexity = &CompressorComplexity{Compressor: Mark1Compressor{}}
+	}
+	return k.Complexity.Complexity(state)
+}
+
+// SenseGray senses an image
+func (k *KSensor) SenseGray(img *image.Gray) float64 {
+	freq := k.transform(img)
+	sum, sumPhase := k.sums(freq)
+	if len(k.State) != 2*len(freq) {
+		k.State = make([]byte, 2*len(freq))
+	}
+	state := k.State
+	for i, value := range freq {
+		state[2*i] = byte(255 * cmplx.Abs(value) / sum)
+		state[2*i+1] = byte(255 * (cmplx.Phase(value) + math.Pi) / sumPhase)
 	}
-	output := bytes.Buffer{}
-	compress.Mark1Compress1(state, &output)
-	entropy := 255 * float64(output.Len()) / float64(len(state))
+	entropy := 255 * float64(k.compress(state)) / float64(len(state))
 	return entropy
 }
+
+// SenseBands senses an image and returns the complexity of each frequency band
+func (k *KSensor) SenseBands(img *image.Gray) []float64 {
+	freq := k.transform(img)
+	sum, sumPhase := k.sums(freq)
+	if len(k.States) != k.Bands {
+		k.States = make([][]byte, k.Bands)
+	}
+	states := k.States
+	for band := range states {
+		states[band] = states[band][:0]
+	}
+	for i, band := range k.Spectrum.Bands(k.Bands) {
+		value := freq[i]
+		states[band] = append(states[band],
+			byte(255*cmplx.Abs(value)/sum),
+			byte(255*(cmplx.Phase(value)+math.Pi)/sumPhase))
+	}
+	entropies := make([]float64, k.Bands)
+	for band, state := range states {
+		if len(state) == 0 {
+			continue
+		}
+		entropies[band] = 255 * float64(k.compress(state)) / float64(len(state))
+	}
+	return entropies
+}
@@ -0,0 +1,186 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const (
+	// PipeWidth is the default frame width of the pipe cameras
+	PipeWidth = 640
+	// PipeHeight is the default frame height of the pipe cameras
+	PipeHeight = 480
+)
+
+func init() {
+	Cameras["libcamera"] = func(config CameraConfig) Camera {
+		camera := NewPipeCamera(config)
+		camera.Command = camera.LibcameraCommand
+		return camera
+	}
+	Cameras["gstreamer"] = func(config CameraConfig) Camera {
+		camera := NewPipeCamera(config)
+		camera.Command = camera.GStreamerCommand
+		return camera
+	}
+}
+
+// ReadI420 reads a raw i420 frame
+func ReadI420(reader io.Reader, width, height int) (*image.YCbCr, error) {
+	frame := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio420)
+	for _, plane := range [][]byte{frame.Y, frame.Cb, frame.Cr} {
+		_, err := io.ReadFull(reader, plane)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return frame, nil
+}
+
+// PipeCamera is a camera that reads raw i420 frames from the standard output
+// of a command, the libcamera and gstreamer backends are pipe cameras so the
+// csi cameras of newer raspberry pi os releases, which are not exposed through
+// v4l, can be used
+type PipeCamera struct {
+	FrameCounters
+	Images chan Frame
+	// Source is the name the frames are tagged with
+	Source string
+	// Device is the camera of the command, empty is the default camera
+	Device             string
+	Width, Height, FPS int
+	// Command returns the command that streams the frames
+	Command func() *exec.Cmd
+	// Status receives the connection status events
+	Status chan<- CameraStatus
+}
+
+// NewPipeCamera creates a new pipe camera
+func NewPipeCamera(config CameraConfig) *PipeCamera {
+	camera := &PipeCamera{
+		Images: make(chan Frame, 1),
+		Source: config.Source,
+		Device: config.Device,
+		Width:  config.Width,
+		Height: config.Height,
+		FPS:    config.FPS,
+		Status: config.Status,
+	}
+	if camera.Width <= 0 || camera.Height <= 0 {
+		camera.Width, camera.Height = PipeWidth, PipeHeight
+	}
+	// i420 chroma is subsampled by two
+	camera.Width, camera.Height = camera.Width&^1, camera.Height&^1
+	return camera
+}
+
+// Frames returns the channel the frames are streamed to
+func (pc *PipeCamera) Frames() chan Frame {
+	return pc.Images
+}
+
+// LibcameraCommand returns the libcamera command, rpicam-vid on newer
+// releases and libcamera-vid on older ones
+func (pc *PipeCamera) LibcameraCommand() *exec.Cmd {
+	name := "rpicam-vid"
+	if _, err := exec.LookPath(name); err != nil {
+		name = "libcamera-vid"
+	}
+	args := []string{"-n", "-t", "0", "--codec", "yuv420",
+		"--width", strconv.Itoa(pc.Width), "--height", strconv.Itoa(pc.Height), "-o", "-"}
+	if pc.FPS > 0 {
+		args = append(args, "--framerate", strconv.Itoa(pc.FPS))
+	}
+	if pc.Device != "" {
+		args = append(args, "--camera", pc.Device)
+	}
+	return exec.Command(name, args...)
+}
+
+// GStreamerCommand returns the gstreamer pipeline command with the libcamera
+// source
+func (pc *PipeCamera) GStreamerCommand() *exec.Cmd {
+	args := []string{"-q", "libcamerasrc"}
+	if pc.Device != "" {
+		args = append(args, "camera-name="+pc.Device)
+	}
+	caps := fmt.Sprintf("video/x-raw,format=I420,width=%d,height=%d", pc.Width, pc.Height)
+	if pc.FPS > 0 {
+		caps += fmt.Sprintf(",framerate=%d/1", pc.FPS)
+	}
+	args = append(args, "!", caps, "!", "fdsink", "fd=1")
+	return exec.Command("gst-launch-1.0", args...)
+}
+
+// Start streams frames, the command is restarted with exponential backoff
+// when it exits
+func (pc *PipeCamera) Start() {
+	backoff := CameraBackoffMin
+	for {
+		frames, err := pc.stream()
+		pc.publish(CameraStatus{Source: pc.Source, Device: pc.Device, Err: err})
+		if frames > 0 {
+			backoff = CameraBackoffMin
+		}
+		fmt.Println(pc.Source, err, "restarting in", backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > CameraBackoffMax {
+			backoff = CameraBackoffMax
+		}
+	}
+}
+
+// publish publishes a status event without blocking the camera
+func (pc *PipeCamera) publish(status CameraStatus) {
+	if pc.Status == nil {
+		return
+	}
+	select {
+	case pc.Status <- status:
+	default:
+	}
+}
+
+// stream runs the command and streams its frames until it exits and returns
+// the number of frames streamed
+func (pc *PipeCamera) stream() (int, error) {
+	cmd := pc.Command()
+	fmt.Println(cmd.String())
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return 0, err
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+
+	reader := bufio.NewReaderSize(stdout, pc.Width*pc.Height*3/2)
+	count := 0
+	for {
+		frame, err := ReadI420(reader, pc.Width, pc.Height)
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = fmt.Errorf("%s exited", cmd.Path)
+			}
+			return count, err
+		}
+		if count == 0 {
+			pc.publish(CameraStatus{Source: pc.Source, Device: pc.Device, Connected: true})
+		}
+		count++
+		pc.Send(pc.Images, NewFrame(pc.Source, frame, nil))
+	}
+}
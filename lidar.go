@@ -0,0 +1,172 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// LidarBins is the number of angle bins of a scan
+	LidarBins = 360
+	// LidarRangeMax is the maximum range in millimeters
+	LidarRangeMax = 12000
+	// LidarHistogram is the number of range histogram bins
+	LidarHistogram = 32
+)
+
+var (
+	// LidarScanCommand starts a rplidar scan
+	LidarScanCommand = []byte{0xA5, 0x20}
+	// LidarStopCommand stops a rplidar scan
+	LidarStopCommand = []byte{0xA5, 0x25}
+	// LidarScanDescriptor is the response descriptor of a scan
+	LidarScanDescriptor = []byte{0xA5, 0x5A, 0x05, 0x00, 0x00, 0x40, 0x81}
+)
+
+// Scan is a 2d lidar scan of the range in millimeters of each degree, 0 is no
+// return
+type Scan [LidarBins]float64
+
+// Nearest returns the nearest range of a scan in millimeters
+func (s *Scan) Nearest() float64 {
+	nearest := math.Inf(1)
+	for _, value := range s {
+		if value > 0 && value < nearest {
+			nearest = value
+		}
+	}
+	return nearest
+}
+
+// Lidar is a rplidar class 2d lidar on a serial port
+type Lidar struct {
+	sync.Mutex
+	Telemetry *Telemetry
+	Latest    *Scan
+	// Updated is when the latest scan was completed
+	Updated time.Time
+	// Scans receives each complete scan for mapping, scans are dropped if it
+	// is full
+	Scans chan Scan
+}
+
+// NewLidar creates a new lidar
+func NewLidar(telemetry *Telemetry) *Lidar {
+	return &Lidar{
+		Telemetry: telemetry,
+		Scans:     make(chan Scan, 1),
+	}
+}
+
+// Start starts scanning and reads scans until the port fails
+func (l *Lidar) Start(port io.ReadWriter) error {
+	_, err := port.Write(LidarStopCommand)
+	if err != nil {
+		return err
+	}
+	_, err = port.Write(LidarScanCommand)
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(port)
+	descriptor := make([]byte, len(LidarScanDescriptor))
+	_, err = io.ReadFull(reader, descriptor)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(descriptor, LidarScanDescriptor) {
+		return fmt.Errorf("invalid lidar scan descriptor %x", descriptor)
+	}
+	scan, started := Scan{}, false
+	sample := make([]byte, 5)
+	for {
+		_, err := io.ReadFull(reader, sample)
+		if err != nil {
+			return err
+		}
+		start, inverse, check := sample[0]&1, (sample[0]>>1)&1, sample[1]&1
+		if start == inverse || check != 1 {
+			// resynchronize on a corrupt sample
+			_, err := reader.ReadByte()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if start == 1 {
+			if started {
+				l.publish(scan)
+			}
+			scan, started = Scan{}, true
+		}
+		quality := sample[0] >> 2
+		angle := float64(uint16(sample[1])>>1|uint16(sample[2])<<7) / 64
+		distance := float64(uint16(sample[3])|uint16(sample[4])<<8) / 4
+		if quality == 0 || distance == 0 {
+			continue
+		}
+		scan[int(angle)%LidarBins] = distance
+	}
+}
+
+// publish records a complete scan
+func (l *Lidar) publish(scan Scan) {
+	l.Lock()
+	l.Latest, l.Updated = &scan, time.Now()
+	l.Unlock()
+	// a scan without a return is reported at the maximum range, infinity
+	// can't be encoded as json
+	nearest := math.Min(scan.Nearest(), LidarRangeMax)
+	l.Telemetry.Set("lidar_nearest", nearest)
+	select {
+	case l.Scans <- scan:
+	default:
+	}
+}
+
+// Get returns the latest scan, nil without a fresh scan
+func (l *Lidar) Get() *Scan {
+	l.Lock()
+	defer l.Unlock()
+	if time.Since(l.Updated) >= SensorStale {
+		return nil
+	}
+	return l.Latest
+}
+
+// Nearest returns the nearest range of the latest scan in millimeters, ok is
+// false without a fresh scan, a scan without a return is the maximum range
+func (l *Lidar) Nearest() (nearest float64, ok bool) {
+	scan := l.Get()
+	if scan == nil {
+		return LidarRangeMax, false
+	}
+	return math.Min(scan.Nearest(), LidarRangeMax), true
+}
+
+// Sense returns the entropy of the range histogram of the latest scan scaled
+// to 0 to 255
+func (l *Lidar) Sense() []float64 {
+	scan := l.Get()
+	if scan == nil {
+		return []float64{0}
+	}
+	histogram := make([]float64, LidarHistogram)
+	for _, value := range scan {
+		if value <= 0 {
+			continue
+		}
+		bin := int(math.Min(value, LidarRangeMax-1) * LidarHistogram / LidarRangeMax)
+		histogram[bin]++
+	}
+	return []float64{255 * Shannon(histogram) / math.Log2(LidarHistogram)}
+}
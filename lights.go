@@ -0,0 +1,105 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "sync"
+
+const (
+	// LightBrightness is the default brightness of the lights
+	LightBrightness = 128
+	// LightStep is the change of the brightness of a dimming action
+	LightStep = 32
+)
+
+// Headlights are the lights of the robot with an adjustable brightness, the
+// pwm of the lights is reported in telemetry
+type Headlights struct {
+	sync.Mutex
+	Chassis   Chassis
+	Telemetry *Telemetry
+	// Brightness is the pwm of the lights when they are on
+	Brightness int
+	State      LightState
+}
+
+// NewHeadlights creates new headlights that are off
+func NewHeadlights(chassis Chassis, telemetry *Telemetry, brightness int) *Headlights {
+	return &Headlights{
+		Chassis:    chassis,
+		Telemetry:  telemetry,
+		Brightness: clampPWM(brightness),
+		State:      LightStateOff,
+	}
+}
+
+// clampPWM clamps a pwm to 0..255
+func clampPWM(pwm int) int {
+	if pwm < 0 {
+		return 0
+	} else if pwm > 255 {
+		return 255
+	}
+	return pwm
+}
+
+// apply sends the pwm of the lights to the chassis
+func (h *Headlights) apply() {
+	pwm := 0
+	if h.State == LightStateOn {
+		pwm = h.Brightness
+	}
+	h.Chassis.Lights(pwm)
+	h.Telemetry.Set("lights", float64(pwm))
+}
+
+// Set turns the lights on or off
+func (h *Headlights) Set(on bool) {
+	h.Lock()
+	defer h.Unlock()
+	h.State = LightStateOff
+	if on {
+		h.State = LightStateOn
+	}
+	h.apply()
+}
+
+// Toggle turns the lights on if they are off and off if they are on
+func (h *Headlights) Toggle() {
+	h.Lock()
+	on := h.State == LightStateOff
+	h.Unlock()
+	h.Set(on)
+}
+
+// SetBrightness sets the brightness of the lights, lights that are on change
+// at once
+func (h *Headlights) SetBrightness(brightness int) {
+	h.Lock()
+	defer h.Unlock()
+	brightness = clampPWM(brightness)
+	if brightness == h.Brightness {
+		return
+	}
+	h.Brightness = brightness
+	if h.State == LightStateOn {
+		h.apply()
+	}
+}
+
+// Adjust changes the brightness of the lights by the delta and turns them on
+func (h *Headlights) Adjust(delta int) {
+	h.Lock()
+	defer h.Unlock()
+	h.Brightness = clampPWM(h.Brightness + delta)
+	h.State = LightStateOn
+	h.apply()
+}
+
+// Restore sends the state of the lights again after they were overridden
+func (h *Headlights) Restore() {
+	h.Lock()
+	defer h.Unlock()
+	h.apply()
+}
@@ -5,14 +5,19 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"flag"
 	"fmt"
 	"image"
+	"image/draw"
+	"io"
 	"math"
 	"math/rand"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -20,8 +25,6 @@ import (
 	"go.bug.st/serial"
 )
 
-var joysticks = make(map[int]*sdl.Joystick)
-
 const (
 	// S is the scaling factor for the softmax
 	S = 1.0 - 1e-300
@@ -29,6 +32,8 @@ const (
 	Size = 1024
 	// FFTDepth is the depth of the fft
 	FFTDepth = 8
+	// ShutdownTimeout is how long the shutdown waits for the mind to stop
+	ShutdownTimeout = 5 * time.Second
 )
 
 type (
@@ -65,6 +70,10 @@ const (
 	ModeManual Mode = iota
 	// ModeAuto
 	ModeAuto
+	// ModeNavigate
+	ModeNavigate
+	// ModeReturn
+	ModeReturn
 )
 
 const (
@@ -80,6 +89,26 @@ const (
 	ActionNone
 	// ActionLight
 	ActionLight
+	// ActionSnapshot
+	ActionSnapshot
+	// ActionArcLeft
+	ActionArcLeft
+	// ActionArcRight
+	ActionArcRight
+	// ActionPivotLeft
+	ActionPivotLeft
+	// ActionPivotRight
+	ActionPivotRight
+	// ActionBurst
+	ActionBurst
+	// ActionBrighter
+	ActionBrighter
+	// ActionDimmer
+	ActionDimmer
+	// ActionGripOpen
+	ActionGripOpen
+	// ActionGripClose
+	ActionGripClose
 	// ActionCount
 	ActionCount
 )
@@ -96,11 +125,109 @@ func (j JoystickState) String() string {
 	}
 }
 
+// String returns the name of the mode
+func (m Mode) String() string {
+	switch m {
+	case ModeManual:
+		return "manual"
+	case ModeAuto:
+		return "auto"
+	case ModeNavigate:
+		return "navigate"
+	case ModeReturn:
+		return "return"
+	}
+	return "unknown"
+}
+
+// String returns a string representation of the TypeAction
+func (a TypeAction) String() string {
+	switch a {
+	case ActionLeft:
+		return "left"
+	case ActionRight:
+		return "right"
+	case ActionForward:
+		return "forward"
+	case ActionBackward:
+		return "backward"
+	case ActionNone:
+		return "none"
+	case ActionLight:
+		return "light"
+	case ActionSnapshot:
+		return "snapshot"
+	case ActionArcLeft:
+		return "arc-left"
+	case ActionArcRight:
+		return "arc-right"
+	case ActionPivotLeft:
+		return "pivot-left"
+	case ActionPivotRight:
+		return "pivot-right"
+	case ActionBurst:
+		return "burst"
+	case ActionBrighter:
+		return "brighter"
+	case ActionDimmer:
+		return "dimmer"
+	case ActionGripOpen:
+		return "grip-open"
+	case ActionGripClose:
+		return "grip-close"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// InputGray is the gray thumbnail of a frame
+	InputGray = "gray"
+	// InputThumb is the thumbnail of a frame
+	InputThumb = "thumb"
+	// InputFull is the full resolution frame
+	InputFull = "full"
+)
+
 // Frame is a video frame
 type Frame struct {
-	Frame *image.YCbCr
-	Thumb image.Image
-	Gray  *image.Gray
+	// Source is the camera the frame is from
+	Source string
+	// Sequence is the sequence number of the frame from its camera
+	Sequence uint64
+	// Time is the capture time of the frame, it has a monotonic clock reading
+	Time time.Time
+	// Exposure is the exposure of the frame in 100us units, 0 is unknown
+	Exposure int32
+	Frame    *image.YCbCr
+	Thumb    image.Image
+	Gray     *image.Gray
+	// Encoded is the motion jpeg frame if the camera streams motion jpeg
+	Encoded []byte
+}
+
+// Input returns the gray image of an input of the frame: gray, thumb, or
+// full, the gray thumbnail is returned if the input is missing
+func (f *Frame) Input(input string) *image.Gray {
+	switch input {
+	case InputThumb:
+		if f.Thumb != nil {
+			bounds := f.Thumb.Bounds()
+			gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+			draw.Draw(gray, gray.Bounds(), f.Thumb, bounds.Min, draw.Src)
+			return gray
+		}
+	case InputFull:
+		if f.Frame != nil {
+			// the luma plane of the frame is a gray image
+			return &image.Gray{
+				Pix:    f.Frame.Y,
+				Stride: f.Frame.YStride,
+				Rect:   f.Frame.Rect,
+			}
+		}
+	}
+	return f.Gray
 }
 
 func softmax(values []float64, t float64) []float64 {
@@ -127,277 +254,1314 @@ func softmax(values []float64, t float64) []float64 {
 var (
 	// FlagSim is simulation mode
 	FlagSim = flag.Bool("sim", false, "simulation mode")
+	// FlagSeed is the seed of the random number generators
+	FlagSeed = flag.Int64("seed", 1, "seed of the random number generators")
+	// FlagDeterministic steps the mind in lockstep with the frames
+	FlagDeterministic = flag.Bool("deterministic", false, "sense the cameras in lockstep and step the mind once for each frame sequence number instead of on each frame of the first camera as it arrives")
+	// FlagStepLog is a file to log the observation and action of each step to
+	FlagStepLog = flag.String("step-log", "", "log the observation and action of each mind step to a file")
+	// FlagRecord is the directory sessions are recorded in
+	FlagRecord = flag.String("record", "", "record the frames, observations and actions into a timestamped session in this directory")
+	// FlagRecordFormat is the image format of the recorded frames
+	FlagRecordFormat = flag.String("record-format", RecordJPEG, "image format of the recorded frames: jpeg or png")
+	// FlagShadow is a mind that shadows the mind in control
+	FlagShadow = flag.String("shadow", "", "mind that shadows the mind in control without controlling the robot")
+	// FlagShadowLog is the comparison log of the shadow mind
+	FlagShadowLog = flag.String("shadow-log", "shadow.csv", "comparison log of the control and shadow minds")
+	// FlagHabituation is the decay of the habituation baseline
+	FlagHabituation = flag.Float64("habituation", 0, "decay of the running mean entropy baseline subtracted before the mind, 0 disables habituation")
+	// FlagCalibration is the decay of the sensor calibration statistics
+	FlagCalibration = flag.Float64("calibration", 0, "decay of the running mean and variance normalizing each sensor value to a z-score, 0 disables calibration")
+	// FlagTrain is a recording of sensor observations to pre-train the mind with
+	FlagTrain = flag.String("train", "", "pre-train the mind on a recording of sensor observations")
+	// FlagTrainEpochs is the number of training epochs
+	FlagTrainEpochs = flag.Int("train-epochs", 16, "number of training epochs")
+	// FlagTrainSegment is the length of the replayed segments
+	FlagTrainSegment = flag.Int("train-segment", 64, "length of the replayed segments of the recording")
+	// FlagTrainOutput is the trained mind checkpoint
+	FlagTrainOutput = flag.String("train-output", "mind.gob", "output checkpoint of the trained mind")
+	// FlagReplay is a recorded session to re-run the agent on
+	FlagReplay = flag.String("replay", "", "re-run the agent deterministically on a recorded session or a directory of images, the commands to the chassis are dropped")
+	// FlagBenchSensors is a directory of images to benchmark the sensors on
+	FlagBenchSensors = flag.String("bench-sensors", "", "benchmark all sensors on a directory of images or recorded frames")
+	// FlagBenchOutput is the csv output of the sensor benchmark
+	FlagBenchOutput = flag.String("bench-output", "sensors.csv", "csv output of the sensor benchmark")
+	// FlagConfig is the json configuration file
+	FlagConfig = flag.String("config", "", "json configuration file, see Config")
+	// FlagSensor is the sensor to use
+	FlagSensor = flag.String("sensor", "ksensor", "the sensor to use")
+	// FlagNoise is the type of noise injected into the frames of the sensor
+	FlagNoise = flag.String("noise", NoiseNone, "noise injected into the frames of the sensor: none, gaussian, or uniform")
+	// FlagNoiseSigma is the standard deviation of the injected noise
+	FlagNoiseSigma = flag.Float64("noise-sigma", 3, "standard deviation in gray levels of the injected noise")
+	// FlagNoiseSeed is the seed of the injected noise
+	FlagNoiseSeed = flag.Int64("noise-seed", 1, "seed of the injected noise")
+	// FlagKSensorInput is the input image of the kolmogorov sensor
+	FlagKSensorInput = flag.String("ksensor-input", InputGray, "image of the frame sensed by the kolmogorov sensor: gray, thumb, or full")
+	// FlagThumbScale is the factor the thumbnails are downsampled by
+	FlagThumbScale = flag.Int("thumb-scale", 16, "factor the frames are downsampled by into the thumbnails the sensors sense")
+	// FlagThumbMethod is the downsampling method of the thumbnails
+	FlagThumbMethod = flag.String("thumb-method", ThumbNearest, "downsampling method of the thumbnails: nearest, box, bilinear, or lanczos")
+	// FlagESensorInput is the input image of the entropy sensor
+	FlagESensorInput = flag.String("esensor-input", InputGray, "image of the frame sensed by the entropy sensor: gray, thumb, or full")
+	// FlagEventSensor is the sensor of the event sensor
+	FlagEventSensor = flag.String("event-sensor", "ksensor", "sensor that senses the frames that are events for the event sensor")
+	// FlagEventThreshold is the mean absolute gray difference of an event
+	FlagEventThreshold = flag.Float64("event-threshold", 4, "mean absolute gray difference from the last event that is an event")
+	// FlagVideoDevice is the device of the camera
+	FlagVideoDevice = flag.String("video-device", "", "device of the camera: a v4l device, /dev/video0 by default, a libcamera camera, or a recorded session for replay")
+	// FlagVideoWidth is the requested frame width
+	FlagVideoWidth = flag.Int("video-width", 0, "requested frame width, the closest supported size is used, 0 is the smallest size")
+	// FlagVideoHeight is the requested frame height
+	FlagVideoHeight = flag.Int("video-height", 0, "requested frame height, the closest supported size is used, 0 is the smallest size")
+	// FlagVideoFPS is the requested frame rate
+	FlagVideoFPS = flag.Int("video-fps", 0, "requested frame rate, 0 is the camera default")
+	// FlagVideo is the mp4 file the frames the mind acts on are encoded to
+	FlagVideo = flag.String("video", "", "encode the frames the mind acts on to an h.264 mp4 file with the actions in a subtitle track")
+	// FlagVideoEncoder is the ffmpeg h.264 encoder of the video
+	FlagVideoEncoder = flag.String("video-encoder", "libx264", "ffmpeg h.264 encoder of the video, h264_v4l2m2m is the raspberry pi hardware encoder")
+	// FlagSnapshots is the directory the snapshots are saved in
+	FlagSnapshots = flag.String("snapshots", "snapshots", "directory the snapshots taken by the joystick or the mind are saved in")
+	// FlagPreview opens a preview window
+	FlagPreview = flag.Bool("preview", false, "open a window with the live camera frame, the entropy, the selected action and the mode")
+	// FlagFrameStats is the interval the health metrics of the cameras are printed
+	FlagFrameStats = flag.Duration("frame-stats", 0, "interval the frame rate, streamed, dropped and decode error counters of the cameras are printed, 0 disables")
+	// FlagAccel is the acceleration of the wheels
+	FlagAccel = flag.Float64("accel", 0, "acceleration of the wheels in meters per second squared, 0 is instant")
+	// FlagDecel is the deceleration of the wheels
+	FlagDecel = flag.Float64("decel", 0, "deceleration of the wheels in meters per second squared, 0 is instant")
+	// FlagSpeedExpo is the exponent of the speed curve
+	FlagSpeedExpo = flag.Float64("speed-expo", 0, "exponent of the speed curve that softens small speeds, 0 is linear")
+	// FlagDeadzone is the deadzone of the joystick axes
+	FlagDeadzone = flag.Float64("deadzone", .15, "fraction of the joystick axes around the center that does not drive")
+	// FlagAxisExpo is the response curve of the joystick axes
+	FlagAxisExpo = flag.Float64("axis-expo", .5, "response curve of the joystick axes, 0 is linear and 1 is cubic")
+	// FlagTrackWidth is the distance between the wheels
+	FlagTrackWidth = flag.Float64("track-width", .172, "distance between the wheels in meters used by the odometry")
+	// FlagHTTP is the address of the http control server
+	FlagHTTP = flag.String("http", "", "address of the http control server with the remote control page at /remote?token=<kill secret>, empty disables it")
+	// FlagRumble rumbles the game controllers
+	FlagRumble = flag.Bool("rumble", true, "rumble the game controllers on an obstacle, a mode change and a low battery")
+	// FlagKeyboardTerminal drives with the keys of the terminal
+	FlagKeyboardTerminal = flag.Bool("keyboard-terminal", false, "drive with the keys of the terminal, wasd or the arrows drive, m mode, f speed, l lights, space emergency stop, c clear, h home, p snapshot and t thumbs up")
+	// FlagCalibrate calibrates the game controller axes
+	FlagCalibrate = flag.Duration("calibrate", 0, "record the extents of the game controller axes for the duration while the sticks and triggers are moved to their ends, write them to the config file and exit")
+	// FlagBridge streams the local game controller to a robot
+	FlagBridge = flag.String("bridge", "", "stream the local game controller signed with the kill secret to the bridge of a robot at the udp address until interrupted")
+	// FlagBridgeListen is the udp address of the bridge
+	FlagBridgeListen = flag.String("bridge-listen", "", "udp address the bridge listens on for a game controller streamed from another machine and signed with the kill secret, empty disables it")
+	// FlagKillSecret is the shared secret of the remote kill switch
+	FlagKillSecret = flag.String("kill-secret", "", "shared secret of the remote kill switch served at /kill on the http control server, empty disables it")
+	// FlagKill sends a kill packet to a remote kill switch
+	FlagKill = flag.String("kill", "", "send a kill packet signed with the kill secret to the udp address of a remote kill switch and exit")
+	// FlagKillUDP is the udp address of the remote kill switch
+	FlagKillUDP = flag.String("kill-udp", "", "udp address the remote kill switch listens on for signed kill packets, empty disables it")
+	// FlagWaypointTolerance is the distance at which a waypoint is reached
+	FlagWaypointTolerance = flag.Float64("waypoint-tolerance", .1, "distance in meters at which a waypoint is reached")
+	// FlagControlHz is the rate of the drive control loop
+	FlagControlHz = flag.Float64("control-hz", 10, "rate in hertz of the drive control loop that commands the wheels")
+	// FlagDecisionHz is the rate the decisions of the mind are executed
+	FlagDecisionHz = flag.Float64("decision-hz", 10.0/3, "rate in hertz the actions chosen by the mind are executed")
+	// FlagMotionWatchdog is the time without a beat of the control loop after
+	// which the motors are stopped
+	FlagMotionWatchdog = flag.Duration("motion-watchdog", time.Second, "time without a beat of the drive control loop after which the motors are stopped, 0 disables")
+	// FlagWatchdog is the time without frames after which the robot stops
+	FlagWatchdog = flag.Duration("watchdog", 5*time.Second, "time without frames from a camera after which the robot stops and switches to manual mode, 0 disables")
+	// FlagCameraBackend is the camera backend
+	FlagCameraBackend = flag.String("camera-backend", "v4l", "camera backend: v4l, libcamera, gstreamer, or replay of a recorded session")
+	// FlagCameras are the cameras
+	FlagCameras = flag.String("cameras", "", "comma separated source=device cameras each with their own sensor, e.g. front=/dev/video0,rear=/dev/video2, empty is the video device")
+	// FlagExposure is the exposure of the camera
+	FlagExposure = flag.Int("exposure", -1, "exposure of the v4l camera in 100us units, -1 is automatic")
+	// FlagGain is the gain of the camera
+	FlagGain = flag.Int("gain", -1, "gain of the v4l camera, -1 is automatic")
+	// FlagWhiteBalance is the white balance temperature of the camera
+	FlagWhiteBalance = flag.Int("white-balance", -1, "white balance temperature of the v4l camera in kelvin, -1 is automatic")
+	// FlagAutoExposure adjusts the exposure based on the frame brightness
+	FlagAutoExposure = flag.Bool("auto-exposure", false, "adjust the exposure of the v4l camera so the frames are neither under nor over exposed")
+	// FlagH264 streams h.264 from the camera
+	FlagH264 = flag.Bool("h264", false, "stream h.264 from the camera, requires -hw-decode")
+	// FlagHardwareDecode decodes the compressed frames in a stream decoder
+	FlagHardwareDecode = flag.Bool("hw-decode", false, "decode motion jpeg and h.264 frames with ffmpeg and the hardware decoder instead of in go")
+	// FlagMJPEG streams motion jpeg from the camera
+	FlagMJPEG = flag.Bool("mjpeg", false, "stream motion jpeg from the camera, the jpeg sensor then skips decoding")
+	// FlagBands is the number of frequency bands sensed by the sensors
+	FlagBands = flag.Int("bands", 0, "number of frequency bands sensed as a vector, 0 senses a single value")
+	// FlagSensorCompressor is the compressor of the kolmogorov sensors
+	FlagSensorCompressor = flag.String("sensor-compressor", "mark1", "compressor estimating complexity in the kolmogorov sensors: mark1, gzip, lzma, flate, zstd, or bzip2")
+	// FlagROI is the region of interest of the fft sensors
+	FlagROI = flag.String("roi", "", "region of interest x0,y0,x1,y1 cropped before the fft sensors, empty is the whole frame")
+	// FlagDownsample is the size the fft sensors downsample to
+	FlagDownsample = flag.String("downsample", "", "size widthxheight the fft sensors downsample to, e.g. 64x48, empty does not downsample")
+	// FlagGrid is the grid of the grid sensor
+	FlagGrid = flag.String("grid", "4x3", "columnsxrows grid of cells sensed separately by the grid sensor")
+	// FlagTiles is the number of tiles per side of the histogram sensor
+	FlagTiles = flag.Int("tiles", 1, "number of tiles per side sensed separately by the histogram sensor")
+	// FlagDistance is the telemetry key of the ultrasonic distance
+	FlagDistance = flag.String("distance", "", "telemetry key of the ultrasonic distance in centimeters, empty disables the distance sensor")
+	// FlagDistanceMax is the maximum sensed distance
+	FlagDistanceMax = flag.Float64("distance-max", 200, "maximum sensed distance in centimeters")
+	// FlagDistanceStop is the distance below which forward is masked
+	FlagDistanceStop = flag.Float64("distance-stop", 20, "distance in centimeters of the nearest obstacle below which the forward action is masked")
+	// FlagSerial is the serial device of the rover controller
+	FlagSerial = flag.String("serial", "", "serial device of the rover controller, empty scans /dev/ttyAMA0, /dev/serial0, /dev/ttyUSB* and /dev/ttyACM*")
+	// FlagChassis is the driver of the drive base
+	FlagChassis = flag.String("chassis", "waveshare", "driver of the drive base: waveshare or sabertooth")
+	// FlagLightPins are the io pins of the controller driven by the lights
+	FlagLightPins = flag.String("light-pins", "IO4,IO5", "comma separated io pins of the controller driven by the lights")
+	// FlagOutputPins are the io pins of the controller the named outputs can
+	// use
+	FlagOutputPins = flag.String("output-pins", "", "comma separated io pins of the controller the named outputs of the config can use, not the pins of the lights")
+	// FlagBrightness is the initial brightness of the lights
+	FlagBrightness = flag.Int("brightness", LightBrightness, "initial pwm brightness of the lights, 0 to 255")
+	// FlagCliff is the telemetry key of the downward facing distance sensor
+	FlagCliff = flag.String("cliff", "", "telemetry key of the downward facing distance to the floor in centimeters, empty disables the sensor")
+	// FlagCliffMax is the distance to the floor beyond which there is an edge
+	FlagCliffMax = flag.Float64("cliff-max", 10, "distance to the floor in centimeters beyond which there is an edge")
+	// FlagCliffBrightness is the relative change of the floor brightness that
+	// is an edge
+	FlagCliffBrightness = flag.Float64("cliff-brightness", 0, "relative change of the floor brightness seen by the first camera that is an edge, 0 disables")
+	// FlagStuck is the time without progress after which the robot recovers
+	FlagStuck = flag.Duration("stuck", 0, "time the commanded motion makes no progress after which the robot backs up and turns, 0 disables")
+	// FlagStuckFlow is the optical flow below which the view is still
+	FlagStuckFlow = flag.Float64("stuck-flow", 2, "mean absolute difference between frames of the first camera below which the view is still")
+	// FlagTrailSpacing is the distance between the breadcrumbs of the trail
+	FlagTrailSpacing = flag.Float64("trail-spacing", .25, "distance in meters between the breadcrumbs the robot returns along")
+	// FlagReturnStraight returns straight to the start
+	FlagReturnStraight = flag.Bool("return-straight", false, "return straight to the start instead of retracing the trail")
+	// FlagArm enables the robotic arm
+	FlagArm = flag.Bool("arm", false, "the chassis has a robotic arm fitted")
+	// FlagBaud is the baud rate of the rover controller
+	FlagBaud = flag.Int("baud", 115200, "baud rate of the rover controller")
+	// FlagCommandInterval is the minimum time between commands to the rover
+	FlagCommandInterval = flag.Duration("command-interval", 20*time.Millisecond, "minimum time between commands written to the rover controller")
+	// FlagAckTimeout is how long a command waits for the rover to echo it
+	FlagAckTimeout = flag.Duration("ack-timeout", 0, "how long a command waits for the rover controller to echo it back, 0 disables acknowledgments")
+	// FlagGPS is the serial device of the gps receiver
+	FlagGPS = flag.String("gps", "", "serial device of a nmea gps receiver, empty disables the gps")
+	// FlagGPSBaud is the baud rate of the gps receiver
+	FlagGPSBaud = flag.Int("gps-baud", 9600, "baud rate of the gps receiver")
+	// FlagGeofence is the geofence of the robot
+	FlagGeofence = flag.String("geofence", "", "circular gps fence lat,lon,radius in meters, a shorthand for the Fence of the config")
+	// FlagLidar is the serial device of the lidar
+	FlagLidar = flag.String("lidar", "", "serial device of a rplidar class lidar, empty disables the lidar")
+	// FlagDepth is the v4l device of the depth camera
+	FlagDepth = flag.String("depth", "", "v4l device of a realsense style z16 depth stream, empty disables the depth sensor")
+	// FlagThermal is the v4l device of the thermal camera
+	FlagThermal = flag.String("thermal", "", "v4l device of a thermal camera such as a lepton, empty disables the thermal sensor")
+	// FlagBatterySlow is the battery voltage below which the speed is reduced
+	FlagBatterySlow = flag.Float64("battery-slow", 0, "battery voltage reported by the rover below which the speed is reduced, 0 disables")
+	// FlagGovernorNear is the obstacle distance of the slowest speed
+	FlagGovernorNear = flag.Float64("governor-near", 20, "obstacle distance in centimeters at and below which the speed is scaled by the governor minimum")
+	// FlagGovernorFar is the obstacle distance beyond which the speed is not
+	// governed
+	FlagGovernorFar = flag.Float64("governor-far", 0, "obstacle distance in centimeters at and beyond which the speed is not scaled, 0 disables the proximity speed governor")
+	// FlagGovernorMin is the scale of the speed at the near distance
+	FlagGovernorMin = flag.Float64("governor-min", 0, "scale of the speed at the governor near distance")
+	// FlagGovernorCurve is the exponent of the governor scale
+	FlagGovernorCurve = flag.Float64("governor-curve", 1, "exponent of the speed scale between the governor near and far distances, 1 is linear")
+	// FlagBatterySlowScale is the scale of the speed while the battery is low
+	FlagBatterySlowScale = flag.Float64("battery-slow-scale", .5, "scale of the speed while the battery is below the slow voltage")
+	// FlagBatteryFlash is the battery voltage below which the lights flash
+	FlagBatteryFlash = flag.Float64("battery-flash", 0, "battery voltage reported by the rover below which the lights flash, 0 disables")
+	// FlagBatteryMin is the battery voltage below which the robot stops
+	FlagBatteryMin = flag.Float64("battery-min", 0, "battery voltage reported by the rover below which the robot stops driving until it is restarted, 0 disables")
+	// FlagWheels enables the wheel speed sensor
+	FlagWheels = flag.Bool("wheels", false, "sense the wheel speeds reported by the rover")
+	// FlagIMU enables the imu sensor
+	FlagIMU = flag.Bool("imu", false, "sense the orientation and acceleration reported by the rover imu")
+	// FlagIMUBump is the change in raw acceleration that is a collision
+	FlagIMUBump = flag.Float64("imu-bump", 8192, "change in raw acceleration between steps that is a collision")
+	// FlagRollover is the roll or pitch that cuts the motors
+	FlagRollover = flag.Float64("rollover", 0, "roll or pitch in degrees reported by the rover above which the motors are cut and an incident is saved, 0 disables")
+	// FlagIncidentWindow is how far back the flight recorder keeps
+	FlagIncidentWindow = flag.Duration("incident-window", 30*time.Second, "how far back the flight recorder keeps the frames, steps, commands and telemetry saved with an incident, 0 disables the recorder")
+	// FlagIncidents is the directory the incidents are saved in
+	FlagIncidents = flag.String("incidents", "incidents", "directory the incidents are saved in")
+	// FlagIMUTilt is the roll or pitch that is a tilt
+	FlagIMUTilt = flag.Float64("imu-tilt", 30, "roll or pitch in degrees above which the forward action is masked")
+	// FlagMind is the mind to use
+	FlagMind = flag.String("mind", "markov", "the mind to use")
+	// FlagLoad is a mind checkpoint to load
+	FlagLoad = flag.String("load", "", "mind checkpoint to load")
+	// FlagCheckpointDir is the directory for mind checkpoints
+	FlagCheckpointDir = flag.String("checkpoint-dir", "", "directory for mind checkpoints, empty disables checkpointing")
+	// FlagCheckpointEvery is the number of steps between checkpoints
+	FlagCheckpointEvery = flag.Int("checkpoint-every", 1024, "steps between mind checkpoints")
+	// FlagCheckpointKeep is the number of checkpoints to keep
+	FlagCheckpointKeep = flag.Int("checkpoint-keep", 8, "number of mind checkpoints to keep")
+	// FlagRewardWeights are the weights of the auxiliary reward sources
+	FlagRewardWeights = flag.String("reward-weights", "battery=0,bump=-1,thumbs=1", "comma separated source=weight pairs for the auxiliary rewards")
+	// FlagEnsemble is the list of minds in the ensemble mind
+	FlagEnsemble = flag.String("ensemble", "markov,kmind,nn", "comma separated minds for the ensemble mind")
+	// FlagHierarchyPeriod is the number of steps between behavior selections
+	FlagHierarchyPeriod = flag.Int("hierarchy-period", 8, "steps between behavior selections of the hierarchical mind")
+	// FlagHierarchyLow is the low level mind of the hierarchical mind
+	FlagHierarchyLow = flag.String("hierarchy-low", "markov", "the low level mind of the hierarchical mind")
+	// FlagKMindSize is the buffer length of the kolmogorov mind
+	FlagKMindSize = flag.Int("kmind-size", Size, "buffer length of the kolmogorov mind")
+	// FlagKMindCompressor is the compressor of the kolmogorov mind
+	FlagKMindCompressor = flag.String("kmind-compressor", "mark1", "compressor of the kolmogorov mind: mark1, gzip, lzma, flate, zstd, or bzip2")
+	// FlagGAWindow is the number of steps each policy of the genetic algorithm mind is evaluated
+	FlagGAWindow = flag.Int("ga-window", 16, "steps each policy of the genetic algorithm mind is evaluated")
+	// FlagWorldDepth is the rollout depth of the world model mind
+	FlagWorldDepth = flag.Int("world-depth", 2, "rollout depth of the world model mind")
+	// FlagPPMOrder is the maximum context order of the ppm mind
+	FlagPPMOrder = flag.Int("ppm-order", 3, "maximum context order of the ppm mind")
+	// FlagTemperatureSchedule is the softmax temperature schedule
+	FlagTemperatureSchedule = flag.String("temperature-schedule", ScheduleConstant, "softmax temperature schedule: constant, linear, exponential, or adaptive")
+	// FlagTemperatureEnd is the final temperature factor of the schedule
+	FlagTemperatureEnd = flag.Float64("temperature-end", .1, "final factor of the base softmax temperature")
+	// FlagTemperatureSteps is the number of steps of the linear schedule
+	FlagTemperatureSteps = flag.Int("temperature-steps", 1024, "number of steps for the linear temperature schedule")
+	// FlagTemperatureDecay is the decay of the exponential schedule
+	FlagTemperatureDecay = flag.Float64("temperature-decay", .999, "decay per step of the exponential temperature schedule")
+	// FlagMarkovContexts is the maximum number of markov contexts
+	FlagMarkovContexts = flag.Int("markov-contexts", 0, "maximum number of markov contexts, 0 is unbounded")
 )
 
 func main() {
 	flag.Parse()
 
+	var err error
+	Thumbnails, err = NewThumbnailer(*FlagThumbScale, *FlagThumbMethod)
+	if err != nil {
+		panic(err)
+	}
+
 	if *FlagSim {
 		Simulation()
 		return
 	}
 
-	options := &serial.Mode{
-		BaudRate: 115200,
+	if *FlagBenchSensors != "" {
+		BenchSensors(*FlagBenchSensors)
+		return
+	}
+
+	if *FlagTrain != "" {
+		Train(*FlagTrain)
+		return
+	}
+
+	if *FlagCalibrate != 0 {
+		Calibrate(*FlagConfig, *FlagCalibrate, *FlagDeadzone, *FlagAxisExpo)
+		return
 	}
-	port, err := serial.Open("/dev/ttyAMA0", options)
+
+	if *FlagBridge != "" {
+		BridgeClient(*FlagBridge, *FlagKillSecret)
+		return
+	}
+
+	if *FlagKill != "" {
+		conn, err := net.Dial("udp", *FlagKill)
+		if err != nil {
+			panic(err)
+		}
+		defer conn.Close()
+		_, err = conn.Write([]byte(NewKill(nil, *FlagKillSecret).Packet(time.Now())))
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	// a replay runs the whole agent on the frames of a recorded session with a
+	// chassis that drops the commands
+	replay := *FlagReplay != ""
+	chassisName, backend := *FlagChassis, *FlagCameraBackend
+	if replay {
+		chassisName, backend = "replay", "replay"
+	}
+	chassis, err := NewChassis(chassisName, ChassisConfig{
+		Device:     *FlagSerial,
+		Baud:       *FlagBaud,
+		Interval:   *FlagCommandInterval,
+		AckTimeout: *FlagAckTimeout,
+		LightPins:  ParsePins(*FlagLightPins),
+	})
 	if err != nil {
 		panic(err)
 	}
+	telemetry := chassis.Telemetry()
+	config, err := LoadConfig(*FlagConfig)
+	if err != nil {
+		panic(err)
+	}
+	effects, err := NewEffects(config.Actions, config.Outputs)
+	if err != nil {
+		panic(err)
+	}
+	outputs, err := NewOutputs(chassis, config.Outputs, ParsePins(*FlagOutputPins), ParsePins(*FlagLightPins), *FlagKillSecret)
+	if err != nil {
+		panic(err)
+	}
+	var arm Arm
+	if *FlagArm {
+		var ok bool
+		arm, ok = chassis.(Arm)
+		if !ok {
+			panic(fmt.Errorf("the %s chassis does not support an arm", chassisName))
+		}
+		arm.Joints(ArmHome)
+	}
+	// the flight recorder keeps the commands sent to the chassis
+	flight := NewFlightRecorder(*FlagIncidentWindow, *FlagIncidents)
+	defer flight.Crash()
+	chassis = &FlightChassis{Chassis: chassis, Recorder: flight}
+	stop := chassis.Stop
+	flight.Stop = stop
+	motion := NewMotionWatchdog(*FlagMotionWatchdog, stop)
+	go motion.Run()
+	estop := NewEStop(stop, *FlagKillSecret)
+	estop.Notify = func(reason string) {
+		flight.Dump("estop", reason)
+	}
+	battery := NewBattery(*FlagBatterySlow, *FlagBatteryFlash, *FlagBatteryMin)
+	mux := http.NewServeMux()
+	mux.Handle("/estop", estop)
+	if *FlagKillSecret != "" || *FlagKillUDP != "" {
+		kill := NewKill(estop, *FlagKillSecret)
+		mux.Handle("/kill", kill)
+		if *FlagKillUDP != "" {
+			go func() {
+				err := kill.Listen(*FlagKillUDP)
+				if err != nil {
+					panic(err)
+				}
+			}()
+		}
+	}
+	mux.Handle("/telemetry", telemetry)
+	mux.Handle("/outputs", outputs)
 
-	var running bool
-
-	c := make(chan os.Signal, 1)
+	// the context is canceled to shut down, a second signal exits at once
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// closers are closed on exit so the recordings are complete
+	closers := make(chan io.Closer, 8)
+	c := make(chan os.Signal, 2)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
-		err := port.Close()
+		fmt.Println("shutting down")
+		cancel()
+		<-c
+		stop()
+		os.Exit(1)
+	}()
+
+	shaper, err := NewShaper(*FlagRewardWeights)
+	if err != nil {
+		panic(err)
+	}
+	rewards := &Rewards{}
+	mask := &ActionMask{}
+	var distance *DistanceSensor
+	if *FlagDistance != "" {
+		distance = NewDistanceSensor(telemetry, *FlagDistance, *FlagDistanceMax)
+	}
+	var gps *GPS
+	if *FlagGPS != "" {
+		gps = NewGPS(telemetry)
+		gpsPort, err := serial.Open(*FlagGPS, &serial.Mode{BaudRate: *FlagGPSBaud})
 		if err != nil {
 			panic(err)
 		}
-		running = false
-		os.Exit(1)
-	}()
+		go func() {
+			err := gps.Read(gpsPort)
+			if err != nil {
+				fmt.Println(err)
+			}
+		}()
+	}
+	var lidar *Lidar
+	if *FlagLidar != "" {
+		lidar = NewLidar(telemetry)
+		lidarPort, err := serial.Open(*FlagLidar, &serial.Mode{BaudRate: 115200})
+		if err != nil {
+			panic(err)
+		}
+		// the motor of the rplidar a1 runs when dtr is low
+		err = lidarPort.SetDTR(false)
+		if err != nil {
+			panic(err)
+		}
+		go func() {
+			err := lidar.Start(lidarPort)
+			if err != nil {
+				fmt.Println(err)
+			}
+		}()
+	}
+	var imu *IMU
+	if *FlagIMU {
+		imu = NewIMU(telemetry, *FlagIMUBump, *FlagIMUTilt)
+	}
 
+	// state guards the action of the mind, the mode, the speed and the manual
+	// commands, they are shared by the mind, the control loop, the event loop
+	// and the remote
+	var state sync.Mutex
 	a := ActionNone
-	camera := NewV4LCamera()
-	go camera.Start("/dev/video0")
+	statuses := make(chan CameraStatus, 8)
+	template := CameraConfig{
+		Source:   "front",
+		Device:   *FlagVideoDevice,
+		Width:    *FlagVideoWidth,
+		Height:   *FlagVideoHeight,
+		FPS:      *FlagVideoFPS,
+		MJPEG:    *FlagMJPEG,
+		H264:     *FlagH264,
+		Hardware: *FlagHardwareDecode,
+		// the jpeg sensor only needs the encoded frames
+		Decode: *FlagSensor != "jsensor",
+		Status: statuses,
+		Controls: CameraControls{
+			Exposure:     int32(*FlagExposure),
+			Gain:         int32(*FlagGain),
+			WhiteBalance: int32(*FlagWhiteBalance),
+			Auto:         *FlagAutoExposure,
+		},
+	}
+	configs := []CameraConfig{template}
+	if replay {
+		configs, err = ReplayCameras(*FlagReplay)
+		if err != nil {
+			panic(err)
+		}
+	} else if *FlagCameras != "" {
+		configs, err = ParseCameras(*FlagCameras, template)
+		if err != nil {
+			panic(err)
+		}
+		if len(configs) == 0 {
+			panic(fmt.Errorf("no cameras in %s", *FlagCameras))
+		}
+	}
+	var cameras []Camera
+	var sources []string
+	for _, config := range configs {
+		camera, err := NewCamera(backend, config)
+		if err != nil {
+			panic(err)
+		}
+		go camera.Start()
+		cameras = append(cameras, camera)
+		sources = append(sources, config.Source)
+	}
+	rig := NewRig(sources)
+	cliff := NewCliff(telemetry, *FlagCliff, *FlagCliffMax, sources[0], *FlagCliffBrightness)
+	rollover := NewRollover(*FlagRollover, flight)
+	stuck := NewStuck(*FlagStuck, sources[0], *FlagStuckFlow)
+	snapshots := NewSnapshots(*FlagSnapshots)
+	var preview *Preview
+	if *FlagPreview {
+		preview = NewPreview()
+	}
+	if *FlagFrameStats > 0 {
+		go func() {
+			ticker := time.NewTicker(*FlagFrameStats)
+			defer ticker.Stop()
+			for range ticker.C {
+				for i, camera := range cameras {
+					fmt.Println(sources[i], camera.Health())
+				}
+			}
+		}()
+	}
 	go func() {
-		rng := rand.New(rand.NewSource(1))
-		//mind := NewKMind(rng)
-		mind := NewMarkovMind(rng, int(ActionCount))
-		sensor := KSensor{}
-		for img := range camera.Images {
-			entropy := sensor.Sense(nil, img.Gray)
-			entropy *= 16
-			action := mind.Step(rng, entropy)
-			a = TypeAction(action)
+		// the robot stops while a camera is disconnected, the drive loop
+		// checks the rig
+		for status := range statuses {
+			rig.SetStatus(status)
+			if !status.Connected {
+				fmt.Println(status.Source, "disconnected", status.Err)
+			}
 		}
 	}()
+	var depth *DepthCamera
+	if *FlagDepth != "" {
+		depth = NewDepthCamera()
+		go depth.Start(*FlagDepth)
+	}
+	odometry := NewOdometry(*FlagTrackWidth)
+	if *FlagGeofence != "" {
+		if config.Fence.Radius > 0 || len(config.Fence.Polygon) >= 3 {
+			panic("the geofence flag and the fence of the config can't both be set")
+		}
+		config.Fence, err = ParseGeofence(*FlagGeofence)
+		if err != nil {
+			panic(err)
+		}
+	}
+	fence := NewFence(config.Fence, odometry.Kinematics, odometry, gps)
+	governor := &Governor{
+		Distance: distance,
+		Lidar:    lidar,
+		Depth:    depth,
+		Near:     *FlagGovernorNear,
+		Far:      *FlagGovernorFar,
+		Min:      *FlagGovernorMin,
+		Curve:    *FlagGovernorCurve,
+	}
+	var thermal *ThermalCamera
+	if *FlagThermal != "" {
+		thermal = NewThermalCamera()
+		go thermal.Start(*FlagThermal)
+	}
+	// a replay is deterministic and prints its statistics once the frames
+	// run out
+	var stats *ReplayStats
+	if replay {
+		stats = NewReplayStats()
+	}
+	deterministic := *FlagDeterministic || replay
+	// thinking is closed once the mind has stopped and its recordings are
+	// flushed
+	thinking := make(chan struct{})
+	go func() {
+		defer close(thinking)
+		defer flight.Crash()
+		rng := rand.New(rand.NewSource(*FlagSeed))
+		mind, err := NewMind(*FlagMind, rng, int(ActionCount))
+		if err != nil {
+			panic(err)
+		}
+		if *FlagLoad != "" {
+			err := LoadMind(mind, *FlagLoad)
+			if err != nil {
+				panic(err)
+			}
+		}
+		var checkpointer *Checkpointer
+		if *FlagCheckpointDir != "" {
+			checkpointer = NewCheckpointer(*FlagCheckpointDir, *FlagMind, *FlagCheckpointEvery, *FlagCheckpointKeep)
+			// the state of the mind is saved on shutdown
+			defer func() {
+				err := checkpointer.Save(mind)
+				if err != nil {
+					fmt.Println(err)
+				}
+			}()
+		}
+		var stepLog *os.File
+		if *FlagStepLog != "" {
+			stepLog, err = os.Create(*FlagStepLog)
+			if err != nil {
+				panic(err)
+			}
+			defer stepLog.Close()
+		}
+		var comparison *Comparison
+		if *FlagShadow != "" {
+			comparison, err = NewComparison(*FlagShadow, *FlagSeed+1, *FlagShadowLog)
+			if err != nil {
+				panic(err)
+			}
+			defer comparison.Close()
+		}
+		var recorder *Recorder
+		if *FlagRecord != "" {
+			recorder, err = NewRecorder(*FlagRecord, *FlagRecordFormat)
+			if err != nil {
+				panic(err)
+			}
+			defer recorder.Close()
+		}
+		var video *VideoRecorder
+		if *FlagVideo != "" {
+			video, err = NewVideoRecorder(*FlagVideo, *FlagVideoEncoder, *FlagVideoFPS)
+			if err != nil {
+				panic(err)
+			}
+			closers <- video
+		}
+		calibration := NewCalibration(*FlagCalibration)
+		habituation := NewHabituation(*FlagHabituation)
+		step := func(observation []float64) {
+			if !rig.Connected() {
+				state.Lock()
+				a = ActionNone
+				state.Unlock()
+				return
+			}
+			blocked := false
+			if distance != nil {
+				d, ok := distance.Distance()
+				blocked = !ok || d < *FlagDistanceStop
+			}
+			if imu != nil {
+				if imu.Bumped() {
+					rewards.Add(RewardBump, 1)
+					flight.Dump("collision", "imu bump")
+				}
+				blocked = blocked || imu.Tilted()
+			}
+			if depth != nil {
+				nearest, ok := depth.Nearest()
+				blocked = blocked || !ok || nearest/10 < *FlagDistanceStop
+			}
+			// an empty battery stops the robot from driving, a blocked
+			// robot can't drive forward and near the fence the robot can't
+			// drive toward the boundary
+			level := battery.Get()
+			low := level == BatteryEmpty
+			// the battery reward penalizes each step on a depleted battery
+			rewards.Add(RewardBattery, -float64(level)/float64(BatteryEmpty))
+			var pose Pose
+			fenced := false
+			if fence != nil {
+				pose, fenced = fence.Check(telemetry)
+				// without a gps fix the fence can't be seen, so the robot
+				// does not drive forward
+				blocked = blocked || !fenced
+			}
+			for action, effect := range effects {
+				if motion := effect.Motion; motion != nil {
+					outward := fenced && fence.Outward(pose, motion.Left*RoverSpeedMax, motion.Right*RoverSpeedMax)
+					mask.Set(action, (low && motion.Moves()) || (blocked && motion.Forward()) || outward)
+				}
+				// the gripper actions are masked without an arm
+				if effect.Grip != "" && arm == nil {
+					mask.Set(action, true)
+				}
+			}
+			r, m := shaper.Shape(rewards.Take()), mask.Get()
+			novelty := habituation.Adapt(calibration.Normalize(observation))
+			action := mind.Step(rng, novelty, r, m)
+			act := TypeAction(action)
+			state.Lock()
+			a = act
+			state.Unlock()
+			stats.Add(observation, action)
+			flight.Step(observation, act.String())
+			frames := rig.Frame()
+			if stepLog != nil {
+				err := WriteObservation(stepLog, observation, action, frames...)
+				if err != nil {
+					fmt.Println(err)
+				}
+			}
+			if len(frames) > 0 {
+				preview.Set(frames[0].Frame, Scalar(observation), act)
+				err := video.Write(frames[0].Frame, Scalar(observation), act)
+				if err != nil {
+					fmt.Println(err)
+				}
+			}
+			err := recorder.Record(frames, observation, action)
+			if err != nil {
+				fmt.Println(err)
+			}
+			err = comparison.Step(mind, action, novelty, r, m)
+			if err != nil {
+				fmt.Println(err)
+			}
+			err = checkpointer.Step(mind)
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+		// sensing creates the sensor pipeline of a camera that updates the
+		// rig, each camera has its own
+		sensing := func() func(img *Frame) {
+			sensor, err := NewSensor(*FlagSensor, noise())
+			if err != nil {
+				panic(err)
+			}
+			stages := preprocessing()
+			return func(img *Frame) {
+				observation := sensor.Sense(stages.Apply(img))
+				for i := range observation {
+					observation[i] *= 16
+				}
+				rig.Set(img, observation)
+				cliff.Observe(img)
+				stuck.Observe(img)
+				flight.Frame(img)
+			}
+		}
+		// next returns the next frame of a camera, ok is false once the
+		// robot stops or the replay camera closes its frames at the end
+		next := func(camera Camera) (img Frame, ok bool) {
+			select {
+			case <-ctx.Done():
+				return img, false
+			case img, ok = <-camera.Frames():
+				return img, ok
+			}
+		}
+		pipeline := func(camera Camera, each func()) {
+			sense := sensing()
+			for {
+				img, ok := next(camera)
+				if !ok {
+					return
+				}
+				sense(&img)
+				if each != nil {
+					each()
+				}
+			}
+		}
+		// observe fuses the camera observations with the other sensors
+		observe := func() []float64 {
+			observation := rig.Observation()
+			if distance != nil {
+				observation = append(observation, distance.Sense())
+			}
+			if imu != nil {
+				observation = append(observation, imu.Sense()...)
+			}
+			if *FlagWheels {
+				observation = append(observation, telemetry.State().Wheels()...)
+			}
+			if gps != nil {
+				observation = append(observation, gps.Sense()...)
+			}
+			if lidar != nil {
+				observation = append(observation, lidar.Sense()...)
+			}
+			if depth != nil {
+				observation = append(observation, depth.Sense()...)
+			}
+			if thermal != nil {
+				observation = append(observation, thermal.Sense()...)
+			}
+			return observation
+		}
+		for _, camera := range cameras[1:] {
+			go pipeline(camera, nil)
+		}
+		if !deterministic {
+			// the mind steps on each frame of the first camera
+			pipeline(cameras[0], func() {
+				step(observe())
+			})
+			return
+		}
+
+		// in deterministic mode the cameras are sensed in lockstep and the
+		// mind steps once for each frame sequence number, so the same seed
+		// and frames give the same actions whatever the timing
+		senses := make([]func(img *Frame), len(cameras))
+		for i := range cameras {
+			senses[i] = sensing()
+		}
+		for sequence := uint64(1); ; sequence++ {
+			for i, camera := range cameras {
+				img, ok := next(camera)
+				// a live camera that dropped frames catches up
+				for ok && img.Sequence < sequence {
+					img, ok = next(camera)
+				}
+				if !ok {
+					return
+				}
+				senses[i](&img)
+			}
+			step(observe())
+		}
+	}()
+	if replay {
+		// the replay shuts down once the mind has stepped on every frame
+		go func() {
+			<-thinking
+			cancel()
+		}()
+	}
 
 	var event sdl.Event
-	sdl.Init(sdl.INIT_JOYSTICK)
+	if preview != nil {
+		sdl.Init(sdl.INIT_GAMECONTROLLER | sdl.INIT_VIDEO)
+		err := preview.Open()
+		if err != nil {
+			panic(err)
+		}
+		defer preview.Destroy()
+	} else {
+		sdl.Init(sdl.INIT_GAMECONTROLLER)
+	}
 	defer sdl.Quit()
-	sdl.JoystickEventState(sdl.ENABLE)
-	running = true
-	var axis [5]int16
-	joystickLeft := JoystickStateNone
-	joystickRight := JoystickStateNone
-	lightState := LightStateOff
+	sdl.GameControllerEventState(sdl.ENABLE)
+	controllers := NewControllers(*FlagRumble)
+	var axis [sdl.CONTROLLER_AXIS_MAX]int16
+	// buttons are the game controller buttons held down
+	buttons := NewButtons()
+	driveMode, err := ParseDriveMode(config.Drive)
+	if err != nil {
+		panic(err)
+	}
+	executor := NewExecutor(effects)
+	headlights := NewHeadlights(chassis, telemetry, *FlagBrightness)
 	speed := 0.1
+	// manualLeft and manualRight are the proportional commands of the sticks
+	manualLeft, manualRight := 0.0, 0.0
+	axes, err := NewAxisMaps(*FlagDeadzone, *FlagAxisExpo, config.Axes)
+	if err != nil {
+		panic(err)
+	}
 	var mode Mode
-
-	go func() {
-		message := map[string]interface{}{
-			"T":      900,
-			"main":   2,
-			"module": 0,
+	if replay {
+		mode = ModeAuto
+	}
+	// rumbled is the mode the controllers last rumbled for
+	rumbled := mode
+	trail := NewTrail(*FlagTrailSpacing, odometry.Get())
+	// the robot returns home without the http api
+	homing := NewNavigator(odometry.Kinematics, *FlagWaypointTolerance, "")
+	// home returns the robot to where it started, the state is locked
+	home := func(reason string) {
+		if mode == ModeReturn {
+			return
 		}
-		data, err := json.Marshal(message)
-		if err != nil {
-			panic(err)
+		fmt.Println("returning to the start:", reason)
+		homing.Clear()
+		for _, waypoint := range trail.Return(!*FlagReturnStraight) {
+			homing.Add(waypoint)
 		}
-		data = append(data, '\n')
-		_, err = port.Write(data)
-		if err != nil {
-			panic(err)
+		mode = ModeReturn
+	}
+	navigator := NewNavigator(odometry.Kinematics, *FlagWaypointTolerance, *FlagKillSecret)
+	mux.Handle("/waypoints", navigator)
+	mux.Handle("/waypoints/skip", navigator)
+	remote := NewRemote(*FlagKillSecret, func() RemoteStatus {
+		state.Lock()
+		current := mode
+		state.Unlock()
+		return RemoteStatus{
+			Mode:   current.String(),
+			EStop:  estop.Get(),
+			Values: telemetry.Copy(),
 		}
+	}, rig.Frame)
+	mux.Handle("/remote", remote)
+	mux.Handle("/remote/", remote)
+	speedControl := NewSpeedControl(config.Speed)
+
+	// driving is closed once the control loop has stopped the motors
+	driving := make(chan struct{})
+	go func() {
+		defer close(driving)
+		defer flight.Crash()
+		// the motors are stopped however the control loop ends
+		defer stop()
 		leftSpeed, rightSpeed := 0.0, 0.0
-		for running {
-			time.Sleep(300 * time.Millisecond)
-			if mode == ModeAuto {
-				switch a {
-				case ActionForward:
-					joystickLeft = JoystickStateUp
-					joystickRight = JoystickStateUp
-				case ActionBackward:
-					joystickLeft = JoystickStateDown
-					joystickRight = JoystickStateDown
-				case ActionLeft:
-					joystickLeft = JoystickStateDown
-					joystickRight = JoystickStateUp
-				case ActionRight:
-					joystickLeft = JoystickStateUp
-					joystickRight = JoystickStateDown
-				case ActionLight:
-					pwm := 0
-					if lightState == LightStateOn {
-						pwm, lightState = 0, LightStateOff
-					} else if lightState == LightStateOff {
-						pwm, lightState = 128, LightStateOn
+		ramp := NewRamp(*FlagAccel, *FlagDecel, *FlagSpeedExpo)
+		flash, flashed := false, time.Time{}
+		obstructed, drained := false, BatteryNormal
+		// the mind's decisions are executed at their own rate so the driving
+		// stays responsive while the mind runs slower
+		control := time.NewTicker(Period(*FlagControlHz))
+		defer control.Stop()
+		decision := time.NewTicker(Period(*FlagDecisionHz))
+		defer decision.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-decision.C:
+				// the mind does not drive the actuators while the emergency
+				// stop is engaged
+				state.Lock()
+				current, action := mode, a
+				state.Unlock()
+				if current != ModeAuto || estop.Get() {
+					continue
+				}
+				if !rig.Connected() {
+					action = ActionNone
+				}
+				// an action that is cooling down has no effect
+				effect, ok := executor.Execute(action, time.Now())
+				if !ok {
+					continue
+				}
+				switch effect.Light {
+				case LightToggle:
+					headlights.Toggle()
+				case LightOn:
+					headlights.Set(true)
+				case LightOff:
+					headlights.Set(false)
+				}
+				if effect.Brightness != 0 {
+					headlights.Adjust(effect.Brightness)
+				}
+				if g := effect.Gimbal; g != nil {
+					chassis.Gimbal(g.X, g.Y)
+				}
+				for name, value := range effect.Outputs {
+					err := outputs.Set(name, value)
+					if err != nil {
+						fmt.Println(err)
 					}
-					message := map[string]interface{}{
-						"T":   132,
-						"IO4": pwm,
-						"IO5": pwm,
+				}
+				if effect.Grip != "" && arm != nil {
+					angle := GripOpen
+					if effect.Grip == GripCloseName {
+						angle = GripClosed
 					}
-					data, err := json.Marshal(message)
+					arm.Grip(angle)
+				}
+				if effect.Snapshot {
+					err := snapshots.Take(rig.Frame(), "mind")
 					if err != nil {
-						panic(err)
+						fmt.Println(err)
 					}
-					data = append(data, '\n')
-					_, err = port.Write(data)
-					if err != nil {
-						panic(err)
+				}
+				continue
+			case <-control.C:
+			}
+			state.Lock()
+			motion.Beat()
+			flight.Sample(telemetry)
+
+			level := battery.Update(telemetry.State())
+			if level >= BatteryFlash && (mode == ModeAuto || mode == ModeNavigate) {
+				home("low battery")
+			}
+			if voltage := battery.Mean(); voltage > 0 {
+				telemetry.Set("battery", voltage)
+			}
+			if level >= BatteryFlash && time.Since(flashed) >= BatteryFlashPeriod {
+				flash, flashed = !flash, time.Now()
+				pwm := 0
+				if flash {
+					pwm = 255
+				}
+				chassis.Lights(pwm)
+			} else if level < BatteryFlash && flash {
+				// the lights are restored once the battery recovers
+				flash = false
+				headlights.Restore()
+			}
+
+			outputs.Events(map[string]bool{
+				EventEStop:    estop.Get(),
+				EventBattery:  level >= BatteryFlash,
+				EventLinkDown: !telemetry.LinkUp(),
+			})
+
+			// a rollover cuts the motors and hands control back to the
+			// joystick so the mind does not keep climbing
+			rolled := rollover.Check(telemetry.State())
+			if rolled && mode != ModeManual {
+				mode = ModeManual
+				executor.Stop()
+			}
+
+			if estop.Get() || level == BatteryEmpty || rolled {
+				leftSpeed, rightSpeed = 0, 0
+				ramp.Left, ramp.Right = 0, 0
+			} else if mode == ModeReturn && (manualLeft != 0 || manualRight != 0) {
+				// the sticks take over from the return at any time
+				fmt.Println("return overridden by the joystick")
+				mode = ModeManual
+				leftSpeed, rightSpeed = manualLeft*speed, manualRight*speed
+			} else if mode == ModeReturn {
+				var ok bool
+				leftSpeed, rightSpeed, ok = homing.Drive(odometry.Get(), speed)
+				if !ok {
+					fmt.Println("returned to the start")
+					trail.Arrived()
+					mode = ModeManual
+				}
+			} else if mode == ModeNavigate {
+				var ok bool
+				leftSpeed, rightSpeed, ok = navigator.Drive(odometry.Get(), speed)
+				if !ok {
+					fmt.Println("navigation: no waypoints left")
+					mode = ModeManual
+				}
+			} else if mode == ModeManual {
+				leftSpeed, rightSpeed = manualLeft*speed, manualRight*speed
+			} else if recovery, ok := stuck.Recover(time.Now()); ok {
+				leftSpeed, rightSpeed = recovery.Left*speed, recovery.Right*speed
+			} else {
+				left, right := executor.Speeds(time.Now())
+				leftSpeed, rightSpeed = left*speed, right*speed
+				if stuck.Check(leftSpeed, rightSpeed, telemetry.State(), time.Now()) {
+					telemetry.Set("stuck", float64(stuck.Count))
+				}
+				// a motion started before the robot got near the fence is
+				// cut short
+				if fence != nil {
+					if pose, ok := fence.Locate(); ok && fence.Outward(pose, leftSpeed, rightSpeed) {
+						leftSpeed, rightSpeed = 0, 0
 					}
-				case ActionNone:
-					joystickLeft = JoystickStateNone
-					joystickRight = JoystickStateNone
 				}
 			}
 
-			switch joystickLeft {
-			case JoystickStateUp:
-				leftSpeed = speed
-			case JoystickStateDown:
-				leftSpeed = -speed
-			case JoystickStateNone:
-				leftSpeed = 0.0
+			// the cliff reflex overrides any forward motion whoever is driving
+			edge := leftSpeed+rightSpeed > 0 && cliff.Edge()
+			if edge {
+				leftSpeed, rightSpeed = 0, 0
+				ramp.Left, ramp.Right = 0, 0
+			}
+
+			// the governor slows down near obstacles whoever is driving
+			var scale float64
+			leftSpeed, rightSpeed, scale = governor.Limit(leftSpeed, rightSpeed)
+			telemetry.Set("governor", scale)
+
+			// the controllers rumble when an obstacle is first met and when
+			// the battery level drops
+			if obstacle := edge || scale < 1; obstacle != obstructed {
+				obstructed = obstacle
+				if obstacle {
+					controllers.Rumble(RumbleObstacle)
+				}
 			}
-			switch joystickRight {
-			case JoystickStateUp:
-				rightSpeed = speed
-			case JoystickStateDown:
-				rightSpeed = -speed
-			case JoystickStateNone:
-				rightSpeed = 0.0
+			if level > drained {
+				controllers.Rumble(RumbleBattery)
 			}
+			drained = level
 
-			message := map[string]interface{}{
-				"T": 1,
-				"L": leftSpeed,
-				"R": rightSpeed,
+			if level >= BatterySlow {
+				leftSpeed *= *FlagBatterySlowScale
+				rightSpeed *= *FlagBatterySlowScale
 			}
-			data, err := json.Marshal(message)
+
+			// the reported wheel speeds are integrated when they are fresh,
+			// otherwise the speeds commanded since the last update are
+			left, right := ramp.Speeds()
+			if state := telemetry.State(); state.Fresh(RoverStale) {
+				left, right = state.Left, state.Right
+			}
+			pose := odometry.Update(left, right)
+			if mode != ModeReturn {
+				trail.Record(pose)
+			}
+			telemetry.Set("odom_x", pose.X)
+			telemetry.Set("odom_y", pose.Y)
+			telemetry.Set("odom_theta", pose.Theta)
+			state.Unlock()
+
+			left, right = ramp.Step(leftSpeed, rightSpeed)
+			left, right = speedControl.Correct(left, right, telemetry.State())
+			chassis.Drive(left, right)
+		}
+	}()
+
+	if *FlagHTTP != "" {
+		go func() {
+			err := http.ListenAndServe(*FlagHTTP, mux)
 			if err != nil {
 				panic(err)
 			}
-			data = append(data, '\n')
-			_, err = port.Write(data)
+		}()
+	}
+
+	// handle handles an input of the operator from the joystick buttons or
+	// the keys, the state is locked
+	handle := func(input Input, source string) {
+		switch input {
+		case InputMode:
+			switch mode {
+			case ModeManual:
+				mode = ModeAuto
+			case ModeAuto, ModeReturn:
+				mode = ModeManual
+				executor.Stop()
+			}
+		case InputSpeed:
+			speed += .1
+			if speed > .3 {
+				speed = 0.1
+			}
+		case InputEStop:
+			estop.Engage(source)
+			mode = ModeManual
+		case InputClear:
+			estop.Clear()
+		case InputHome:
+			home(source)
+		case InputGripOpen:
+			if arm != nil {
+				arm.Grip(GripOpen)
+			}
+		case InputGripClose:
+			if arm != nil {
+				arm.Grip(GripClosed)
+			}
+		case InputArmHome:
+			if arm != nil {
+				arm.Joints(ArmHome)
+			}
+		case InputThumbsUp:
+			rewards.Add(RewardThumbsUp, 1)
+		case InputSnapshot:
+			err := snapshots.Take(rig.Frame(), source)
 			if err != nil {
-				panic(err)
+				fmt.Println(err)
 			}
+		case InputLights:
+			headlights.Toggle()
+		case InputWaypoint:
+			pose := odometry.Get()
+			navigator.Add(Waypoint{X: pose.X, Y: pose.Y})
+		case InputClearWaypoints:
+			navigator.Clear()
+		case InputNavigate:
+			switch mode {
+			case ModeNavigate:
+				mode = ModeManual
+			default:
+				mode = ModeNavigate
+			}
+		case InputSkip:
+			navigator.Skip()
+		case InputDriveMode:
+			driveMode = driveMode.Next()
+			fmt.Println("drive mode", driveMode)
+			controllers.Rumble(RumbleMode)
 		}
-	}()
+	}
+	keyboard := NewKeyboard()
+	bridge := NewBridge(*FlagKillSecret)
+	if *FlagBridgeListen != "" {
+		go func() {
+			err := bridge.Listen(*FlagBridgeListen)
+			if err != nil {
+				panic(err)
+			}
+		}()
+	}
+	if *FlagKeyboardTerminal {
+		go func() {
+			err := keyboard.Terminal()
+			if err != nil {
+				fmt.Println(err)
+			}
+		}()
+		defer keyboard.Close()
+	}
 
-	_, _ = joystickLeft, joystickRight
-	for running {
+	watchdog := NewWatchdog(*FlagWatchdog, sources, cameras)
+	for ctx.Err() == nil {
+		state.Lock()
+		if stalled := watchdog.Check(); len(stalled) > 0 {
+			fmt.Println("watchdog: no frames from", stalled)
+			mode = ModeManual
+			executor.Stop()
+			manualLeft, manualRight = 0, 0
+			a = ActionNone
+		}
 		for event = sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
 			switch t := event.(type) {
 			case *sdl.QuitEvent:
-				running = false
-			case *sdl.JoyAxisEvent:
-				value := int16(t.Value)
-				axis[t.Axis] = value
-				if t.Axis == 3 || t.Axis == 4 {
-					if mode == ModeManual {
-						if axis[3] < 20000 && axis[3] > -20000 {
-							if axis[4] < -32000 {
-								joystickRight = JoystickStateUp
-							} else if axis[4] > 32000 {
-								joystickRight = JoystickStateDown
-							} else {
-								joystickRight = JoystickStateNone
-							}
-						} else {
-							joystickRight = JoystickStateNone
-						}
+				cancel()
+			case *sdl.ControllerAxisEvent:
+				axis[t.Axis] = t.Value
+				// the sticks drive the wheels in proportion to how far they
+				// are pushed as the drive mode mixes them
+				manualLeft, manualRight = driveMode.Mix(axis, &axes)
+				if t.Axis == sdl.CONTROLLER_AXIS_TRIGGERLEFT && !driveMode.Trigger() {
+					// the trigger sets the brightness of the lights once it is
+					// pulled past the deadzone, at rest it leaves them alone
+					if value := axes.Map(axis, sdl.CONTROLLER_AXIS_TRIGGERLEFT); value > 0 {
+						headlights.SetBrightness(int(255 * value))
 					}
-					//fmt.Printf("right [%d ms] Which: %v \t%d %d\n",
-					//              t.Timestamp, t.Which, axis[3], axis[4])
-				} else if t.Axis == 0 || t.Axis == 1 {
-					if mode == ModeManual {
-						if axis[0] < 20000 && axis[0] > -20000 {
-							if axis[1] < -32000 {
-								joystickLeft = JoystickStateUp
-							} else if axis[1] > 32000 {
-								joystickLeft = JoystickStateDown
-							} else {
-								joystickLeft = JoystickStateNone
-							}
-						} else {
-							joystickLeft = JoystickStateNone
-						}
-					}
-					//fmt.Printf("left [%d ms] Which: %v \t%d %d\n",
-					//t.Timestamp, t.Which, axis[0], axis[1])
-				} else if t.Axis == 2 {
-					//fmt.Printf("2 axis [%d ms] Which: %v \t%x\n",
-					//      t.Timestamp, t.Which, value)
-					//speed = axis[2]
-					//pwm = int(100 * (float64(speed) + 32768) / 65535)
-					//fmt.Printf("speed %d pwm %d\n", speed, pwm)
-				}
-			case *sdl.JoyBallEvent:
-				fmt.Printf("[%d ms] Ball:%d\txrel:%d\tyrel:%d\n",
-					t.Timestamp, t.Ball, t.XRel, t.YRel)
-			case *sdl.JoyButtonEvent:
+				}
+			case *sdl.ControllerButtonEvent:
 				fmt.Printf("[%d ms] Button:%d\tstate:%d\n",
 					t.Timestamp, t.Button, t.State)
-				if t.Button == 0 && t.State == 1 {
-					switch mode {
-					case ModeManual:
-						mode = ModeAuto
-					case ModeAuto:
-						mode = ModeManual
-						joystickLeft = JoystickStateNone
-						joystickRight = JoystickStateNone
-					}
-				} else if t.Button == 1 && t.State == 1 {
-					speed += .1
-					if speed > .3 {
-						speed = 0.1
-					}
-				} else if t.Button == 2 && t.State == 1 {
-					pwm := 0
-					if lightState == LightStateOn {
-						pwm, lightState = 0, LightStateOff
-					} else if lightState == LightStateOff {
-						pwm, lightState = 128, LightStateOn
-					}
-					message := map[string]interface{}{
-						"T":   132,
-						"IO4": pwm,
-						"IO5": pwm,
-					}
-					data, err := json.Marshal(message)
-					if err != nil {
-						panic(err)
-					}
-					data = append(data, '\n')
-					_, err = port.Write(data)
-					if err != nil {
-						panic(err)
+				if input, ok := buttons.Input(t.Button, t.State == sdl.PRESSED); ok {
+					handle(input, "joystick")
+				}
+			case *sdl.KeyboardEvent:
+				input, ok := KeyInputs[t.Keysym.Sym]
+				if !ok {
+					break
+				}
+				if input.Held() {
+					if t.State == sdl.PRESSED {
+						keyboard.Press(input)
+					} else {
+						keyboard.Release(input)
 					}
+				} else if t.State == sdl.PRESSED && t.Repeat == 0 {
+					handle(input, "keyboard")
 				}
-			case *sdl.JoyHatEvent:
-				fmt.Printf("[%d ms] Hat:%d\tvalue:%d\n",
-					t.Timestamp, t.Hat, t.Value)
-				if t.Value == 1 {
-					// up
-				} else if t.Value == 4 {
-					// down
-				} else if t.Value == 8 {
-					// left
-				} else if t.Value == 2 {
-					// right
-				}
-			case *sdl.JoyDeviceAddedEvent:
-				fmt.Println(t.Which)
-				joysticks[int(t.Which)] = sdl.JoystickOpen(int(t.Which))
-				if joysticks[int(t.Which)] != nil {
-					fmt.Printf("Joystick %d connected\n", t.Which)
-				}
-			case *sdl.JoyDeviceRemovedEvent:
-				if joystick := joysticks[int(t.Which)]; joystick != nil {
-					joystick.Close()
-				}
-				fmt.Printf("Joystick %d disconnected\n", t.Which)
+			case *sdl.ControllerDeviceEvent:
+				// an added device is a device index and a removed device is
+				// an instance id
+				if t.Type == sdl.CONTROLLERDEVICEADDED {
+					controllers.Open(int(t.Which))
+				} else if t.Type == sdl.CONTROLLERDEVICEREMOVED {
+					controllers.Close(t.Which)
+				}
+			case *sdl.JoyAxisEvent, *sdl.JoyBallEvent, *sdl.JoyButtonEvent, *sdl.JoyHatEvent,
+				*sdl.JoyDeviceAddedEvent, *sdl.JoyDeviceRemovedEvent:
+				// the raw joystick events are handled as game controller
+				// events
 			default:
 				fmt.Printf("Unknown event\n")
 			}
 		}
 
+		for len(keyboard.Inputs) > 0 {
+			handle(<-keyboard.Inputs, "terminal")
+		}
+		// the keyboard drives while its keys are held
+		if left, right, ok := keyboard.Speeds(time.Now()); ok {
+			manualLeft, manualRight = left, right
+		}
+		for len(bridge.Inputs) > 0 {
+			handle(<-bridge.Inputs, "bridge")
+		}
+		// the bridge drives with the sticks of the remote game controller
+		if bridged, ok := bridge.Get(time.Now()); ok {
+			manualLeft, manualRight = driveMode.Mix(bridged, &axes)
+		}
+		for len(remote.Inputs) > 0 {
+			handle(<-remote.Inputs, "remote")
+		}
+		// the remote drives while its virtual joystick is held
+		if left, right, ok := remote.Speeds(time.Now()); ok {
+			manualLeft, manualRight = left, right
+		}
+
+		// the controllers rumble when the mode changes
+		if mode != rumbled {
+			rumbled = mode
+			controllers.Rumble(RumbleMode)
+		}
+		current := mode
+		state.Unlock()
+		controllers.Play()
+
+		err := preview.Render(current)
+		if err != nil {
+			fmt.Println(err)
+		}
 		sdl.Delay(16)
 	}
+
+	// the shutdown stops the motors, turns off the lights, flushes the
+	// recordings and the mind state and then closes the chassis
+	<-driving
+	stop()
+	headlights.Set(false)
+	select {
+	case <-thinking:
+	case <-time.After(ShutdownTimeout):
+		fmt.Println("the mind did not stop in time")
+	}
+	for len(closers) > 0 {
+		err := (<-closers).Close()
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	err = chassis.Close()
+	if err != nil {
+		fmt.Println(err)
+	}
+	if replay {
+		stats.Print(*FlagReplay)
+	}
 }
@@ -5,20 +5,61 @@
 package main
 
 import (
+	"container/list"
+	"encoding/gob"
+	"fmt"
+	"io"
 	"math"
 	"math/rand"
+	"sort"
 )
 
 // Context is a markov context
 type Context [2]byte
 
+// MarkovStats are statistics about the markov table
+type MarkovStats struct {
+	Size      int
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// HitRate is the fraction of lookups that found a context
+func (m MarkovStats) HitRate() float64 {
+	total := m.Hits + m.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(m.Hits) / float64(total)
+}
+
+// String returns a string representation of the markov stats
+func (m MarkovStats) String() string {
+	return fmt.Sprintf("size %d hits %d misses %d evictions %d hit rate %f",
+		m.Size, m.Hits, m.Misses, m.Evictions, m.HitRate())
+}
+
 // MarkovMind is a markov model mind
 type MarkovMind struct {
 	Actions int
 	Acts    []float64
-	Action	int
+	Action  int
 	State   Context
 	Markov  map[Context][]float64
+	// MaxContexts is the maximum number of contexts, 0 is unbounded
+	MaxContexts int
+	// Used is the tick each context was last used, for lru eviction
+	Used       map[Context]uint64
+	Tick       uint64
+	Stats      MarkovStats
+	Normalized []float64
+	Visits     []uint64
+	Schedule   Schedule
+	// order are the contexts from the least to the most recently used, it is
+	// rebuilt from Used when it is nil
+	order    *list.List
+	elements map[Context]*list.Element
 }
 
 // NewMarkovMind creates a new markov model mind
@@ -26,24 +67,91 @@ func NewMarkovMind(rng *rand.Rand, actions int) MarkovMind {
 	return MarkovMind{
 		Actions: actions,
 		Markov:  make(map[Context][]float64),
+		Used:    make(map[Context]uint64),
+		Visits:  make([]uint64, actions),
+	}
+}
+
+// rebuild rebuilds the recency order of the contexts from the used ticks, a
+// context that was never used is the oldest and ties go to the smaller context
+func (m *MarkovMind) rebuild() {
+	contexts := make([]Context, 0, len(m.Markov))
+	for context := range m.Markov {
+		contexts = append(contexts, context)
+	}
+	sort.Slice(contexts, func(i, j int) bool {
+		a, b := contexts[i], contexts[j]
+		if m.Used[a] != m.Used[b] {
+			return m.Used[a] < m.Used[b]
+		}
+		return a[0] < b[0] || (a[0] == b[0] && a[1] < b[1])
+	})
+	m.order, m.elements = list.New(), make(map[Context]*list.Element, len(contexts))
+	for _, context := range contexts {
+		m.elements[context] = m.order.PushBack(context)
+	}
+}
+
+// touch marks a context as the most recently used
+func (m *MarkovMind) touch(context Context) {
+	if m.order == nil {
+		m.rebuild()
+	}
+	m.Tick++
+	m.Used[context] = m.Tick
+	if element, ok := m.elements[context]; ok {
+		m.order.MoveToBack(element)
+		return
+	}
+	m.elements[context] = m.order.PushBack(context)
+}
+
+// evict removes the least recently used contexts until the table fits, the
+// current context is kept
+func (m *MarkovMind) evict() {
+	if m.order == nil {
+		m.rebuild()
+	}
+	for m.MaxContexts > 0 && len(m.Markov) > m.MaxContexts {
+		element := m.order.Front()
+		if element != nil && element.Value.(Context) == m.State {
+			element = element.Next()
+		}
+		if element == nil {
+			break
+		}
+		oldest := m.order.Remove(element).(Context)
+		delete(m.elements, oldest)
+		delete(m.Markov, oldest)
+		delete(m.Used, oldest)
+		m.Stats.Evictions++
 	}
 }
 
 // Step the markov mind
-func (m *MarkovMind) Step(rng *rand.Rand, entropy float64) int {
-	s := byte(math.Round(entropy))
+func (m *MarkovMind) Step(rng *rand.Rand, observation []float64, rewards []float64, mask []bool) int {
+	entropy, s := Scalar(observation), Symbol(observation)
 	acts := m.Acts
+	if reward := Total(rewards); reward != 0 && m.Action < len(acts) {
+		acts[m.Action] = math.Max(acts[m.Action]+reward, 0)
+	}
 	actions, ok := m.Markov[m.State]
-	if !ok {
+	if ok {
+		m.Stats.Hits++
+	} else {
+		m.Stats.Misses++
 		actions = make([]float64, m.Actions)
 		for key := range actions {
 			actions[key] = rng.Float64()
 		}
 	}
-	normalized := softmax(actions, .1)
+	m.Normalized = ApplyMask(softmax(actions, m.Schedule.Temperature(.1, entropy)), mask)
 	sum, selected := 0.0, rng.Float64()*256.0/(float64(s)+1)
 	act := m.Action
-	for i, value := range normalized {
+	if Masked(mask, act) {
+		selected = rng.Float64()
+	}
+	for i, value := range m.Normalized {
 		sum += value
 		if sum > selected {
 			act = i
@@ -66,6 +174,64 @@ func (m *MarkovMind) Step(rng *rand.Rand, entropy float64) int {
 	}
 	m.Acts = actions
 	m.Markov[m.State] = actions
+	m.touch(m.State)
+	m.evict()
+	m.Stats.Size = len(m.Markov)
 	m.State[0], m.State[1] = m.State[1], s
+	m.Visits[act]++
 	return act
 }
+
+// Reset resets the markov mind
+func (m *MarkovMind) Reset() {
+	m.Acts = nil
+	m.Action = 0
+	m.State = Context{}
+	m.Markov = make(map[Context][]float64)
+	m.Used = make(map[Context]uint64)
+	m.order, m.elements = nil, nil
+	m.Tick = 0
+	m.Stats = MarkovStats{}
+	m.Normalized = nil
+	m.Visits = make([]uint64, m.Actions)
+	m.Schedule.Reset()
+}
+
+// Introspect returns a snapshot of the markov mind
+func (m *MarkovMind) Introspect() Introspection {
+	introspection := NewIntrospection(m.Action, m.Normalized, m.Visits, m.Acts)
+	introspection.Details["size"] = float64(m.Stats.Size)
+	introspection.Details["hit rate"] = m.Stats.HitRate()
+	return introspection
+}
+
+// Save saves the markov mind
+func (m *MarkovMind) Save(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(m)
+}
+
+// Load loads the markov mind, the table size and the schedule settings are
+// kept from the flags and the progress of the schedule is loaded
+func (m *MarkovMind) Load(r io.Reader) error {
+	contexts, schedule := m.MaxContexts, m.Schedule
+	*m = MarkovMind{}
+	err := gob.NewDecoder(r).Decode(m)
+	m.MaxContexts = contexts
+	m.Schedule.Kind, m.Schedule.End = schedule.Kind, schedule.End
+	m.Schedule.Steps, m.Schedule.Decay = schedule.Steps, schedule.Decay
+	if m.Markov == nil {
+		m.Markov = make(map[Context][]float64)
+	}
+	// the used ticks are rebuilt from the table so a file without them can
+	// still be evicted
+	used := make(map[Context]uint64, len(m.Markov))
+	for context := range m.Markov {
+		used[context] = m.Used[context]
+	}
+	m.Used = used
+	// a table saved with more contexts is cut down to the size of the flags
+	m.evict()
+	m.Stats.Size = len(m.Markov)
+	m.Visits = visits(m.Visits, m.Actions)
+	return err
+}
@@ -0,0 +1,276 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mind is a mind that maps entropy to actions
+type Mind interface {
+	// Step steps the mind with the sensor observation and the weighted
+	// auxiliary rewards of the last action and returns the selected action,
+	// mask marks the currently illegal actions and may be nil
+	Step(rng *rand.Rand, observation []float64, rewards []float64, mask []bool) int
+	// Reset resets the mind to its initial state
+	Reset()
+	// Save saves the state of the mind
+	Save(w io.Writer) error
+	// Load loads the state of the mind
+	Load(r io.Reader) error
+	// Introspect returns a snapshot of the internal state of the mind
+	Introspect() Introspection
+}
+
+// Introspection is a snapshot of the internal state of a mind that explains
+// why an action was chosen
+type Introspection struct {
+	// Action is the last selected action
+	Action int
+	// Distribution is the action probability distribution of the last step
+	Distribution []float64
+	// Visits are the number of times each action was selected
+	Visits []uint64
+	// Estimates are the internal per action entropy estimates of the mind
+	Estimates []float64
+	// Entropy is the entropy in bits of the action distribution
+	Entropy float64
+	// Details are mind specific internal values
+	Details map[string]float64
+}
+
+// NewIntrospection creates a new introspection and computes the entropy of
+// the action distribution
+func NewIntrospection(action int, distribution []float64, visits []uint64, estimates []float64) Introspection {
+	entropy := 0.0
+	for _, value := range distribution {
+		if value > 0 {
+			entropy -= value * math.Log2(value)
+		}
+	}
+	return Introspection{
+		Action:       action,
+		Distribution: append([]float64(nil), distribution...),
+		Visits:       append([]uint64(nil), visits...),
+		Estimates:    append([]float64(nil), estimates...),
+		Entropy:      entropy,
+		Details:      make(map[string]float64),
+	}
+}
+
+// visits returns a visit count slice of the right length, used after loading
+func visits(counts []uint64, actions int) []uint64 {
+	if len(counts) != actions {
+		return make([]uint64, actions)
+	}
+	return counts
+}
+
+// schedule creates a temperature schedule from the flags
+func schedule() Schedule {
+	return NewSchedule(*FlagTemperatureSchedule, *FlagTemperatureEnd,
+		*FlagTemperatureSteps, *FlagTemperatureDecay)
+}
+
+// Scalar returns the entropy of an observation, the mean of its values
+func Scalar(observation []float64) float64 {
+	if len(observation) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, value := range observation {
+		sum += value
+	}
+	return sum / float64(len(observation))
+}
+
+// Symbol returns the symbol of an observation, a scalar observation is
+// rounded and a vector observation is hashed from its quantized values
+func Symbol(observation []float64) byte {
+	if len(observation) == 1 {
+		return byte(math.Round(observation[0]))
+	}
+	hash := uint32(2166136261)
+	for _, value := range observation {
+		hash ^= uint32(Level(value, 16))
+		hash *= 16777619
+	}
+	return byte(hash ^ hash>>8 ^ hash>>16 ^ hash>>24)
+}
+
+// Quantize returns one of levels states for a scalar observation or the
+// symbol of a vector observation
+func Quantize(observation []float64, levels int) byte {
+	if len(observation) == 1 {
+		return byte(Level(observation[0], levels))
+	}
+	return Symbol(observation)
+}
+
+// Level quantizes an entropy into one of levels levels
+func Level(entropy float64, levels int) int {
+	level := int(math.Round(entropy)) * levels / 256
+	if level < 0 {
+		level = 0
+	} else if level >= levels {
+		level = levels - 1
+	}
+	return level
+}
+
+// Masked returns true if the action is illegal
+func Masked(mask []bool, action int) bool {
+	return action < len(mask) && mask[action]
+}
+
+// ApplyMask zeros the illegal actions of a distribution and renormalizes it,
+// the distribution is returned unchanged if all actions are illegal
+func ApplyMask(normalized []float64, mask []bool) []float64 {
+	if len(mask) == 0 {
+		return normalized
+	}
+	masked, sum := make([]float64, len(normalized)), 0.0
+	for i, value := range normalized {
+		if !Masked(mask, i) {
+			masked[i] = value
+			sum += value
+		}
+	}
+	if sum == 0 {
+		return normalized
+	}
+	for i := range masked {
+		masked[i] /= sum
+	}
+	return masked
+}
+
+// MindFactory creates a new mind with the given number of actions
+type MindFactory func(rng *rand.Rand, actions int) Mind
+
+// Minds is the registry of minds
+var Minds = map[string]MindFactory{
+	"markov": func(rng *rand.Rand, actions int) Mind {
+		mind := NewMarkovMind(rng, actions)
+		mind.MaxContexts = *FlagMarkovContexts
+		mind.Schedule = schedule()
+		return &mind
+	},
+	"kmind": func(rng *rand.Rand, actions int) Mind {
+		mind := NewKMind(rng, actions, *FlagKMindSize, *FlagKMindCompressor)
+		mind.Schedule = schedule()
+		return &mind
+	},
+	"nn": func(rng *rand.Rand, actions int) Mind {
+		mind := NewNNMind(rng, actions)
+		mind.Schedule = schedule()
+		return &mind
+	},
+	"curiosity": func(rng *rand.Rand, actions int) Mind {
+		mind := NewCuriosityMind(rng, actions)
+		mind.Schedule = schedule()
+		return &mind
+	},
+	"ga": func(rng *rand.Rand, actions int) Mind {
+		mind := NewGAMind(rng, actions, *FlagGAWindow)
+		return &mind
+	},
+	"ppm": func(rng *rand.Rand, actions int) Mind {
+		mind := NewPPMMind(rng, actions, *FlagPPMOrder)
+		return &mind
+	},
+	"thompson": func(rng *rand.Rand, actions int) Mind {
+		mind := NewThompsonMind(rng, actions)
+		return &mind
+	},
+	"world": func(rng *rand.Rand, actions int) Mind {
+		mind := NewWorldMind(rng, actions, *FlagWorldDepth)
+		mind.Schedule = schedule()
+		return &mind
+	},
+	"ucb": func(rng *rand.Rand, actions int) Mind {
+		mind := NewUCBMind(rng, actions)
+		return &mind
+	},
+}
+
+// MindNames returns the sorted names of the registered minds
+func MindNames() []string {
+	names := make([]string, 0, len(Minds))
+	for name := range Minds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Children are the names of the minds a composite mind creates from the
+// registry
+var Children = map[string]func() []string{}
+
+// cycle returns an error if a mind creates itself through its children, path
+// are the minds that create it
+func cycle(name string, path []string) error {
+	path = append(path[:len(path):len(path)], name)
+	for _, parent := range path[:len(path)-1] {
+		if parent == name {
+			return fmt.Errorf("the %s mind creates itself: %s", name, strings.Join(path, " -> "))
+		}
+	}
+	children, ok := Children[name]
+	if !ok {
+		return nil
+	}
+	for _, child := range children() {
+		err := cycle(child, path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewMind creates a new mind from the registry, a composite mind that creates
+// itself is an error
+func NewMind(name string, rng *rand.Rand, actions int) (Mind, error) {
+	factory, ok := Minds[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown mind %s, available minds: %v", name, MindNames())
+	}
+	err := cycle(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	return factory(rng, actions), nil
+}
+
+// ActionMask is the set of currently illegal robot actions shared between the
+// control loop and the mind
+type ActionMask struct {
+	sync.Mutex
+	Illegal [ActionCount]bool
+}
+
+// Set sets whether an action is illegal
+func (a *ActionMask) Set(action TypeAction, illegal bool) {
+	a.Lock()
+	defer a.Unlock()
+	a.Illegal[action] = illegal
+}
+
+// Get returns a copy of the mask
+func (a *ActionMask) Get() []bool {
+	a.Lock()
+	defer a.Unlock()
+	mask := make([]bool, ActionCount)
+	copy(mask, a.Illegal[:])
+	return mask
+}
@@ -0,0 +1,236 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Period returns the period of a rate in hertz
+func Period(hz float64) time.Duration {
+	if hz <= 0 {
+		panic(fmt.Errorf("rate %f must be positive", hz))
+	}
+	return time.Duration(float64(time.Second) / hz)
+}
+
+// MotionWatchdog stops the motors when the control loop stops beating
+type MotionWatchdog struct {
+	// Last is when the control loop last beat in unix nanoseconds, it is the
+	// first field so it is 64 bit aligned for the atomic access on 32 bit
+	// platforms
+	Last    int64
+	Timeout time.Duration
+	// Stop stops the motors without going through the control loop
+	Stop func()
+	// Stalled is true while the control loop is stalled
+	Stalled bool
+}
+
+// NewMotionWatchdog creates a new motion watchdog, a timeout of 0 disables
+// the watchdog
+func NewMotionWatchdog(timeout time.Duration, stop func()) *MotionWatchdog {
+	return &MotionWatchdog{
+		Timeout: timeout,
+		Stop:    stop,
+		Last:    time.Now().UnixNano(),
+	}
+}
+
+// Beat records that the control loop is alive
+func (m *MotionWatchdog) Beat() {
+	atomic.StoreInt64(&m.Last, time.Now().UnixNano())
+}
+
+// Check stops the motors once when the control loop has not beaten within the
+// timeout and returns true while it is stalled
+func (m *MotionWatchdog) Check() bool {
+	if m.Timeout <= 0 {
+		return false
+	}
+	last := time.Unix(0, atomic.LoadInt64(&m.Last))
+	if time.Since(last) < m.Timeout {
+		m.Stalled = false
+		return false
+	}
+	if !m.Stalled {
+		m.Stalled = true
+		fmt.Println("motion watchdog: control loop stalled, stopping the motors")
+		m.Stop()
+	}
+	return true
+}
+
+// Run checks the control loop for as long as the process runs
+func (m *MotionWatchdog) Run() {
+	if m.Timeout <= 0 {
+		return
+	}
+	for {
+		time.Sleep(m.Timeout / 4)
+		m.Check()
+	}
+}
+
+// Ramp limits the acceleration and deceleration of the wheels and shapes the
+// wheel speeds with an exponential curve
+type Ramp struct {
+	// Accel is the acceleration in meters per second squared, 0 is instant
+	Accel float64
+	// Decel is the deceleration in meters per second squared, 0 is instant
+	Decel float64
+	// Expo is the exponent of the speed curve, 0 is linear
+	Expo float64
+	// Max is the speed at which the curve meets the linear speed
+	Max float64
+	// Left and Right are the ramped speeds before the curve
+	Left, Right float64
+	Last        time.Time
+}
+
+// NewRamp creates a new ramp
+func NewRamp(accel, decel, expo float64) *Ramp {
+	return &Ramp{
+		Accel: accel,
+		Decel: decel,
+		Expo:  expo,
+		Max:   RoverSpeedMax,
+	}
+}
+
+// ramp moves the current speed toward the target speed by at most the rate
+// for the time
+func ramp(current, target, accel, decel, dt float64) float64 {
+	rate := accel
+	if math.Abs(target) < math.Abs(current) || target*current < 0 {
+		rate = decel
+	}
+	if rate <= 0 {
+		return target
+	}
+	step, diff := rate*dt, target-current
+	if math.Abs(diff) <= step {
+		return target
+	} else if diff > 0 {
+		return current + step
+	}
+	return current - step
+}
+
+// Curve maps a speed onto the exponential speed curve, small speeds are
+// smaller and the maximum speed is unchanged
+func (r *Ramp) Curve(speed float64) float64 {
+	if r.Expo == 0 || r.Max <= 0 {
+		return speed
+	}
+	x := math.Min(math.Abs(speed)/r.Max, 1)
+	return math.Copysign(r.Max*math.Expm1(r.Expo*x)/math.Expm1(r.Expo), speed)
+}
+
+// Step ramps the wheels toward the target speeds for the time since the last
+// step and returns the wheel speeds to command
+func (r *Ramp) Step(left, right float64) (float64, float64) {
+	now := time.Now()
+	dt := 0.0
+	if !r.Last.IsZero() {
+		dt = now.Sub(r.Last).Seconds()
+	}
+	r.Last = now
+	r.Left = ramp(r.Left, left, r.Accel, r.Decel, dt)
+	r.Right = ramp(r.Right, right, r.Accel, r.Decel, dt)
+	return r.Speeds()
+}
+
+// Speeds returns the wheel speeds of the last step
+func (r *Ramp) Speeds() (float64, float64) {
+	return r.Curve(r.Left), r.Curve(r.Right)
+}
+
+// SpeedConfig are the gains of the closed loop speed control of the wheels,
+// all zero gains disable it
+type SpeedConfig struct {
+	KP, KI, KD float64
+	// Limit is the largest correction in meters per second
+	Limit float64
+}
+
+// PID is a pid controller of the speed of a wheel
+type PID struct {
+	SpeedConfig
+	Integral float64
+	Previous float64
+	Last     time.Time
+}
+
+// Reset clears the state of the controller
+func (p *PID) Reset() {
+	p.Integral, p.Previous, p.Last = 0, 0, time.Time{}
+}
+
+// Update returns the target speed corrected by the error between the target
+// and the measured speed
+func (p *PID) Update(target, measured float64) float64 {
+	now := time.Now()
+	if target == 0 || p.Last.IsZero() {
+		// a stop is not corrected so the wheels stop at once
+		p.Reset()
+		if target == 0 {
+			return 0
+		}
+		p.Last = now
+		p.Previous = target - measured
+		return target
+	}
+	dt := now.Sub(p.Last).Seconds()
+	p.Last = now
+	err := target - measured
+	clamp := func(value float64) float64 {
+		if p.Limit > 0 {
+			value = math.Max(-p.Limit, math.Min(value, p.Limit))
+		}
+		return value
+	}
+	p.Integral += err * dt
+	if p.Limit > 0 && p.KI != 0 {
+		// the integral is limited so it does not wind up
+		bound := math.Abs(p.Limit / p.KI)
+		p.Integral = math.Max(-bound, math.Min(p.Integral, bound))
+	}
+	derivative := 0.0
+	if dt > 0 {
+		derivative = (err - p.Previous) / dt
+	}
+	p.Previous = err
+	correction := clamp(p.KP*err + p.KI*p.Integral + p.KD*derivative)
+	return math.Max(-RoverSpeedMax, math.Min(target+correction, RoverSpeedMax))
+}
+
+// SpeedControl holds the commanded speeds of the wheels using the wheel
+// speeds reported by the rover
+type SpeedControl struct {
+	Left, Right PID
+}
+
+// NewSpeedControl creates a new speed control
+func NewSpeedControl(config SpeedConfig) *SpeedControl {
+	return &SpeedControl{
+		Left:  PID{SpeedConfig: config},
+		Right: PID{SpeedConfig: config},
+	}
+}
+
+// Correct corrects the commanded speeds, without fresh feedback or gains the
+// speeds are unchanged
+func (s *SpeedControl) Correct(left, right float64, state RoverState) (float64, float64) {
+	if (s.Left.SpeedConfig == SpeedConfig{}) || !state.Fresh(RoverStale) {
+		s.Left.Reset()
+		s.Right.Reset()
+		return left, right
+	}
+	return s.Left.Update(left, state.Left), s.Right.Update(right, state.Right)
+}
@@ -0,0 +1,138 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sync"
+)
+
+// Waypoint is a position in meters in the frame of the odometry
+type Waypoint struct {
+	X, Y float64
+}
+
+// Navigator drives the robot through a queue of waypoints with a pure pursuit
+// controller
+type Navigator struct {
+	sync.Mutex
+	Kinematics Kinematics
+	Waypoints  []Waypoint
+	// Tolerance is the distance in meters at which a waypoint is reached
+	Tolerance float64
+	// Secret is the shared secret of the kill switch, it is needed to change
+	// the waypoints over http
+	Secret []byte
+}
+
+// NewNavigator creates a new navigator
+func NewNavigator(kinematics Kinematics, tolerance float64, secret string) *Navigator {
+	return &Navigator{
+		Kinematics: kinematics,
+		Tolerance:  tolerance,
+		Secret:     []byte(secret),
+	}
+}
+
+// Add adds a waypoint to the end of the queue
+func (n *Navigator) Add(waypoint Waypoint) {
+	n.Lock()
+	defer n.Unlock()
+	n.Waypoints = append(n.Waypoints, waypoint)
+}
+
+// Skip drops the current waypoint
+func (n *Navigator) Skip() {
+	n.Lock()
+	defer n.Unlock()
+	if len(n.Waypoints) > 0 {
+		n.Waypoints = n.Waypoints[1:]
+	}
+}
+
+// Clear drops all of the waypoints
+func (n *Navigator) Clear() {
+	n.Lock()
+	defer n.Unlock()
+	n.Waypoints = nil
+}
+
+// List returns a copy of the waypoints
+func (n *Navigator) List() []Waypoint {
+	n.Lock()
+	defer n.Unlock()
+	return append([]Waypoint{}, n.Waypoints...)
+}
+
+// Drive returns the wheel speeds that steer the robot at the pose toward the
+// current waypoint at the cruising speed in meters per second, ok is false
+// once there are no waypoints left
+func (n *Navigator) Drive(pose Pose, speed float64) (left, right float64, ok bool) {
+	n.Lock()
+	defer n.Unlock()
+	var dx, dy, distance float64
+	for len(n.Waypoints) > 0 {
+		target := n.Waypoints[0]
+		dx, dy = target.X-pose.X, target.Y-pose.Y
+		distance = math.Hypot(dx, dy)
+		if distance > n.Tolerance {
+			break
+		}
+		n.Waypoints = n.Waypoints[1:]
+	}
+	if len(n.Waypoints) == 0 {
+		return 0, 0, false
+	}
+	// the waypoint in the frame of the robot
+	sin, cos := math.Sincos(pose.Theta)
+	x, y := cos*dx+sin*dy, -sin*dx+cos*dy
+	if x <= 0 {
+		// a waypoint behind the robot is turned to in place
+		turn := math.Copysign(speed, y)
+		return -turn, turn, true
+	}
+	// pure pursuit steers along the arc through the waypoint, the robot slows
+	// down as it arrives
+	curvature := 2 * y / (distance * distance)
+	linear := math.Min(speed, distance)
+	left, right = n.Kinematics.Wheels(linear, linear*curvature)
+	// the wheel speeds are scaled together so the arc is kept
+	if peak := math.Max(math.Abs(left), math.Abs(right)); peak > RoverSpeedMax {
+		left, right = left*RoverSpeedMax/peak, right*RoverSpeedMax/peak
+	}
+	return left, right, true
+}
+
+// ServeHTTP serves the waypoints, a post of a json waypoint adds it, a delete
+// clears the waypoints, a post to the skip path skips the current waypoint
+// and the waypoints are returned as json, the changes need the secret
+func (n *Navigator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && !Authorized(n.Secret, r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/waypoints/skip":
+		n.Skip()
+	case r.Method == http.MethodPost:
+		var waypoint Waypoint
+		err := json.NewDecoder(r.Body).Decode(&waypoint)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		n.Add(waypoint)
+	case r.Method == http.MethodDelete:
+		n.Clear()
+	case r.Method == http.MethodGet:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(n.List())
+}
@@ -0,0 +1,211 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+)
+
+const (
+	// NNWindow is the number of recent entropy values fed to the network
+	NNWindow = 8
+	// NNHidden is the number of hidden neurons
+	NNHidden = 16
+	// NNLearningRate is the learning rate of the network
+	NNLearningRate = .01
+)
+
+// NNMind is a neural network mind trained online to minimize surprise
+type NNMind struct {
+	Seed    int64
+	Actions int
+	// Dimension is the dimension of the observations, the values of vector
+	// observations are fed to the network next to the entropy window
+	Dimension int
+	// W1 are the input to hidden weights with a bias column
+	W1 []float64
+	// W2 are the hidden to output weights with a bias column, the first Actions
+	// outputs are the action logits and the second Actions outputs are the
+	// predicted next entropy for each action
+	W2          []float64
+	Window      []float64
+	Observation []float64
+	Input       []float64
+	Hidden      []float64
+	Output      []float64
+	Normalized  []float64
+	Action      int
+	Baseline    float64
+	Trained     bool
+	Visits      []uint64
+	Schedule    Schedule
+}
+
+// NewNNMind creates a new neural network mind
+func NewNNMind(rng *rand.Rand, actions int) NNMind {
+	n := NNMind{
+		Seed:      rng.Int63(),
+		Actions:   actions,
+		Dimension: 1,
+	}
+	n.Reset()
+	return n
+}
+
+// Reset resets the neural network mind
+func (n *NNMind) Reset() {
+	rng := rand.New(rand.NewSource(n.Seed))
+	extra := 0
+	if n.Dimension > 1 {
+		extra = n.Dimension
+	}
+	inputs, outputs := NNWindow+extra+1, 2*n.Actions
+	n.W1 = make([]float64, NNHidden*inputs)
+	for i := range n.W1 {
+		n.W1[i] = rng.NormFloat64() / math.Sqrt(float64(inputs))
+	}
+	n.W2 = make([]float64, outputs*(NNHidden+1))
+	for i := range n.W2 {
+		n.W2[i] = rng.NormFloat64() / math.Sqrt(float64(NNHidden+1))
+	}
+	n.Window = make([]float64, NNWindow)
+	n.Observation = make([]float64, extra)
+	n.Input = make([]float64, inputs)
+	n.Hidden = make([]float64, NNHidden+1)
+	n.Output = make([]float64, outputs)
+	n.Normalized = nil
+	n.Action = 0
+	n.Baseline = 0
+	n.Trained = false
+	n.Visits = make([]uint64, n.Actions)
+	n.Schedule.Reset()
+}
+
+// forward computes the output of the network for the current window
+func (n *NNMind) forward() {
+	copy(n.Input, n.Window)
+	copy(n.Input[NNWindow:], n.Observation)
+	n.Input[len(n.Input)-1] = 1
+	for i := 0; i < NNHidden; i++ {
+		sum, row := 0.0, n.W1[i*len(n.Input):(i+1)*len(n.Input)]
+		for j, value := range n.Input {
+			sum += row[j] * value
+		}
+		n.Hidden[i] = math.Tanh(sum)
+	}
+	n.Hidden[NNHidden] = 1
+	for i := range n.Output {
+		sum, row := 0.0, n.W2[i*len(n.Hidden):(i+1)*len(n.Hidden)]
+		for j, value := range n.Hidden {
+			sum += row[j] * value
+		}
+		n.Output[i] = sum
+	}
+}
+
+// learn trains the network on the surprise and auxiliary reward of the last
+// action
+func (n *NNMind) learn(entropy, auxiliary float64) {
+	surprise := entropy - n.Output[n.Actions+n.Action]
+	reward := -surprise*surprise + auxiliary
+	advantage := reward - n.Baseline
+	n.Baseline = (n.Baseline + reward) / 2
+
+	deltas := make([]float64, len(n.Output))
+	for i, value := range n.Normalized {
+		target := 0.0
+		if i == n.Action {
+			target = 1
+		}
+		deltas[i] = -advantage * (target - value)
+	}
+	deltas[n.Actions+n.Action] = -surprise
+
+	hidden := make([]float64, NNHidden)
+	for i, delta := range deltas {
+		if delta == 0 {
+			continue
+		}
+		row := n.W2[i*len(n.Hidden) : (i+1)*len(n.Hidden)]
+		for j := 0; j < NNHidden; j++ {
+			hidden[j] += delta * row[j]
+		}
+		for j, value := range n.Hidden {
+			row[j] -= NNLearningRate * delta * value
+		}
+	}
+	for i, delta := range hidden {
+		delta *= 1 - n.Hidden[i]*n.Hidden[i]
+		row := n.W1[i*len(n.Input) : (i+1)*len(n.Input)]
+		for j, value := range n.Input {
+			row[j] -= NNLearningRate * delta * value
+		}
+	}
+}
+
+// Step steps the neural network mind
+func (n *NNMind) Step(rng *rand.Rand, observation []float64, rewards []float64, mask []bool) int {
+	if len(observation) != n.Dimension {
+		// the dimension is set by the first observation, a trained network
+		// can't take another dimension
+		if n.Trained {
+			panic(fmt.Errorf("nnmind: the observation has %d values, the mind was trained with %d", len(observation), n.Dimension))
+		}
+		n.Dimension = len(observation)
+		n.Reset()
+	}
+	entropy := Scalar(observation) / 256
+	if n.Trained {
+		n.learn(entropy, Total(rewards))
+	}
+	copy(n.Window, n.Window[1:])
+	n.Window[NNWindow-1] = entropy
+	for i := range n.Observation {
+		n.Observation[i] = observation[i] / 256
+	}
+	n.forward()
+	n.Normalized = ApplyMask(softmax(n.Output[:n.Actions], n.Schedule.Temperature(1, entropy)), mask)
+	sum, action, selected := 0.0, 0, rng.Float64()
+	for i, value := range n.Normalized {
+		sum += value
+		if sum > selected {
+			action = i
+			break
+		}
+	}
+	n.Action = action
+	n.Trained = true
+	n.Visits[action]++
+	return action
+}
+
+// Introspect returns a snapshot of the neural network mind, the estimates are
+// the predicted next entropy for each action
+func (n *NNMind) Introspect() Introspection {
+	estimates := make([]float64, n.Actions)
+	for i := range estimates {
+		estimates[i] = 256 * n.Output[n.Actions+i]
+	}
+	introspection := NewIntrospection(n.Action, n.Normalized, n.Visits, estimates)
+	introspection.Details["baseline"] = n.Baseline
+	return introspection
+}
+
+// Save saves the neural network mind
+func (n *NNMind) Save(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(n)
+}
+
+// Load loads the neural network mind
+func (n *NNMind) Load(r io.Reader) error {
+	*n = NNMind{}
+	err := gob.NewDecoder(r).Decode(n)
+	n.Visits = visits(n.Visits, n.Actions)
+	return err
+}
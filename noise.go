@@ -0,0 +1,134 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"math/rand"
+)
+
+const (
+	// NoiseNone injects no noise
+	NoiseNone = "none"
+	// NoiseGaussian injects gaussian noise
+	NoiseGaussian = "gaussian"
+	// NoiseUniform injects uniform noise
+	NoiseUniform = "uniform"
+)
+
+// NoiseConfig is the configuration of the noise injected into the frames of a
+// sensor
+type NoiseConfig struct {
+	// Type is none, gaussian, or uniform, empty is none
+	Type string
+	// Sigma is the standard deviation of the noise in gray levels
+	Sigma float64
+	Seed  int64
+}
+
+// Noise injects noise into frames to dither them
+type Noise struct {
+	Config NoiseConfig
+	Rng    *rand.Rand
+}
+
+// NewNoise creates a new noise
+func NewNoise(config NoiseConfig) (*Noise, error) {
+	switch config.Type {
+	case "", NoiseNone, NoiseGaussian, NoiseUniform:
+	default:
+		return nil, fmt.Errorf("unknown noise %s", config.Type)
+	}
+	return &Noise{
+		Config: config,
+		Rng:    rand.New(rand.NewSource(config.Seed)),
+	}, nil
+}
+
+// Enabled returns true if the noise injects anything
+func (n *Noise) Enabled() bool {
+	return n.Config.Type != "" && n.Config.Type != NoiseNone && n.Config.Sigma > 0
+}
+
+// perturb injects noise into the pixels of a plane in place
+func (n *Noise) perturb(pix []byte) {
+	// uniform noise on [-a, a] has a standard deviation of a/sqrt(3)
+	width := math.Sqrt(3) * n.Config.Sigma
+	for i, value := range pix {
+		g := float64(value)
+		switch n.Config.Type {
+		case NoiseGaussian:
+			g += n.Config.Sigma * n.Rng.NormFloat64()
+		case NoiseUniform:
+			g += width * (2*n.Rng.Float64() - 1)
+		}
+		pix[i] = byte(math.Round(math.Max(math.Min(g, 255), 0)))
+	}
+}
+
+// Apply returns a noisy copy of an image
+func (n *Noise) Apply(img *image.Gray) *image.Gray {
+	noisy := image.NewGray(img.Bounds())
+	draw.Draw(noisy, noisy.Bounds(), img, img.Bounds().Min, draw.Src)
+	n.perturb(noisy.Pix)
+	return noisy
+}
+
+// ApplyYCbCr returns a noisy copy of a color image, each plane gets noise
+func (n *Noise) ApplyYCbCr(img *image.YCbCr) *image.YCbCr {
+	noisy := &image.YCbCr{
+		Y:              append([]byte(nil), img.Y...),
+		Cb:             append([]byte(nil), img.Cb...),
+		Cr:             append([]byte(nil), img.Cr...),
+		YStride:        img.YStride,
+		CStride:        img.CStride,
+		SubsampleRatio: img.SubsampleRatio,
+		Rect:           img.Rect,
+	}
+	n.perturb(noisy.Y)
+	n.perturb(noisy.Cb)
+	n.perturb(noisy.Cr)
+	return noisy
+}
+
+// ImageSensor is a sensor that reads another image of the frame than the gray
+// thumbnail
+type ImageSensor interface {
+	// Image returns the image of the frame that is sensed: gray, thumb, or
+	// full
+	Image() string
+}
+
+// NoisySensor injects noise into the image of each frame the sensor reads
+// before sensing it, the gray thumbnail unless the sensor is an image sensor
+type NoisySensor struct {
+	Sensor Sensor
+	Noise  *Noise
+}
+
+// Sense senses a noisy frame
+func (n *NoisySensor) Sense(frame *Frame) []float64 {
+	noisy, input := *frame, InputGray
+	if sensor, ok := n.Sensor.(ImageSensor); ok {
+		input = sensor.Image()
+	}
+	// a missing image is sensed as the gray thumbnail
+	switch {
+	case input == InputThumb && frame.Thumb != nil:
+		noisy.Thumb = n.Noise.ApplyYCbCr(YCbCr(frame.Thumb))
+	case input == InputFull && frame.Frame != nil:
+		// only the luma plane of the full frame is sensed
+		full := *frame.Frame
+		full.Y = append([]byte(nil), full.Y...)
+		n.Noise.perturb(full.Y)
+		noisy.Frame = &full
+	case frame.Gray != nil:
+		noisy.Gray = n.Noise.Apply(frame.Gray)
+	}
+	return n.Sensor.Sense(&noisy)
+}
@@ -0,0 +1,188 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// EventEStop is active while the emergency stop is engaged
+	EventEStop = "estop"
+	// EventBattery is active while the battery is low enough to flash the
+	// lights
+	EventBattery = "battery"
+	// EventLinkDown is active while the link to the chassis is down
+	EventLinkDown = "link-down"
+)
+
+// OutputConfig is a named output on an io pin of the controller, buzzers,
+// relays or extra leds
+type OutputConfig struct {
+	// Pin is the io pin of the controller, one of the output pins that the
+	// lights don't drive
+	Pin string
+	// On is the pwm of the output when it is on, 0 is 255
+	On int
+	// Events turn the output on while any of them is active
+	Events []string
+}
+
+// Outputs are the named outputs of the robot
+type Outputs struct {
+	sync.Mutex
+	Chassis Chassis
+	Config  map[string]OutputConfig
+	Values  map[string]int
+	// Secret is the shared secret of the kill switch, it is needed to set an
+	// output over http
+	Secret []byte
+}
+
+// ParsePins parses a comma separated list of io pins
+func ParsePins(list string) []string {
+	var pins []string
+	for _, pin := range strings.Split(list, ",") {
+		if pin = strings.TrimSpace(pin); pin != "" {
+			pins = append(pins, pin)
+		}
+	}
+	return pins
+}
+
+// NewOutputs creates the named outputs on the output pins, the pins of the
+// lights can't be used
+func NewOutputs(chassis Chassis, config map[string]OutputConfig, pins, lights []string, secret string) (*Outputs, error) {
+	contains := func(pins []string, pin string) bool {
+		for _, value := range pins {
+			if value == pin {
+				return true
+			}
+		}
+		return false
+	}
+	for name, output := range config {
+		if output.Pin == "" {
+			return nil, fmt.Errorf("output %s has no pin", name)
+		}
+		if contains(lights, output.Pin) {
+			return nil, fmt.Errorf("output %s is on pin %s of the lights", name, output.Pin)
+		}
+		if !contains(pins, output.Pin) {
+			return nil, fmt.Errorf("output %s is on pin %s, the output pins are %v", name, output.Pin, pins)
+		}
+		for _, event := range output.Events {
+			switch event {
+			case EventEStop, EventBattery, EventLinkDown:
+			default:
+				return nil, fmt.Errorf("unknown event %s for output %s", event, name)
+			}
+		}
+		if output.On == 0 {
+			output.On = 255
+			config[name] = output
+		}
+	}
+	outputs := &Outputs{
+		Chassis: chassis,
+		Config:  config,
+		Values:  make(map[string]int),
+		Secret:  []byte(secret),
+	}
+	// the outputs start off
+	for name, output := range config {
+		outputs.Values[name] = 0
+		chassis.Pin(output.Pin, 0)
+	}
+	return outputs, nil
+}
+
+// Set sets the pwm of a named output, 0 is off and 255 is fully on
+func (o *Outputs) Set(name string, value int) error {
+	o.Lock()
+	defer o.Unlock()
+	output, ok := o.Config[name]
+	if !ok {
+		return fmt.Errorf("unknown output %s", name)
+	}
+	value = clampPWM(value)
+	o.Values[name] = value
+	o.Chassis.Pin(output.Pin, value)
+	return nil
+}
+
+// Events turns the outputs bound to events on while the events are active,
+// an output is only written when its state changes
+func (o *Outputs) Events(active map[string]bool) {
+	o.Lock()
+	defer o.Unlock()
+	for name, output := range o.Config {
+		if len(output.Events) == 0 {
+			continue
+		}
+		value := 0
+		for _, event := range output.Events {
+			if active[event] {
+				value = output.On
+			}
+		}
+		if current, ok := o.Values[name]; ok && current == value {
+			continue
+		}
+		o.Values[name] = value
+		o.Chassis.Pin(output.Pin, value)
+	}
+}
+
+// ServeHTTP serves the outputs, a post of a json name and value with the
+// secret sets an output and the outputs are returned as json
+func (o *Outputs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		if !Authorized(o.Secret, r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var request struct {
+			Name  string
+			Value int
+		}
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = o.Set(request.Name, request.Value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	case http.MethodGet:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	type state struct {
+		Name  string
+		Pin   string
+		Value int
+	}
+	o.Lock()
+	states := make([]state, 0, len(o.Config))
+	for name, output := range o.Config {
+		states = append(states, state{Name: name, Pin: output.Pin, Value: o.Values[name]})
+	}
+	o.Unlock()
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Name < states[j].Name
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(states)
+}
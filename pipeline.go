@@ -0,0 +1,214 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"sort"
+)
+
+// StageConfig is the configuration of a preprocessing stage
+type StageConfig struct {
+	// Type is the type of the stage: grayscale, crop, resize, blur, or
+	// equalize
+	Type string
+	// Input is the image of the frame the grayscale stage starts from
+	Input string
+	// ROI is the region of the crop stage, x0,y0,x1,y1
+	ROI string
+	// Size is the size of the resize stage, widthxheight
+	Size string
+	// Radius is the radius of the blur stage
+	Radius int
+}
+
+// Stage is a preprocessing stage
+type Stage interface {
+	// Apply processes the gray image of a frame
+	Apply(frame *Frame, gray *image.Gray) *image.Gray
+}
+
+// StageFactory creates a stage from its configuration
+type StageFactory func(config StageConfig) (Stage, error)
+
+// Stages is the registry of preprocessing stages
+var Stages = map[string]StageFactory{
+	"grayscale": func(config StageConfig) (Stage, error) {
+		switch config.Input {
+		case "", InputGray, InputThumb, InputFull:
+		default:
+			return nil, fmt.Errorf("unknown input %s", config.Input)
+		}
+		return GrayscaleStage{Input: config.Input}, nil
+	},
+	"crop": func(config StageConfig) (Stage, error) {
+		preprocess, err := NewPreprocess(config.ROI, "")
+		return PreprocessStage{Preprocess: preprocess}, err
+	},
+	"resize": func(config StageConfig) (Stage, error) {
+		preprocess, err := NewPreprocess("", config.Size)
+		return PreprocessStage{Preprocess: preprocess}, err
+	},
+	"blur": func(config StageConfig) (Stage, error) {
+		if config.Radius < 1 {
+			return nil, fmt.Errorf("invalid blur radius %d", config.Radius)
+		}
+		return BlurStage{Radius: config.Radius}, nil
+	},
+	"equalize": func(config StageConfig) (Stage, error) {
+		return EqualizeStage{}, nil
+	},
+}
+
+// Pipeline is a chain of preprocessing stages applied to the frames before
+// they are sensed, so the visual front end is configured without code edits
+type Pipeline []Stage
+
+// NewPipeline creates a pipeline from the stage configurations
+func NewPipeline(configs []StageConfig) (Pipeline, error) {
+	pipeline := make(Pipeline, 0, len(configs))
+	for _, config := range configs {
+		factory, ok := Stages[config.Type]
+		if !ok {
+			names := make([]string, 0, len(Stages))
+			for name := range Stages {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown stage %s, available stages: %v", config.Type, names)
+		}
+		stage, err := factory(config)
+		if err != nil {
+			return nil, err
+		}
+		pipeline = append(pipeline, stage)
+	}
+	return pipeline, nil
+}
+
+// preprocessing returns the pipeline of the configuration file
+func preprocessing() Pipeline {
+	config, err := LoadConfig(*FlagConfig)
+	if err != nil {
+		panic(err)
+	}
+	pipeline, err := NewPipeline(config.Pipeline)
+	if err != nil {
+		panic(err)
+	}
+	return pipeline
+}
+
+// Apply returns a copy of a frame with the gray image processed by the
+// stages, an empty pipeline or an encoded frame without a gray image returns
+// the frame
+func (p Pipeline) Apply(frame *Frame) *Frame {
+	if len(p) == 0 || frame.Gray == nil {
+		return frame
+	}
+	processed := *frame
+	gray := frame.Gray
+	for _, stage := range p {
+		gray = stage.Apply(frame, gray)
+	}
+	processed.Gray = gray
+	return &processed
+}
+
+// GrayscaleStage starts from a gray image of an input of the frame
+type GrayscaleStage struct {
+	Input string
+}
+
+// Apply returns the gray image of the input
+func (g GrayscaleStage) Apply(frame *Frame, gray *image.Gray) *image.Gray {
+	return frame.Input(g.Input)
+}
+
+// PreprocessStage crops or resizes the gray image
+type PreprocessStage struct {
+	Preprocess Preprocess
+}
+
+// Apply crops or resizes the gray image
+func (p PreprocessStage) Apply(frame *Frame, gray *image.Gray) *image.Gray {
+	return p.Preprocess.Prepare(gray)
+}
+
+// BlurStage box blurs the gray image
+type BlurStage struct {
+	Radius int
+}
+
+// Apply box blurs the gray image horizontally and then vertically
+func (b BlurStage) Apply(frame *Frame, gray *image.Gray) *image.Gray {
+	bounds := gray.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	blur := func(get func(i, j int) uint8, set func(i, j int, value uint8), n, m int) {
+		for j := 0; j < m; j++ {
+			for i := 0; i < n; i++ {
+				sum, count := 0, 0
+				for k := i - b.Radius; k <= i+b.Radius; k++ {
+					if k >= 0 && k < n {
+						sum += int(get(k, j))
+						count++
+					}
+				}
+				set(i, j, uint8(sum/count))
+			}
+		}
+	}
+	horizontal := image.NewGray(image.Rect(0, 0, width, height))
+	blur(func(i, j int) uint8 {
+		return gray.Pix[gray.PixOffset(bounds.Min.X+i, bounds.Min.Y+j)]
+	}, func(i, j int, value uint8) {
+		horizontal.Pix[horizontal.PixOffset(i, j)] = value
+	}, width, height)
+	blurred := image.NewGray(image.Rect(0, 0, width, height))
+	blur(func(i, j int) uint8 {
+		return horizontal.Pix[horizontal.PixOffset(j, i)]
+	}, func(i, j int, value uint8) {
+		blurred.Pix[blurred.PixOffset(j, i)] = value
+	}, height, width)
+	return blurred
+}
+
+// EqualizeStage equalizes the histogram of the gray image
+type EqualizeStage struct{}
+
+// Apply equalizes the histogram of the gray image
+func (EqualizeStage) Apply(frame *Frame, gray *image.Gray) *image.Gray {
+	bounds := gray.Bounds()
+	var histogram [256]int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			histogram[gray.GrayAt(x, y).Y]++
+		}
+	}
+	var table [256]uint8
+	total, sum, min := bounds.Dx()*bounds.Dy(), 0, 0
+	for _, count := range histogram {
+		if count > 0 {
+			min = count
+			break
+		}
+	}
+	for i, count := range histogram {
+		sum += count
+		if total > min {
+			table[i] = uint8((sum - min) * 255 / (total - min))
+		} else {
+			table[i] = uint8(i)
+		}
+	}
+	equalized := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			equalized.Pix[equalized.PixOffset(x, y)] = table[gray.GrayAt(bounds.Min.X+x, bounds.Min.Y+y).Y]
+		}
+	}
+	return equalized
+}
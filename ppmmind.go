@@ -0,0 +1,146 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/gob"
+	"io"
+	"math"
+	"math/rand"
+)
+
+// PPMMind is a variable order markov mind that blends the predictions of the
+// contexts of order 0 to Order with escape probabilities like ppm compression
+type PPMMind struct {
+	Actions int
+	Order   int
+	// Symbols are the most recent entropy symbols, the last Order symbols
+	// are the context
+	Symbols []byte
+	// Counts are the entropy weighted action counts for each context
+	Counts      map[string][]float64
+	Normalized  []float64
+	Action      int
+	Initialized bool
+	Visits      []uint64
+}
+
+// NewPPMMind creates a new ppm mind
+func NewPPMMind(rng *rand.Rand, actions, order int) PPMMind {
+	p := PPMMind{
+		Actions: actions,
+		Order:   order,
+	}
+	p.Reset()
+	return p
+}
+
+// context returns the context of order k
+func (p *PPMMind) context(k int) string {
+	return string(p.Symbols[len(p.Symbols)-k:])
+}
+
+// Step steps the ppm mind
+func (p *PPMMind) Step(rng *rand.Rand, observation []float64, rewards []float64, mask []bool) int {
+	entropy := Scalar(observation)
+	if p.Initialized {
+		reward := entropy/256 + Total(rewards)
+		for k := 0; k <= p.Order && k <= len(p.Symbols); k++ {
+			key := p.context(k)
+			counts, ok := p.Counts[key]
+			if !ok {
+				counts = make([]float64, p.Actions)
+				p.Counts[key] = counts
+			}
+			counts[p.Action] = math.Max(counts[p.Action]+reward, 0)
+		}
+	}
+	p.Symbols = append(p.Symbols, Symbol(observation))
+	if len(p.Symbols) > p.Order {
+		p.Symbols = p.Symbols[len(p.Symbols)-p.Order:]
+	}
+
+	normalized := make([]float64, p.Actions)
+	for i := range normalized {
+		normalized[i] = 1 / float64(p.Actions)
+	}
+	for k := 0; k <= p.Order && k <= len(p.Symbols); k++ {
+		counts, ok := p.Counts[p.context(k)]
+		if !ok {
+			break
+		}
+		n, d := 0.0, 0.0
+		for _, count := range counts {
+			if count > 0 {
+				n += count
+				d++
+			}
+		}
+		if n == 0 {
+			break
+		}
+		escape := d / (n + d)
+		for i, count := range counts {
+			normalized[i] = count/(n+d) + escape*normalized[i]
+		}
+	}
+	normalized = ApplyMask(normalized, mask)
+	p.Normalized = normalized
+
+	sum, action, selected := 0.0, 0, rng.Float64()
+	for i, value := range normalized {
+		sum += value
+		if sum > selected {
+			action = i
+			break
+		}
+	}
+	p.Action = action
+	p.Initialized = true
+	p.Visits[action]++
+	return action
+}
+
+// Reset resets the ppm mind
+func (p *PPMMind) Reset() {
+	p.Symbols = nil
+	p.Counts = make(map[string][]float64)
+	p.Normalized = nil
+	p.Action = 0
+	p.Initialized = false
+	p.Visits = make([]uint64, p.Actions)
+}
+
+// Introspect returns a snapshot of the ppm mind, the estimates are the entropy
+// weighted action counts of the longest context
+func (p *PPMMind) Introspect() Introspection {
+	var estimates []float64
+	for k := 0; k <= p.Order && k <= len(p.Symbols); k++ {
+		counts, ok := p.Counts[p.context(k)]
+		if !ok {
+			break
+		}
+		estimates = counts
+	}
+	introspection := NewIntrospection(p.Action, p.Normalized, p.Visits, estimates)
+	introspection.Details["contexts"] = float64(len(p.Counts))
+	return introspection
+}
+
+// Save saves the ppm mind
+func (p *PPMMind) Save(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(p)
+}
+
+// Load loads the ppm mind
+func (p *PPMMind) Load(r io.Reader) error {
+	*p = PPMMind{}
+	err := gob.NewDecoder(r).Decode(p)
+	if p.Counts == nil {
+		p.Counts = make(map[string][]float64)
+	}
+	p.Visits = visits(p.Visits, p.Actions)
+	return err
+}
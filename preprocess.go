@@ -0,0 +1,82 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	"github.com/nfnt/resize"
+)
+
+// Preprocess crops and downsamples an image before it is sensed
+type Preprocess struct {
+	// ROI is the region of interest, empty is the whole image
+	ROI image.Rectangle
+	// Width and Height are the downsampled size, 0 is not downsampled
+	Width, Height int
+}
+
+// NewPreprocess creates a new preprocess from a roi of the form x0,y0,x1,y1
+// and a size of the form widthxheight, empty strings disable each step
+func NewPreprocess(roi, size string) (Preprocess, error) {
+	p := Preprocess{}
+	if roi != "" {
+		parts := strings.Split(roi, ",")
+		if len(parts) != 4 {
+			return p, fmt.Errorf("invalid roi %s", roi)
+		}
+		var values [4]int
+		for i, part := range parts {
+			value, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return p, err
+			}
+			values[i] = value
+		}
+		p.ROI = image.Rect(values[0], values[1], values[2], values[3])
+	}
+	if size != "" {
+		parts := strings.Split(size, "x")
+		if len(parts) != 2 {
+			return p, fmt.Errorf("invalid size %s", size)
+		}
+		var err error
+		p.Width, err = strconv.Atoi(parts[0])
+		if err != nil {
+			return p, err
+		}
+		p.Height, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// Prepare crops an image to the roi and downsamples it, the prepared image
+// has its origin at zero
+func (p Preprocess) Prepare(img *image.Gray) *image.Gray {
+	roi := img.Bounds()
+	if !p.ROI.Empty() {
+		if cropped := p.ROI.Intersect(roi); !cropped.Empty() {
+			roi = cropped
+		}
+	}
+	var prepared image.Image = img.SubImage(roi)
+	if p.Width > 0 && p.Height > 0 {
+		prepared = resize.Resize(uint(p.Width), uint(p.Height), prepared, resize.Bilinear)
+	}
+	bounds := prepared.Bounds()
+	if gray, ok := prepared.(*image.Gray); ok && bounds.Min == (image.Point{}) {
+		return gray
+	}
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(gray, gray.Bounds(), prepared, bounds.Min, draw.Src)
+	return gray
+}
@@ -0,0 +1,171 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"sync"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+const (
+	// PreviewWidth is the initial width of the preview window
+	PreviewWidth = 640
+	// PreviewHeight is the initial height of the preview window
+	PreviewHeight = 480
+	// PreviewBar is the height of the entropy bar
+	PreviewBar = 8
+)
+
+// Preview is an sdl window that renders the live camera frame with a heads
+// up display of the entropy, the selected action and the mode, the state is
+// set from the mind and rendered on the sdl thread
+type Preview struct {
+	sync.Mutex
+	Window   *sdl.Window
+	Renderer *sdl.Renderer
+	Texture  *sdl.Texture
+	// Bounds are the bounds of the texture
+	Bounds  image.Rectangle
+	Frame   *image.YCbCr
+	Entropy float64
+	Action  TypeAction
+}
+
+// NewPreview creates a new preview, the window is opened by Open
+func NewPreview() *Preview {
+	return &Preview{
+		Action: ActionNone,
+	}
+}
+
+// Open opens the window, sdl video must be initialized
+func (p *Preview) Open() error {
+	if p == nil {
+		return nil
+	}
+	window, err := sdl.CreateWindow("as", sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED,
+		PreviewWidth, PreviewHeight, sdl.WINDOW_SHOWN|sdl.WINDOW_RESIZABLE)
+	if err != nil {
+		return err
+	}
+	renderer, err := sdl.CreateRenderer(window, -1, sdl.RENDERER_ACCELERATED)
+	if err != nil {
+		window.Destroy()
+		return err
+	}
+	p.Window, p.Renderer = window, renderer
+	return nil
+}
+
+// Set sets the latest frame, entropy and action
+func (p *Preview) Set(frame *image.YCbCr, entropy float64, action TypeAction) {
+	if p == nil {
+		return
+	}
+	p.Lock()
+	defer p.Unlock()
+	if frame != nil {
+		p.Frame = frame
+	}
+	p.Entropy, p.Action = entropy, action
+}
+
+// Render renders the latest frame and the heads up display, the entropy is a
+// bar along the bottom of the window and the rest is in the title
+func (p *Preview) Render(mode Mode) error {
+	if p == nil || p.Renderer == nil {
+		return nil
+	}
+	p.Lock()
+	frame, entropy, action := p.Frame, p.Entropy, p.Action
+	p.Unlock()
+
+	name := "manual"
+	if mode == ModeAuto {
+		name = "auto"
+	}
+	p.Window.SetTitle(fmt.Sprintf("as %s entropy %.2f action %s", name, entropy, action))
+	err := p.Renderer.SetDrawColor(0, 0, 0, 255)
+	if err != nil {
+		return err
+	}
+	err = p.Renderer.Clear()
+	if err != nil {
+		return err
+	}
+	if frame != nil {
+		err := p.update(frame)
+		if err != nil {
+			return err
+		}
+		err = p.Renderer.Copy(p.Texture, nil, nil)
+		if err != nil {
+			return err
+		}
+	}
+	width, height, err := p.Renderer.GetOutputSize()
+	if err != nil {
+		return err
+	}
+	fill := entropy / 256
+	if fill > 1 {
+		fill = 1
+	} else if fill < 0 {
+		fill = 0
+	}
+	err = p.Renderer.SetDrawColor(0, 255, 0, 255)
+	if err != nil {
+		return err
+	}
+	err = p.Renderer.FillRect(&sdl.Rect{X: 0, Y: height - PreviewBar, W: int32(fill * float64(width)), H: PreviewBar})
+	if err != nil {
+		return err
+	}
+	p.Renderer.Present()
+	return nil
+}
+
+// update uploads a frame into the texture, the chroma of 4:2:2 frames is
+// subsampled vertically by skipping every other row and other frames are
+// converted
+func (p *Preview) update(frame *image.YCbCr) error {
+	bounds := frame.Bounds()
+	if p.Texture == nil || p.Bounds != bounds {
+		if p.Texture != nil {
+			p.Texture.Destroy()
+		}
+		texture, err := p.Renderer.CreateTexture(sdl.PIXELFORMAT_IYUV, sdl.TEXTUREACCESS_STREAMING,
+			int32(bounds.Dx()), int32(bounds.Dy()))
+		if err != nil {
+			return err
+		}
+		p.Texture, p.Bounds = texture, bounds
+	}
+	switch frame.SubsampleRatio {
+	case image.YCbCrSubsampleRatio420:
+	case image.YCbCrSubsampleRatio422:
+		return p.Texture.UpdateYUV(nil, frame.Y, frame.YStride,
+			frame.Cb, 2*frame.CStride, frame.Cr, 2*frame.CStride)
+	default:
+		frame = I420(frame)
+	}
+	return p.Texture.UpdateYUV(nil, frame.Y, frame.YStride,
+		frame.Cb, frame.CStride, frame.Cr, frame.CStride)
+}
+
+// Destroy closes the window
+func (p *Preview) Destroy() {
+	if p == nil || p.Renderer == nil {
+		return
+	}
+	if p.Texture != nil {
+		p.Texture.Destroy()
+	}
+	p.Renderer.Destroy()
+	p.Window.Destroy()
+}
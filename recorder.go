@@ -0,0 +1,139 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// RecordJPEG records frames as jpeg
+	RecordJPEG = "jpeg"
+	// RecordPNG records frames as lossless png
+	RecordPNG = "png"
+)
+
+// Recorder records the frames, observations and actions of a session into a
+// timestamped session directory, the observations are in the recording format
+// so a session can be replayed, trained on and debugged offline
+type Recorder struct {
+	Directory string
+	Format    string
+	Steps     int
+	// Observations is the recording of the observations and actions
+	Observations *os.File
+	// Index is the csv index of the frames
+	Index  *os.File
+	Writer *csv.Writer
+}
+
+// NewRecorder creates a new session directory in root
+func NewRecorder(root, format string) (*Recorder, error) {
+	if format != RecordJPEG && format != RecordPNG {
+		return nil, fmt.Errorf("unknown record format %s", format)
+	}
+	directory := filepath.Join(root, time.Now().Format("20060102-150405"))
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		return nil, err
+	}
+	observations, err := os.Create(filepath.Join(directory, "observations.txt"))
+	if err != nil {
+		return nil, err
+	}
+	index, err := os.Create(filepath.Join(directory, "frames.csv"))
+	if err != nil {
+		observations.Close()
+		return nil, err
+	}
+	writer := csv.NewWriter(index)
+	err = writer.Write([]string{"step", "time", "source", "file", "sequence", "captured", "exposure", "entropy", "action"})
+	if err != nil {
+		observations.Close()
+		index.Close()
+		return nil, err
+	}
+	return &Recorder{
+		Directory:    directory,
+		Format:       format,
+		Observations: observations,
+		Index:        index,
+		Writer:       writer,
+	}, nil
+}
+
+// Record records the frames of a step and the observation and action
+func (r *Recorder) Record(frames []Frame, observation []float64, action int) error {
+	if r == nil {
+		return nil
+	}
+	now := time.Now().Format(time.RFC3339Nano)
+	entropy := strconv.FormatFloat(Scalar(observation), 'f', -1, 64)
+	for _, frame := range frames {
+		name := fmt.Sprintf("%06d-%s.%s", r.Steps, frame.Source, r.Format)
+		err := r.write(filepath.Join(r.Directory, name), &frame)
+		if err != nil {
+			return err
+		}
+		err = r.Writer.Write([]string{strconv.Itoa(r.Steps), now, frame.Source, name,
+			strconv.FormatUint(frame.Sequence, 10), frame.Time.Format(time.RFC3339Nano),
+			strconv.Itoa(int(frame.Exposure)), entropy, strconv.Itoa(action)})
+		if err != nil {
+			return err
+		}
+	}
+	r.Writer.Flush()
+	r.Steps++
+	err := WriteObservation(r.Observations, observation, action, frames...)
+	if err != nil {
+		return err
+	}
+	return r.Writer.Error()
+}
+
+// write writes a frame, a motion jpeg frame is written as is
+func (r *Recorder) write(path string, frame *Frame) error {
+	if r.Format == RecordJPEG && frame.Encoded != nil {
+		return os.WriteFile(path, frame.Encoded, 0644)
+	}
+	var img image.Image
+	if frame.Frame != nil {
+		img = frame.Frame
+	} else if frame.Gray != nil {
+		img = frame.Gray
+	} else {
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if r.Format == RecordPNG {
+		return png.Encode(f, img)
+	}
+	return jpeg.Encode(f, img, &jpeg.Options{Quality: 90})
+}
+
+// Close closes the session
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.Writer.Flush()
+	err := r.Index.Close()
+	if err != nil {
+		return err
+	}
+	return r.Observations.Close()
+}
@@ -0,0 +1,280 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RemoteTimeout is how long the robot drives after the last drive
+	// message, the page sends them while the virtual joystick is held
+	RemoteTimeout = 500 * time.Millisecond
+	// RemoteStatusPeriod is the time between the status messages
+	RemoteStatusPeriod = 500 * time.Millisecond
+	// RemoteVideoPeriod is the time between the frames of the video stream
+	RemoteVideoPeriod = 100 * time.Millisecond
+	// RemoteCookie is the cookie that carries the secret after the page is
+	// opened with it
+	RemoteCookie = "as-remote"
+)
+
+// RemotePage is the touch friendly remote control page
+//
+//go:embed remote.html
+var RemotePage []byte
+
+// RemoteMessage is a message of the page, an empty input is a drive message
+// with X to the right and Y forward from -1 to 1
+type RemoteMessage struct {
+	X, Y  float64
+	Input string
+}
+
+// RemoteStatus is the state of the robot shown on the page
+type RemoteStatus struct {
+	Mode   string
+	EStop  bool
+	Values map[string]float64
+}
+
+// Remote drives the robot from a web page with a virtual joystick and buttons
+// over a websocket and streams the video of the first camera as motion jpeg,
+// the page is opened at /remote?token=<secret>
+type Remote struct {
+	sync.Mutex
+	// Secret is the shared secret of the kill switch, the remote is
+	// disabled without it
+	Secret []byte
+	// Left and Right are the proportional speeds of the last drive message
+	Left, Right float64
+	// Until is when the last drive message expires
+	Until time.Time
+	// Driving is true if the remote was driving at the last call of Speeds
+	Driving bool
+	// Inputs are the inputs of the page buttons
+	Inputs chan Input
+	// Status returns the state of the robot
+	Status func() RemoteStatus
+	// Frames returns the latest frames of the cameras
+	Frames func() []Frame
+}
+
+// NewRemote creates a new remote control
+func NewRemote(secret string, status func() RemoteStatus, frames func() []Frame) *Remote {
+	return &Remote{
+		Secret: []byte(secret),
+		Inputs: make(chan Input, 8),
+		Status: status,
+		Frames: frames,
+	}
+}
+
+// Drive sets the proportional speeds of the wheels from the virtual joystick
+func (r *Remote) Drive(x, y float64) {
+	r.Lock()
+	defer r.Unlock()
+	r.Left = math.Max(-1, math.Min(1, y+x))
+	r.Right = math.Max(-1, math.Min(1, y-x))
+	r.Until = time.Now().Add(RemoteTimeout)
+}
+
+// Speeds returns the proportional speeds of the wheels, ok is false if the
+// remote is not driving now and was not at the last call so it does not
+// override the joystick
+func (r *Remote) Speeds(now time.Time) (left, right float64, ok bool) {
+	r.Lock()
+	defer r.Unlock()
+	driving := now.Before(r.Until)
+	if driving {
+		left, right = r.Left, r.Right
+	}
+	ok, r.Driving = driving || r.Driving, driving
+	return left, right, ok
+}
+
+// Authorized returns true if the request carries the secret as the bearer
+// token, the token parameter or the cookie
+func (r *Remote) Authorized(req *http.Request) bool {
+	return Authorized(r.Secret, req)
+}
+
+// Authorized returns true if the request carries the secret as the bearer
+// token, the token parameter or the remote cookie, nothing is authorized
+// without a secret
+func Authorized(secret []byte, req *http.Request) bool {
+	if len(secret) == 0 {
+		return false
+	}
+	tokens := []string{
+		strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "),
+		req.URL.Query().Get("token"),
+	}
+	if cookie, err := req.Cookie(RemoteCookie); err == nil {
+		tokens = append(tokens, cookie.Value)
+	}
+	for _, token := range tokens {
+		if hmac.Equal([]byte(token), secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP serves the page, the websocket and the video stream
+func (r *Remote) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !r.Authorized(req) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch req.URL.Path {
+	case "/remote":
+		// the cookie is strict so other sites can't use it
+		http.SetCookie(w, &http.Cookie{
+			Name:     RemoteCookie,
+			Value:    string(r.Secret),
+			Path:     "/remote",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(RemotePage)
+	case "/remote/ws":
+		r.serveWebSocket(w, req)
+	case "/remote/video":
+		r.serveVideo(w, req)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+// serveWebSocket reads the messages of the page and writes the status
+func (r *Remote) serveWebSocket(w http.ResponseWriter, req *http.Request) {
+	ws, err := UpgradeWebSocket(w, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer ws.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(RemoteStatusPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			data, err := json.Marshal(r.Status())
+			if err != nil {
+				fmt.Println("remote:", err)
+				continue
+			}
+			if ws.Write(data) != nil {
+				return
+			}
+		}
+	}()
+	for {
+		data, err := ws.Read()
+		if err != nil {
+			// a lost connection stops the robot at once
+			r.Lock()
+			r.Until = time.Time{}
+			r.Unlock()
+			return
+		}
+		var message RemoteMessage
+		err = json.Unmarshal(data, &message)
+		if err != nil {
+			fmt.Println("remote:", err)
+			continue
+		}
+		if message.Input == "" {
+			r.Drive(message.X, message.Y)
+			continue
+		}
+		input, ok := ParseInput(message.Input)
+		if !ok || input.Held() {
+			fmt.Println("remote: unknown input", message.Input)
+			continue
+		}
+		if input == InputClear {
+			// the emergency stop is cleared at the robot
+			fmt.Println("remote: the emergency stop can't be cleared remotely")
+			continue
+		}
+		select {
+		case r.Inputs <- input:
+		default:
+		}
+	}
+}
+
+// serveVideo streams the first camera as motion jpeg until the client goes away
+func (r *Remote) serveVideo(w http.ResponseWriter, req *http.Request) {
+	const boundary = "frame"
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+boundary)
+	ticker := time.NewTicker(RemoteVideoPeriod)
+	defer ticker.Stop()
+	var last uint64
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		frames := r.Frames()
+		if len(frames) == 0 || frames[0].Sequence == last {
+			continue
+		}
+		frame := frames[0]
+		last = frame.Sequence
+		data := frame.Encoded
+		if data == nil {
+			var img image.Image
+			if frame.Frame != nil {
+				img = frame.Frame
+			} else if frame.Gray != nil {
+				img = frame.Gray
+			} else {
+				continue
+			}
+			buffer := bytes.Buffer{}
+			err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 70})
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			data = buffer.Bytes()
+		}
+		_, err := fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", boundary, len(data))
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		if err == nil {
+			_, err = w.Write([]byte("\r\n"))
+		}
+		if err != nil {
+			return
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+}
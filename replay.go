@@ -0,0 +1,264 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+func init() {
+	Cameras["replay"] = func(config CameraConfig) Camera {
+		camera := NewReplayCamera(config.Device, config.FPS)
+		camera.Source = config.Source
+		return camera
+	}
+	Chassises["replay"] = NewReplayChassis
+}
+
+// ReplayCamera is a virtual camera that plays back the frames of a recorded
+// session or of a directory of numbered images, every frame is delivered so
+// a replay is deterministic
+type ReplayCamera struct {
+	FrameCounters
+	Images chan Frame
+	// Source is the name the frames are tagged with and the source of the
+	// recorded frames that are played back
+	Source string
+	// Directory is the session directory
+	Directory string
+	// FPS is the playback rate, 0 plays back as fast as the frames are sensed
+	FPS int
+}
+
+// NewReplayCamera creates a new replay camera
+func NewReplayCamera(directory string, fps int) *ReplayCamera {
+	return &ReplayCamera{
+		Images:    make(chan Frame, 1),
+		Directory: directory,
+		FPS:       fps,
+	}
+}
+
+// Frames returns the channel the frames are streamed to
+func (rc *ReplayCamera) Frames() chan Frame {
+	return rc.Images
+}
+
+// Files returns the frame files of the source in the order they were recorded
+func (rc *ReplayCamera) Files() ([]string, error) {
+	index, err := os.Open(filepath.Join(rc.Directory, "frames.csv"))
+	if os.IsNotExist(err) {
+		// a directory of images is played back sorted by name
+		entries, err := os.ReadDir(rc.Directory)
+		if err != nil {
+			return nil, err
+		}
+		var files []string
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files = append(files, entry.Name())
+			}
+		}
+		sort.Strings(files)
+		return files, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer index.Close()
+	records, err := csv.NewReader(index).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, record := range records[1:] {
+		if record[2] == rc.Source {
+			files = append(files, record[3])
+		}
+	}
+	return files, nil
+}
+
+// Start plays back the session and closes the frames channel at the end
+func (rc *ReplayCamera) Start() {
+	defer close(rc.Images)
+	files, err := rc.Files()
+	if err != nil {
+		panic(err)
+	}
+	var ticker *time.Ticker
+	if rc.FPS > 0 {
+		ticker = time.NewTicker(time.Second / time.Duration(rc.FPS))
+		defer ticker.Stop()
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(rc.Directory, file))
+		if err != nil {
+			fmt.Println(rc.Directory, err)
+			continue
+		}
+		img, format, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			// files that are not images are skipped
+			continue
+		}
+		var encoded []byte
+		if format == "jpeg" {
+			encoded = data
+		}
+		if ticker != nil {
+			<-ticker.C
+		}
+		frame := NewFrame(rc.Source, YCbCr(img), encoded)
+		rc.Stamp(&frame)
+		rc.Images <- frame
+	}
+}
+
+// YCbCr converts an image into a ycbcr image with its origin at zero
+func YCbCr(img image.Image) *image.YCbCr {
+	bounds := img.Bounds()
+	if ycbcr, ok := img.(*image.YCbCr); ok && bounds.Min == (image.Point{}) {
+		return ycbcr
+	}
+	ycbcr := image.NewYCbCr(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), image.YCbCrSubsampleRatio444)
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			c := color.YCbCrModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.YCbCr)
+			ycbcr.Y[ycbcr.YOffset(x, y)] = c.Y
+			ycbcr.Cb[ycbcr.COffset(x, y)] = c.Cb
+			ycbcr.Cr[ycbcr.COffset(x, y)] = c.Cr
+		}
+	}
+	return ycbcr
+}
+
+// SessionSources returns the camera sources of a recorded session in the
+// order they were recorded, a directory of images is the front camera
+func SessionSources(directory string) ([]string, error) {
+	index, err := os.Open(filepath.Join(directory, "frames.csv"))
+	if os.IsNotExist(err) {
+		return []string{"front"}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer index.Close()
+	records, err := csv.NewReader(index).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var sources []string
+	seen := make(map[string]bool)
+	for _, record := range records[1:] {
+		if !seen[record[2]] {
+			seen[record[2]] = true
+			sources = append(sources, record[2])
+		}
+	}
+	return sources, nil
+}
+
+// ReplayChassis is a chassis that drops the commands so a recorded session
+// can be replayed through the whole agent stack off the robot
+type ReplayChassis struct {
+	State *Telemetry
+}
+
+// NewReplayChassis creates a new replay chassis
+func NewReplayChassis(config ChassisConfig) (Chassis, error) {
+	telemetry := NewTelemetry()
+	telemetry.SetLink(true, nil)
+	return &ReplayChassis{
+		State: telemetry,
+	}, nil
+}
+
+// Drive does nothing
+func (r *ReplayChassis) Drive(left, right float64) {}
+
+// Lights does nothing
+func (r *ReplayChassis) Lights(pwm int) {}
+
+// Gimbal does nothing
+func (r *ReplayChassis) Gimbal(x, y float64) {}
+
+// Pin does nothing
+func (r *ReplayChassis) Pin(pin string, value int) {}
+
+// Stop does nothing
+func (r *ReplayChassis) Stop() {}
+
+// Telemetry returns the telemetry, the link is always up
+func (r *ReplayChassis) Telemetry() *Telemetry {
+	return r.State
+}
+
+// Close does nothing
+func (r *ReplayChassis) Close() error {
+	return nil
+}
+
+// ReplayCameras returns the configs of the replay cameras of the sources of a
+// recorded session, the frames are replayed as fast as they are read
+func ReplayCameras(directory string) ([]CameraConfig, error) {
+	sources, err := SessionSources(directory)
+	if err != nil {
+		return nil, err
+	}
+	configs := make([]CameraConfig, len(sources))
+	for i, source := range sources {
+		configs[i] = CameraConfig{Source: source, Device: directory}
+	}
+	return configs, nil
+}
+
+// ReplayStats are the statistics of the steps of a replay
+type ReplayStats struct {
+	sync.Mutex
+	Steps   int
+	Total   float64
+	Actions []int
+}
+
+// NewReplayStats creates new replay statistics
+func NewReplayStats() *ReplayStats {
+	return &ReplayStats{
+		Actions: make([]int, ActionCount),
+	}
+}
+
+// Add records a step, nil statistics do nothing
+func (r *ReplayStats) Add(observation []float64, action int) {
+	if r == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	r.Steps++
+	r.Total += Scalar(observation)
+	r.Actions[action]++
+}
+
+// Print prints the mean entropy and the counts of the actions, a replay
+// without frames panics
+func (r *ReplayStats) Print(directory string) {
+	r.Lock()
+	defer r.Unlock()
+	if r.Steps == 0 {
+		panic(fmt.Errorf("no frames in %s", directory))
+	}
+	fmt.Printf("steps %d mean entropy %f\n", r.Steps, r.Total/float64(r.Steps))
+	for i, count := range r.Actions {
+		fmt.Printf("%s %d\n", TypeAction(i), count)
+	}
+}
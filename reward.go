@@ -0,0 +1,121 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Reward is a source of auxiliary reward
+type Reward uint
+
+const (
+	// RewardBattery is the battery level reward, 0 on a normal battery and
+	// -1 on an empty one
+	RewardBattery Reward = iota
+	// RewardBump is the bump event reward
+	RewardBump
+	// RewardThumbsUp is the user thumbs up button reward
+	RewardThumbsUp
+	// RewardCount is the number of reward sources
+	RewardCount
+)
+
+// String returns a string representation of the Reward
+func (r Reward) String() string {
+	switch r {
+	case RewardBattery:
+		return "battery"
+	case RewardBump:
+		return "bump"
+	case RewardThumbsUp:
+		return "thumbs"
+	default:
+		return "unknown"
+	}
+}
+
+// Shaper weights the auxiliary rewards of each source
+type Shaper struct {
+	Weights [RewardCount]float64
+}
+
+// NewShaper creates a new shaper from a list of source=weight pairs
+func NewShaper(weights string) (Shaper, error) {
+	shaper := Shaper{}
+	for i := range shaper.Weights {
+		shaper.Weights[i] = 1
+	}
+	for _, pair := range strings.Split(weights, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return shaper, fmt.Errorf("invalid reward weight %s", pair)
+		}
+		weight, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return shaper, err
+		}
+		found := false
+		for r := Reward(0); r < RewardCount; r++ {
+			if r.String() == parts[0] {
+				shaper.Weights[r], found = weight, true
+			}
+		}
+		if !found {
+			return shaper, fmt.Errorf("unknown reward source %s", parts[0])
+		}
+	}
+	return shaper, nil
+}
+
+// Shape weights a reward vector
+func (s Shaper) Shape(rewards []float64) []float64 {
+	shaped := make([]float64, len(rewards))
+	for i, value := range rewards {
+		if i < len(s.Weights) {
+			shaped[i] = s.Weights[i] * value
+		}
+	}
+	return shaped
+}
+
+// Total returns the total of a reward vector
+func Total(rewards []float64) float64 {
+	total := 0.0
+	for _, value := range rewards {
+		total += value
+	}
+	return total
+}
+
+// Rewards accumulates auxiliary rewards between steps of a mind
+type Rewards struct {
+	sync.Mutex
+	Values [RewardCount]float64
+}
+
+// Add adds a reward from a source
+func (r *Rewards) Add(source Reward, value float64) {
+	r.Lock()
+	defer r.Unlock()
+	r.Values[source] += value
+}
+
+// Take returns the accumulated rewards and clears them
+func (r *Rewards) Take() []float64 {
+	r.Lock()
+	defer r.Unlock()
+	rewards := make([]float64, RewardCount)
+	copy(rewards, r.Values[:])
+	r.Values = [RewardCount]float64{}
+	return rewards
+}
@@ -0,0 +1,54 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Rollover cuts the motors when the roll or pitch reported by the rover
+// exceeds the limit and saves the flight recorder as an incident
+type Rollover struct {
+	sync.Mutex
+	// Limit is the roll or pitch in degrees that cuts the motors, 0 disables
+	// the protection
+	Limit    float64
+	Recorder *FlightRecorder
+	// Tripped is true while the chassis exceeds the limit
+	Tripped bool
+}
+
+// NewRollover creates a new rollover protection
+func NewRollover(limit float64, recorder *FlightRecorder) *Rollover {
+	return &Rollover{
+		Limit:    limit,
+		Recorder: recorder,
+	}
+}
+
+// Check returns true while the fresh orientation in the state exceeds the
+// limit, an incident is saved each time the limit is first exceeded
+func (r *Rollover) Check(state RoverState) bool {
+	if r.Limit <= 0 || !state.Fresh(RoverStale) {
+		return false
+	}
+	tilted := math.Abs(state.Roll) > r.Limit || math.Abs(state.Pitch) > r.Limit
+	r.Lock()
+	defer r.Unlock()
+	if tilted == r.Tripped {
+		return tilted
+	}
+	r.Tripped = tilted
+	if !tilted {
+		fmt.Println("rollover: level again")
+		return false
+	}
+	// the incident is saved in the background so the motors stay cut
+	r.Recorder.Dump("rollover", fmt.Sprintf("roll %.1f pitch %.1f exceeds %.1f, motors cut",
+		state.Roll, state.Pitch, r.Limit))
+	return true
+}
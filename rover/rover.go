@@ -0,0 +1,438 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package rover implements the typed json commands of the waveshare rover
+// controller and a writer that sends them over the serial link
+package rover
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// TypeDrive is the type of the drive command
+	TypeDrive = 1
+	// TypeOLED is the type of the oled command
+	TypeOLED = 3
+	// TypeJoint is the type of the single arm joint command
+	TypeJoint = 101
+	// TypeArm is the type of the arm joints command
+	TypeArm = 102
+	// TypeGripper is the type of the gripper command
+	TypeGripper = 106
+	// TypeFeedbackRequest is the type of the feedback request command
+	TypeFeedbackRequest = 130
+	// TypeFeedback is the type of the continuous feedback command
+	TypeFeedback = 131
+	// TypeLight is the type of the light command
+	TypeLight = 132
+	// TypeGimbal is the type of the gimbal command
+	TypeGimbal = 133
+	// TypeEcho is the type of the command that echoes the received commands
+	TypeEcho = 143
+	// TypeModule is the type of the module command
+	TypeModule = 900
+)
+
+// Command is a command of the rover controller
+type Command interface {
+	// Type is the T field of the command
+	Type() int
+}
+
+// DriveCmd sets the speeds of the wheels in meters per second
+type DriveCmd struct {
+	Left  float64 `json:"L"`
+	Right float64 `json:"R"`
+}
+
+// Type is the type of the drive command
+func (DriveCmd) Type() int { return TypeDrive }
+
+// OLEDCmd sets a line of text on the oled display
+type OLEDCmd struct {
+	Line int    `json:"lineNum"`
+	Text string `json:"Text"`
+}
+
+// Type is the type of the oled command
+func (OLEDCmd) Type() int { return TypeOLED }
+
+// FeedbackRequestCmd requests a single base feedback frame
+type FeedbackRequestCmd struct{}
+
+// Type is the type of the feedback request command
+func (FeedbackRequestCmd) Type() int { return TypeFeedbackRequest }
+
+// FeedbackCmd turns the continuous base feedback on or off
+type FeedbackCmd struct {
+	On int `json:"cmd"`
+}
+
+// Type is the type of the feedback command
+func (FeedbackCmd) Type() int { return TypeFeedback }
+
+// LightPins are the io pins of the light command, the command always sets
+// both of them
+var LightPins = []string{"IO4", "IO5"}
+
+// LightCmd sets the pwm of the io pins of the lights, 0 is off and 255 is the
+// brightest
+type LightCmd struct {
+	IO4 int `json:"IO4"`
+	IO5 int `json:"IO5"`
+}
+
+// Set sets the pwm of a light pin by name, it returns false for an unknown pin
+func (l *LightCmd) Set(pin string, pwm int) bool {
+	switch pin {
+	case "IO4":
+		l.IO4 = pwm
+	case "IO5":
+		l.IO5 = pwm
+	default:
+		return false
+	}
+	return true
+}
+
+// Type is the type of the light command
+func (LightCmd) Type() int { return TypeLight }
+
+// GimbalCmd points the pan tilt gimbal in degrees
+type GimbalCmd struct {
+	X     float64 `json:"X"`
+	Y     float64 `json:"Y"`
+	Speed float64 `json:"SPD"`
+	Acc   float64 `json:"ACC"`
+}
+
+// Type is the type of the gimbal command
+func (GimbalCmd) Type() int { return TypeGimbal }
+
+// JointCmd moves a single joint of the arm to an angle in radians, the joints
+// are 1 base, 2 shoulder, 3 elbow and 4 hand
+type JointCmd struct {
+	Joint int     `json:"joint"`
+	Rad   float64 `json:"rad"`
+	Speed float64 `json:"spd"`
+	Acc   float64 `json:"acc"`
+}
+
+// Type is the type of the joint command
+func (JointCmd) Type() int { return TypeJoint }
+
+// ArmCmd moves all of the joints of the arm to angles in radians
+type ArmCmd struct {
+	Base     float64 `json:"base"`
+	Shoulder float64 `json:"shoulder"`
+	Elbow    float64 `json:"elbow"`
+	Hand     float64 `json:"hand"`
+	Speed    float64 `json:"spd"`
+	Acc      float64 `json:"acc"`
+}
+
+// Type is the type of the arm command
+func (ArmCmd) Type() int { return TypeArm }
+
+// GripperCmd moves the gripper at the end of the arm to an angle in radians
+type GripperCmd struct {
+	Rad   float64 `json:"cmd"`
+	Speed float64 `json:"spd"`
+	Acc   float64 `json:"acc"`
+}
+
+// Type is the type of the gripper command
+func (GripperCmd) Type() int { return TypeGripper }
+
+// EchoCmd turns the echo of the received commands on or off, the echo
+// acknowledges the commands
+type EchoCmd struct {
+	On int `json:"cmd"`
+}
+
+// Type is the type of the echo command
+func (EchoCmd) Type() int { return TypeEcho }
+
+// ModuleCmd sets the chassis and the module of the rover
+type ModuleCmd struct {
+	Main   int `json:"main"`
+	Module int `json:"module"`
+}
+
+// Type is the type of the module command
+func (ModuleCmd) Type() int { return TypeModule }
+
+// Marshal marshals a command into a json line with its type as the T field
+func Marshal(command Command) ([]byte, error) {
+	data, err := json.Marshal(command)
+	if err != nil {
+		return nil, err
+	}
+	line := []byte(fmt.Sprintf("{\"T\":%d", command.Type()))
+	if len(data) > 2 {
+		line = append(line, ',')
+	}
+	line = append(line, data[1:]...)
+	return append(line, '\n'), nil
+}
+
+// Stats are the counts of the commands handled by a writer
+type Stats struct {
+	// Sent is the number of commands written
+	Sent uint64
+	// Coalesced is the number of commands replaced by a newer one of the
+	// same type before they were written
+	Coalesced uint64
+	// Dropped is the number of commands that failed to write
+	Dropped uint64
+	// Unacknowledged is the number of commands the controller did not echo
+	// back before the timeout
+	Unacknowledged uint64
+}
+
+// String formats the stats
+func (s Stats) String() string {
+	return fmt.Sprintf("sent %d coalesced %d dropped %d unacknowledged %d",
+		s.Sent, s.Coalesced, s.Dropped, s.Unacknowledged)
+}
+
+// Coalescing are the types of the commands where only the latest matters
+var Coalescing = map[int]bool{
+	TypeDrive:  true,
+	TypeLight:  true,
+	TypeGimbal: true,
+}
+
+// Writer schedules the commands for the rover controller and writes them from
+// a single goroutine, writes are spaced by the interval and a coalescing
+// command that is not written yet is replaced by a newer one, with a timeout
+// each command waits for the controller to echo it back
+type Writer struct {
+	sync.Mutex
+	Output   io.Writer
+	Commands chan Command
+	Interval time.Duration
+	Timeout  time.Duration
+	Stats    Stats
+	pending  []Command
+	closing  sync.RWMutex
+	closed   bool
+	ready    chan struct{}
+	acks     chan []byte
+	last     time.Time
+	// stops counts the stops, a drive command taken from the pending
+	// commands before a stop is not written
+	stops uint64
+	// writing orders the writes of the run loop and of a stop
+	writing sync.Mutex
+}
+
+// NewWriter creates a new writer with a queue of the size, a timeout of zero
+// does not wait for acknowledgments
+func NewWriter(output io.Writer, size int, interval, timeout time.Duration) *Writer {
+	return &Writer{
+		Output:   output,
+		Commands: make(chan Command, size),
+		Interval: interval,
+		Timeout:  timeout,
+		ready:    make(chan struct{}, 1),
+		acks:     make(chan []byte, 16),
+	}
+}
+
+// key is what commands are coalesced by, the type and the key of commands
+// that have one
+func key(command Command) string {
+	if keyed, ok := command.(interface{ Key() string }); ok {
+		return fmt.Sprintf("%d %s", command.Type(), keyed.Key())
+	}
+	return fmt.Sprint(command.Type())
+}
+
+// Send queues a command, a coalescing command replaces the pending command of
+// the same type and key
+func (w *Writer) Send(command Command) {
+	// commands sent after the queue is closed are ignored
+	w.closing.RLock()
+	defer w.closing.RUnlock()
+	if w.closed {
+		return
+	}
+	if !Coalescing[command.Type()] {
+		w.Commands <- command
+		return
+	}
+	w.Lock()
+	replaced := false
+	for i, pending := range w.pending {
+		if key(pending) == key(command) {
+			w.pending[i], replaced = command, true
+			w.Stats.Coalesced++
+			break
+		}
+	}
+	if !replaced {
+		w.pending = append(w.pending, command)
+	}
+	w.Unlock()
+	select {
+	case w.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Ack handles a line read from the controller, the echo of a command
+// acknowledges it
+func (w *Writer) Ack(line []byte) {
+	if w.Timeout <= 0 {
+		return
+	}
+	select {
+	case w.acks <- append([]byte{}, bytes.TrimSpace(line)...):
+	default:
+	}
+}
+
+// Counts returns a copy of the stats
+func (w *Writer) Counts() Stats {
+	w.Lock()
+	defer w.Unlock()
+	return w.Stats
+}
+
+// Run writes the scheduled commands until the queue is closed and flushed or
+// a command fails to marshal, commands that fail to write are dropped so a
+// link that is down does not stop the queue
+func (w *Writer) Run() error {
+	for {
+		var commands []Command
+		var stops uint64
+		select {
+		case queued, ok := <-w.Commands:
+			if !ok {
+				// the pending commands are flushed once the queue is closed
+				w.Lock()
+				commands, stops, w.pending = w.pending, w.stops, nil
+				w.Unlock()
+				for _, command := range commands {
+					err := w.write(command, stops)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			w.Lock()
+			commands, stops = []Command{queued}, w.stops
+			w.Unlock()
+		case <-w.ready:
+			w.Lock()
+			commands, stops, w.pending = w.pending, w.stops, nil
+			w.Unlock()
+		}
+		for _, command := range commands {
+			err := w.write(command, stops)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// write writes a command once the interval since the last write has passed
+// and waits for its acknowledgment, a drive command taken before the last stop
+// is dropped
+func (w *Writer) write(command Command, stops uint64) error {
+	data, err := Marshal(command)
+	if err != nil {
+		return err
+	}
+	if wait := w.Interval - time.Since(w.last); wait > 0 {
+		time.Sleep(wait)
+	}
+	for len(w.acks) > 0 {
+		<-w.acks
+	}
+	w.writing.Lock()
+	w.Lock()
+	stale := command.Type() == TypeDrive && stops != w.stops
+	w.Unlock()
+	if stale {
+		w.writing.Unlock()
+		return nil
+	}
+	_, err = w.Output.Write(data)
+	w.writing.Unlock()
+	w.last = time.Now()
+	if err != nil {
+		w.Lock()
+		w.Stats.Dropped++
+		w.Unlock()
+		return nil
+	}
+	acknowledged := w.Timeout <= 0
+	if !acknowledged {
+		timeout := time.After(w.Timeout)
+		echo := bytes.TrimSpace(data)
+	wait:
+		for {
+			select {
+			case line := <-w.acks:
+				if bytes.Equal(line, echo) {
+					acknowledged = true
+					break wait
+				}
+			case <-timeout:
+				break wait
+			}
+		}
+	}
+	w.Lock()
+	w.Stats.Sent++
+	if !acknowledged {
+		w.Stats.Unacknowledged++
+	}
+	w.Unlock()
+	return nil
+}
+
+// Stop drops the pending drive command and writes the stop command ahead of
+// the queue, so a drive command that was not written yet can't restart the
+// motors after the stop
+func (w *Writer) Stop(stop Command) error {
+	data, err := Marshal(stop)
+	if err != nil {
+		return err
+	}
+	w.writing.Lock()
+	defer w.writing.Unlock()
+	w.Lock()
+	pending := w.pending[:0]
+	for _, command := range w.pending {
+		if command.Type() != TypeDrive {
+			pending = append(pending, command)
+		}
+	}
+	w.pending = pending
+	w.stops++
+	w.Unlock()
+	_, err = w.Output.Write(data)
+	return err
+}
+
+// Close closes the queue
+func (w *Writer) Close() {
+	w.closing.Lock()
+	defer w.closing.Unlock()
+	if !w.closed {
+		w.closed = true
+		close(w.Commands)
+	}
+}
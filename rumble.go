@@ -0,0 +1,91 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Rumble is a rumble of the game controllers
+type Rumble struct {
+	// Low and High are the strengths of the low and high frequency motors
+	Low, High uint16
+	Duration  time.Duration
+}
+
+var (
+	// RumbleObstacle is felt when an obstacle slows or blocks the robot
+	RumbleObstacle = Rumble{Low: 0, High: 0xFFFF, Duration: 300 * time.Millisecond}
+	// RumbleMode is felt when the mode changes
+	RumbleMode = Rumble{Low: 0x8000, High: 0x8000, Duration: 150 * time.Millisecond}
+	// RumbleBattery is felt when the battery level drops
+	RumbleBattery = Rumble{Low: 0xFFFF, High: 0, Duration: time.Second}
+)
+
+// Controllers are the connected game controllers by instance id, the rumbles
+// are queued from any goroutine and played from the sdl event loop
+type Controllers struct {
+	Controllers map[sdl.JoystickID]*sdl.GameController
+	// Enabled is false if the controllers don't rumble
+	Enabled bool
+	Rumbles chan Rumble
+}
+
+// NewControllers creates the game controllers
+func NewControllers(enabled bool) *Controllers {
+	return &Controllers{
+		Controllers: make(map[sdl.JoystickID]*sdl.GameController),
+		Enabled:     enabled,
+		Rumbles:     make(chan Rumble, 8),
+	}
+}
+
+// Open opens the game controller of a device index
+func (c *Controllers) Open(index int) {
+	controller := sdl.GameControllerOpen(index)
+	if controller == nil {
+		fmt.Printf("Device %d is not a game controller\n", index)
+		return
+	}
+	c.Controllers[controller.Joystick().InstanceID()] = controller
+	fmt.Printf("Game controller %d %s connected\n", index, controller.Name())
+}
+
+// Close closes the game controller of an instance id
+func (c *Controllers) Close(id sdl.JoystickID) {
+	if controller := c.Controllers[id]; controller != nil {
+		controller.Close()
+		delete(c.Controllers, id)
+	}
+	fmt.Printf("Game controller %d disconnected\n", id)
+}
+
+// Rumble queues a rumble, it is dropped if the queue is full
+func (c *Controllers) Rumble(rumble Rumble) {
+	if !c.Enabled {
+		return
+	}
+	select {
+	case c.Rumbles <- rumble:
+	default:
+	}
+}
+
+// Play plays the queued rumbles on all controllers, it is called from the sdl
+// event loop
+func (c *Controllers) Play() {
+	for len(c.Rumbles) > 0 {
+		rumble := <-c.Rumbles
+		for _, controller := range c.Controllers {
+			err := controller.Rumble(rumble.Low, rumble.High, uint32(rumble.Duration.Milliseconds()))
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// ScheduleConstant keeps the temperature fixed
+	ScheduleConstant = "constant"
+	// ScheduleLinear decays the temperature linearly
+	ScheduleLinear = "linear"
+	// ScheduleExponential decays the temperature exponentially
+	ScheduleExponential = "exponential"
+	// ScheduleAdaptive raises the temperature when the entropy is changing
+	ScheduleAdaptive = "adaptive"
+)
+
+// Schedule is a softmax temperature schedule, it scales the base temperature
+// of a mind from 1 down to End
+type Schedule struct {
+	Kind  string
+	End   float64
+	Steps int
+	Decay float64
+	Step  int
+	// Change is the running average of the absolute entropy change
+	Change  float64
+	Entropy float64
+}
+
+// NewSchedule creates a new temperature schedule
+func NewSchedule(kind string, end float64, steps int, decay float64) Schedule {
+	switch kind {
+	case ScheduleConstant, ScheduleLinear, ScheduleExponential, ScheduleAdaptive:
+	default:
+		panic(fmt.Errorf("unknown temperature schedule %s", kind))
+	}
+	return Schedule{
+		Kind:  kind,
+		End:   end,
+		Steps: steps,
+		Decay: decay,
+	}
+}
+
+// Temperature returns the scheduled temperature for the base temperature and
+// advances the schedule
+func (s *Schedule) Temperature(base, entropy float64) float64 {
+	factor := 1.0
+	switch s.Kind {
+	case ScheduleLinear:
+		if s.Steps > 0 {
+			factor = 1 + (s.End-1)*math.Min(float64(s.Step)/float64(s.Steps), 1)
+		}
+	case ScheduleExponential:
+		factor = math.Max(s.End, math.Pow(s.Decay, float64(s.Step)))
+	case ScheduleAdaptive:
+		if s.Step > 0 {
+			s.Change = (s.Change + math.Abs(entropy-s.Entropy)) / 2
+		}
+		factor = s.End + (1-s.End)*math.Min(s.Change/16, 1)
+	}
+	s.Entropy = entropy
+	s.Step++
+	return base * factor
+}
+
+// Reset resets the schedule
+func (s *Schedule) Reset() {
+	s.Step = 0
+	s.Change = 0
+	s.Entropy = 0
+}
@@ -0,0 +1,155 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Sensor is a sensor that maps a frame to sensor values
+type Sensor interface {
+	// Sense senses a frame
+	Sense(frame *Frame) []float64
+}
+
+// SensorFactory creates a new sensor, NewSensor wraps it to inject the noise
+type SensorFactory func() Sensor
+
+// Sensors is the registry of sensors
+var Sensors = map[string]SensorFactory{
+	"ksensor": func() Sensor {
+		return &KSensor{Input: *FlagKSensorInput, Bands: *FlagBands, Preprocess: preprocess(), Complexity: complexity()}
+	},
+	"esensor": func() Sensor {
+		return &ESensor{Input: *FlagESensorInput, Bands: *FlagBands, Preprocess: preprocess()}
+	},
+	"csensor": func() Sensor {
+		return NewCSensor(*FlagBands, *FlagSensorCompressor)
+	},
+	"fsensor": func() Sensor {
+		return &FSensor{}
+	},
+	"dsensor": func() Sensor {
+		return &DSensor{}
+	},
+	"hsensor": func() Sensor {
+		return &HSensor{Tiles: *FlagTiles}
+	},
+	"ssensor": func() Sensor {
+		return &SSensor{}
+	},
+	"gsensor": func() Sensor {
+		return &GSensor{}
+	},
+	"tsensor": func() Sensor {
+		return &TSensor{Complexity: complexity()}
+	},
+	"jsensor": func() Sensor {
+		return &JSensor{}
+	},
+	"grid": func() Sensor {
+		sensor, err := NewGridSensor(*FlagGrid, complexity())
+		if err != nil {
+			panic(err)
+		}
+		return sensor
+	},
+}
+
+// preprocess creates the sensor preprocess from the flags
+func preprocess() Preprocess {
+	p, err := NewPreprocess(*FlagROI, *FlagDownsample)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// complexity creates the sensor complexity estimator from the flags
+func complexity() Complexity {
+	c, err := NewComplexity(*FlagSensorCompressor)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// SensorNames returns the sorted names of the registered sensors
+func SensorNames() []string {
+	names := make([]string, 0, len(Sensors))
+	for name := range Sensors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewSensor creates a new sensor from the registry that injects noise into
+// its frames
+func NewSensor(name string, noise NoiseConfig) (Sensor, error) {
+	factory, ok := Sensors[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown sensor %s, available sensors: %v", name, SensorNames())
+	}
+	n, err := NewNoise(noise)
+	if err != nil {
+		return nil, err
+	}
+	if n.Enabled() {
+		return &NoisySensor{Sensor: factory(), Noise: n}, nil
+	}
+	return factory(), nil
+}
+
+// noise returns the noise configuration from the flags
+func noise() NoiseConfig {
+	return NoiseConfig{
+		Type:  *FlagNoise,
+		Sigma: *FlagNoiseSigma,
+		Seed:  *FlagNoiseSeed,
+	}
+}
+
+// Band returns the frequency band of an fft coefficient, the bands evenly
+// divide the normalized radial frequency
+func Band(bands int, index, size []int) int {
+	r := 0.0
+	for i, value := range index {
+		if value > size[i]/2 {
+			value = size[i] - value
+		}
+		f := 0.0
+		if size[i] > 1 {
+			f = float64(value) / float64(size[i]/2)
+		}
+		r += f * f
+	}
+	band := int(math.Sqrt(r/float64(len(index))) * float64(bands))
+	if band >= bands {
+		band = bands - 1
+	}
+	return band
+}
+
+// Shannon returns the shannon entropy in bits of a histogram
+func Shannon(histogram []float64) float64 {
+	sum := 0.0
+	for _, value := range histogram {
+		sum += value
+	}
+	if sum == 0 {
+		return 0
+	}
+	entropy := 0.0
+	for _, value := range histogram {
+		if value > 0 {
+			p := value / sum
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
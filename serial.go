@@ -0,0 +1,250 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pointlander/as/rover"
+	"go.bug.st/serial"
+)
+
+// SerialCandidates are the devices scanned for the rover controller in order
+var SerialCandidates = []string{"/dev/ttyAMA0", "/dev/serial0", "/dev/ttyUSB*", "/dev/ttyACM*"}
+
+// ProbeTimeout is how long the rover controller has to respond to the probe
+const ProbeTimeout = 2 * time.Second
+
+// OpenRover opens the serial port of the rover controller, an empty device
+// scans the candidates, the device has to respond to a probe
+func OpenRover(device string, baud int) (serial.Port, string, error) {
+	devices := []string{device}
+	if device == "" {
+		devices = devices[:0]
+		for _, candidate := range SerialCandidates {
+			matches, err := filepath.Glob(candidate)
+			if err != nil {
+				return nil, "", err
+			}
+			devices = append(devices, matches...)
+		}
+		if len(devices) == 0 {
+			return nil, "", fmt.Errorf("no serial devices found in %v", SerialCandidates)
+		}
+	}
+	var errs []error
+	for _, device := range devices {
+		port, err := serial.Open(device, &serial.Mode{BaudRate: baud})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", device, err))
+			continue
+		}
+		err = Probe(port)
+		if err != nil {
+			port.Close()
+			errs = append(errs, fmt.Errorf("%s: %w", device, err))
+			continue
+		}
+		return port, device, nil
+	}
+	return nil, "", fmt.Errorf("no rover controller found: %v", errs)
+}
+
+// Probe requests the base feedback of the rover controller and waits for a
+// json response
+func Probe(port serial.Port) error {
+	data, err := rover.Marshal(rover.FeedbackRequestCmd{})
+	if err != nil {
+		return err
+	}
+	_, err = port.Write(data)
+	if err != nil {
+		return err
+	}
+	err = port.SetReadTimeout(100 * time.Millisecond)
+	if err != nil {
+		return err
+	}
+	defer port.SetReadTimeout(serial.NoTimeout)
+	var line []byte
+	buffer := make([]byte, 256)
+	deadline := time.Now().Add(ProbeTimeout)
+	for time.Now().Before(deadline) {
+		n, err := port.Read(buffer)
+		if err != nil {
+			return err
+		}
+		line = append(line, buffer[:n]...)
+		for {
+			index := bytes.IndexByte(line, '\n')
+			if index < 0 {
+				break
+			}
+			var response map[string]interface{}
+			if json.Unmarshal(bytes.TrimSpace(line[:index]), &response) == nil {
+				return nil
+			}
+			line = line[index+1:]
+		}
+	}
+	return fmt.Errorf("no response to the probe")
+}
+
+const (
+	// SerialBackoffMin is the first delay before the serial port is reopened
+	SerialBackoffMin = 250 * time.Millisecond
+	// SerialBackoffMax is the longest delay between attempts to reopen the
+	// serial port
+	SerialBackoffMax = 8 * time.Second
+)
+
+// ErrLinkDown is returned by writes while the serial link is down
+var ErrLinkDown = errors.New("serial link is down")
+
+// Link is a serial link to the rover controller that reopens the port when it
+// fails, writes fail fast while the link is down so the cameras and the mind
+// keep running
+type Link struct {
+	sync.Mutex
+	// writing keeps the lines of concurrent writes from interleaving
+	writing   sync.Mutex
+	Device    string
+	Baud      int
+	Port      serial.Port
+	Closed    bool
+	Telemetry *Telemetry
+	// Connect is called with each newly opened port before it is used
+	Connect func(port serial.Port)
+}
+
+// NewLink opens a serial link to the rover controller
+func NewLink(device string, baud int, telemetry *Telemetry) (*Link, string, error) {
+	port, found, err := OpenRover(device, baud)
+	if err != nil {
+		return nil, "", err
+	}
+	telemetry.SetLink(true, nil)
+	return &Link{
+		Device:    device,
+		Baud:      baud,
+		Port:      port,
+		Telemetry: telemetry,
+	}, found, nil
+}
+
+// port returns the open port, nil if the link is down
+func (l *Link) port() serial.Port {
+	l.Lock()
+	defer l.Unlock()
+	return l.Port
+}
+
+// fail closes a failed port and records the outage
+func (l *Link) fail(port serial.Port, err error) {
+	l.Lock()
+	defer l.Unlock()
+	if l.Port != port || l.Closed {
+		return
+	}
+	l.Port.Close()
+	l.Port = nil
+	l.Telemetry.SetLink(false, err)
+	fmt.Println("serial link down:", err)
+}
+
+// reconnect reopens the port with an exponential backoff until it succeeds
+// or the link is closed
+func (l *Link) reconnect() serial.Port {
+	backoff := SerialBackoffMin
+	for {
+		l.Lock()
+		closed := l.Closed
+		l.Unlock()
+		if closed {
+			return nil
+		}
+		time.Sleep(backoff)
+		port, device, err := OpenRover(l.Device, l.Baud)
+		if err != nil {
+			backoff *= 2
+			if backoff > SerialBackoffMax {
+				backoff = SerialBackoffMax
+			}
+			continue
+		}
+		if l.Connect != nil {
+			l.Connect(port)
+		}
+		l.Lock()
+		if l.Closed {
+			l.Unlock()
+			port.Close()
+			return nil
+		}
+		l.Port = port
+		l.Telemetry.SetLink(true, nil)
+		l.Unlock()
+		fmt.Println("serial link up on", device)
+		return port
+	}
+}
+
+// Read reads from the serial port, reconnecting while the link is down, it
+// only fails once the link is closed
+func (l *Link) Read(p []byte) (int, error) {
+	for {
+		port := l.port()
+		if port == nil {
+			port = l.reconnect()
+			if port == nil {
+				return 0, io.EOF
+			}
+		}
+		n, err := port.Read(p)
+		if err == nil && n > 0 {
+			return n, nil
+		}
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		l.fail(port, err)
+	}
+}
+
+// Write writes to the serial port, ErrLinkDown is returned while the link is
+// down
+func (l *Link) Write(p []byte) (int, error) {
+	l.writing.Lock()
+	defer l.writing.Unlock()
+	port := l.port()
+	if port == nil {
+		return 0, ErrLinkDown
+	}
+	n, err := port.Write(p)
+	if err != nil {
+		l.fail(port, err)
+	}
+	return n, err
+}
+
+// Close closes the link
+func (l *Link) Close() error {
+	l.Lock()
+	defer l.Unlock()
+	l.Closed = true
+	if l.Port == nil {
+		return nil
+	}
+	err := l.Port.Close()
+	l.Port = nil
+	return err
+}
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
@@ -20,7 +21,7 @@ func Simulation() {
 		Height    = 16
 		Particles = 3
 	)
-	rng := rand.New(rand.NewSource(1))
+	rng := rand.New(rand.NewSource(*FlagSeed))
 
 	gray := make([]color.Color, 0, 256)
 	for i := 0; i < 256; i++ {
@@ -47,21 +48,57 @@ func Simulation() {
 		}
 	}
 
-	sensor := KSensor{}
-	var mindX [Particles]MarkovMind
-	var mindY [Particles]MarkovMind
-	var action [Particles]MarkovMind
+	sensor, err := NewSensor(*FlagSensor, noise())
+	if err != nil {
+		panic(err)
+	}
+	var mindX [Particles]Mind
+	var mindY [Particles]Mind
+	var action [Particles]Mind
 	for i := 0; i < Particles; i++ {
-		mindX[i] = NewMarkovMind(rng, Width)
-		mindY[i] = NewMarkovMind(rng, Height)
-		action[i] = NewMarkovMind(rng, 255)
+		var err error
+		mindX[i], err = NewMind(*FlagMind, rng, Width)
+		if err != nil {
+			panic(err)
+		}
+		mindY[i], err = NewMind(*FlagMind, rng, Height)
+		if err != nil {
+			panic(err)
+		}
+		action[i], err = NewMind(*FlagMind, rng, 255)
+		if err != nil {
+			panic(err)
+		}
 	}
+	// a robot mind loaded from a checkpoint is replayed on the simulated
+	// observations
+	var replay Mind
+	replays := make([]int, ActionCount)
+	if *FlagLoad != "" {
+		var err error
+		replay, err = NewMind(*FlagMind, rng, int(ActionCount))
+		if err != nil {
+			panic(err)
+		}
+		err = LoadMind(replay, *FlagLoad)
+		if err != nil {
+			panic(err)
+		}
+	}
+	total := 0.0
+	calibration := NewCalibration(*FlagCalibration)
+	habituation := NewHabituation(*FlagHabituation)
 	for i := 0; i < 1024; i++ {
-		entropy := sensor.Sense(rng, img)
+		observation := sensor.Sense(&Frame{Gray: img})
+		total += Scalar(observation)
+		observation = habituation.Adapt(calibration.Normalize(observation))
+		if replay != nil {
+			replays[replay.Step(rng, observation, nil, nil)]++
+		}
 		for i := 0; i < Particles; i++ {
-			actionX := mindX[i].Step(rng, entropy)
-			actionY := mindY[i].Step(rng, entropy)
-			act := action[i].Step(rng, entropy)
+			actionX := mindX[i].Step(rng, observation, nil, nil)
+			actionY := mindY[i].Step(rng, observation, nil, nil)
+			act := action[i].Step(rng, observation, nil, nil)
 			value := img.GrayAt(actionX, actionY)
 			value.Y += byte(act)
 			img.SetGray(actionX, actionY, value)
@@ -70,6 +107,21 @@ func Simulation() {
 		add(img)
 	}
 
+	for i := 0; i < Particles; i++ {
+		for _, mind := range []Mind{mindX[i], mindY[i], action[i]} {
+			if markov, ok := mind.(*MarkovMind); ok {
+				fmt.Println(markov.Stats)
+			}
+		}
+	}
+
+	fmt.Printf("mean entropy %f\n", total/1024)
+	if replay != nil {
+		for i, count := range replays {
+			fmt.Printf("%s %d\n", TypeAction(i), count)
+		}
+	}
+
 	animation := &gif.GIF{}
 	for _, paletted := range images {
 		animation.Image = append(animation.Image, paletted)
@@ -0,0 +1,101 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// SnapshotMetadata is the metadata saved with a snapshot
+type SnapshotMetadata struct {
+	Source   string
+	Sequence uint64
+	Captured time.Time
+	Exposure int32
+	// Trigger is what took the snapshot, the joystick or the mind
+	Trigger string
+}
+
+// Snapshots saves the current full resolution frames as photos
+type Snapshots struct {
+	sync.Mutex
+	Directory string
+	// Last is the sequence number of the last frame saved, so a frame is
+	// only saved once
+	Last map[string]uint64
+}
+
+// NewSnapshots creates a new snapshots directory
+func NewSnapshots(directory string) *Snapshots {
+	return &Snapshots{
+		Directory: directory,
+		Last:      make(map[string]uint64),
+	}
+}
+
+// Take saves the frames as jpeg photos with json metadata
+func (s *Snapshots) Take(frames []Frame, trigger string) error {
+	s.Lock()
+	defer s.Unlock()
+	err := os.MkdirAll(s.Directory, 0755)
+	if err != nil {
+		return err
+	}
+	for _, frame := range frames {
+		if s.Last[frame.Source] == frame.Sequence {
+			continue
+		}
+		var img image.Image
+		if frame.Frame != nil {
+			img = frame.Frame
+		} else if frame.Gray != nil {
+			img = frame.Gray
+		}
+		name := filepath.Join(s.Directory, fmt.Sprintf("%s-%s-%d",
+			frame.Time.Format("20060102-150405"), frame.Source, frame.Sequence))
+		if img != nil {
+			f, err := os.Create(name + ".jpg")
+			if err != nil {
+				return err
+			}
+			err = jpeg.Encode(f, img, &jpeg.Options{Quality: 95})
+			f.Close()
+			if err != nil {
+				return err
+			}
+		} else if frame.Encoded != nil {
+			err := os.WriteFile(name+".jpg", frame.Encoded, 0644)
+			if err != nil {
+				return err
+			}
+		} else {
+			continue
+		}
+		data, err := json.MarshalIndent(SnapshotMetadata{
+			Source:   frame.Source,
+			Sequence: frame.Sequence,
+			Captured: frame.Time,
+			Exposure: frame.Exposure,
+			Trigger:  trigger,
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(name+".json", data, 0644)
+		if err != nil {
+			return err
+		}
+		s.Last[frame.Source] = frame.Sequence
+		fmt.Println("snapshot", name)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"math/cmplx"
+
+	"gonum.org/v1/gonum/dsp/fourier"
+)
+
+// Spectrum computes the fft of the last Depth real frames with preallocated
+// buffers, the spatial half spectrum of each frame is cached so only the
+// depth axis is transformed per frame and the other half of the spectrum is
+// filled in from its conjugate symmetry
+type Spectrum struct {
+	Depth, Width, Height int
+	// Pixels is the next frame indexed by x*Height+y
+	Pixels []float64
+	// Frames is a ring buffer of the spatial half spectra of the frames
+	// indexed by x*(Height/2+1)+y, Head is the newest
+	Frames [][]complex128
+	Head   int
+	// Values is the spectrum indexed by (d*Width+x)*Height+y
+	Values []complex128
+
+	bands   map[int][]int
+	rows    *fourier.FFT
+	columns *fourier.CmplxFFT
+	depth   *fourier.CmplxFFT
+	half    []complex128
+	column  []complex128
+	deep    []complex128
+}
+
+// NewSpectrum creates a new spectrum
+func NewSpectrum(depth, width, height int) *Spectrum {
+	half := height/2 + 1
+	s := Spectrum{
+		Depth:   depth,
+		Width:   width,
+		Height:  height,
+		Pixels:  make([]float64, width*height),
+		Frames:  make([][]complex128, depth),
+		Values:  make([]complex128, depth*width*height),
+		bands:   make(map[int][]int),
+		rows:    fourier.NewFFT(height),
+		columns: fourier.NewCmplxFFT(width),
+		depth:   fourier.NewCmplxFFT(depth),
+		half:    make([]complex128, half),
+		column:  make([]complex128, width),
+		deep:    make([]complex128, depth),
+	}
+	for i := range s.Frames {
+		s.Frames[i] = make([]complex128, width*half)
+	}
+	return &s
+}
+
+// Transform adds the frame in Pixels and computes the spectrum
+func (s *Spectrum) Transform() []complex128 {
+	width, height, half := s.Width, s.Height, s.Height/2+1
+	s.Head = (s.Head + 1) % s.Depth
+	frame := s.Frames[s.Head]
+	for x := 0; x < width; x++ {
+		s.rows.Coefficients(s.half, s.Pixels[x*height:(x+1)*height])
+		copy(frame[x*half:(x+1)*half], s.half)
+	}
+	for y := 0; y < half; y++ {
+		for x := range s.column {
+			s.column[x] = frame[x*half+y]
+		}
+		s.columns.Coefficients(s.column, s.column)
+		for x, value := range s.column {
+			frame[x*half+y] = value
+		}
+	}
+	for x := 0; x < width; x++ {
+		for y := 0; y < half; y++ {
+			for d := range s.deep {
+				s.deep[d] = s.Frames[(s.Head-d+s.Depth)%s.Depth][x*half+y]
+			}
+			s.depth.Coefficients(s.deep, s.deep)
+			for d, value := range s.deep {
+				s.Values[(d*width+x)*height+y] = value
+			}
+		}
+	}
+	for d := 0; d < s.Depth; d++ {
+		for x := 0; x < width; x++ {
+			for y := half; y < height; y++ {
+				mirror := (((s.Depth-d)%s.Depth)*width+(width-x)%width)*height + height - y
+				s.Values[(d*width+x)*height+y] = cmplx.Conj(s.Values[mirror])
+			}
+		}
+	}
+	return s.Values
+}
+
+// Bands returns the frequency band of each value of the spectrum
+func (s *Spectrum) Bands(bands int) []int {
+	if table, ok := s.bands[bands]; ok {
+		return table
+	}
+	table, size := make([]int, len(s.Values)), []int{s.Depth, s.Width, s.Height}
+	for d := 0; d < s.Depth; d++ {
+		for x := 0; x < s.Width; x++ {
+			for y := 0; y < s.Height; y++ {
+				table[(d*s.Width+x)*s.Height+y] = Band(bands, []int{d, x, y}, size)
+			}
+		}
+	}
+	s.bands[bands] = table
+	return table
+}
@@ -0,0 +1,69 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"image"
+	"math"
+)
+
+// SaliencyGrid is the number of saliency cells per side
+const SaliencyGrid = 8
+
+// SSensor is a saliency sensor that senses a coarse center surround saliency
+// map, the total saliency and the location of the most salient cell
+type SSensor struct {
+	// Map is the latest saliency map indexed by x then y
+	Map [SaliencyGrid][SaliencyGrid]float64
+	// X and Y are the cell of maximum saliency
+	X, Y int
+}
+
+// Sense senses the gray image of a frame and returns the mean saliency and
+// the x and y cell of maximum saliency
+func (s *SSensor) Sense(frame *Frame) []float64 {
+	img := frame.Gray
+	bounds := img.Bounds()
+	global := 0.0
+	for _, value := range img.Pix {
+		global += float64(value)
+	}
+	global /= float64(len(img.Pix))
+	total, max := 0.0, -1.0
+	for i := 0; i < SaliencyGrid; i++ {
+		for j := 0; j < SaliencyGrid; j++ {
+			cell := image.Rect(
+				bounds.Min.X+i*bounds.Dx()/SaliencyGrid, bounds.Min.Y+j*bounds.Dy()/SaliencyGrid,
+				bounds.Min.X+(i+1)*bounds.Dx()/SaliencyGrid, bounds.Min.Y+(j+1)*bounds.Dy()/SaliencyGrid)
+			saliency := s.saliency(img, cell, global)
+			s.Map[i][j] = saliency
+			total += saliency
+			if saliency > max {
+				max, s.X, s.Y = saliency, i, j
+			}
+		}
+	}
+	return []float64{total / (SaliencyGrid * SaliencyGrid), float64(s.X), float64(s.Y)}
+}
+
+// saliency is the contrast of a cell with the whole image plus the contrast
+// within the cell, scaled to 0 to 16
+func (s *SSensor) saliency(img *image.Gray, cell image.Rectangle, global float64) float64 {
+	if cell.Empty() {
+		return 0
+	}
+	sum, squares, count := 0.0, 0.0, 0.0
+	for x := cell.Min.X; x < cell.Max.X; x++ {
+		for y := cell.Min.Y; y < cell.Max.Y; y++ {
+			value := float64(img.GrayAt(x, y).Y)
+			sum += value
+			squares += value * value
+			count++
+		}
+	}
+	mean := sum / count
+	deviation := math.Sqrt(math.Max(squares/count-mean*mean, 0))
+	return (math.Abs(mean-global) + deviation) / 16
+}
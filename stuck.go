@@ -0,0 +1,138 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// StuckGyro is the raw angular velocity above which the imu is moving
+	StuckGyro = 5
+	// StuckWheels is the reported wheel speed in meters per second below
+	// which a commanded wheel is stalled
+	StuckWheels = .01
+	// StuckCommand is the commanded wheel speed below which the robot is not
+	// trying to move
+	StuckCommand = .02
+)
+
+// Recovery is the scripted maneuver that frees a stuck robot, back up and
+// then turn
+var Recovery = []Motion{
+	{Left: -1, Right: -1, Duration: Duration{time.Second}},
+	{Left: -1, Right: 1, Duration: Duration{700 * time.Millisecond}},
+}
+
+// Stuck detects when the commanded motion of the robot produces no change
+// for the timeout and runs the recovery maneuver
+type Stuck struct {
+	sync.Mutex
+	Timeout time.Duration
+	// Source is the camera the optical flow is measured with
+	Source string
+	// FlowMin is the mean absolute difference between frames below which the
+	// view is still
+	FlowMin float64
+	// Flow is the mean absolute difference of the last two frames
+	Flow     float64
+	Previous *image.Gray
+	// Since is when the robot stopped making progress, zero while it moves
+	Since time.Time
+	// Started is when the recovery maneuver started, zero if it is not
+	// running
+	Started time.Time
+	// Count is the number of times the robot got stuck
+	Count int
+}
+
+// NewStuck creates a new stuck detector, a timeout of 0 disables it
+func NewStuck(timeout time.Duration, source string, flowMin float64) *Stuck {
+	return &Stuck{
+		Timeout: timeout,
+		Source:  source,
+		FlowMin: flowMin,
+	}
+}
+
+// Observe measures the optical flow as the mean absolute difference between
+// consecutive gray frames of the source
+func (s *Stuck) Observe(frame *Frame) {
+	if s.Timeout <= 0 || frame.Source != s.Source || frame.Gray == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	current := frame.Gray
+	previous := s.Previous
+	s.Previous = current
+	if previous == nil || len(previous.Pix) != len(current.Pix) {
+		return
+	}
+	sum := 0.0
+	for i, value := range current.Pix {
+		sum += math.Abs(float64(value) - float64(previous.Pix[i]))
+	}
+	s.Flow = sum / float64(len(current.Pix))
+}
+
+// Recover returns the motion of the recovery maneuver, ok is false once it is
+// over or if it is not running
+func (s *Stuck) Recover(now time.Time) (motion Motion, ok bool) {
+	s.Lock()
+	defer s.Unlock()
+	if s.Started.IsZero() {
+		return Motion{}, false
+	}
+	elapsed := now.Sub(s.Started)
+	for _, step := range Recovery {
+		if elapsed < step.Duration.Duration {
+			return step, true
+		}
+		elapsed -= step.Duration.Duration
+	}
+	fmt.Println("stuck: recovery done, returning control to the mind")
+	s.Started, s.Since = time.Time{}, time.Time{}
+	return Motion{}, false
+}
+
+// Check returns true and starts the recovery maneuver when the commanded
+// wheel speeds have made no progress for the timeout, there is no progress
+// if the view is still and the imu is flat or the wheels are stalled
+func (s *Stuck) Check(left, right float64, state RoverState, now time.Time) bool {
+	if s.Timeout <= 0 {
+		return false
+	}
+	s.Lock()
+	defer s.Unlock()
+	commanded := math.Abs(left)+math.Abs(right) > StuckCommand
+	still := s.Previous != nil && s.Flow < s.FlowMin
+	stalled := false
+	if state.Fresh(RoverStale) {
+		still = still && math.Abs(state.GX) < StuckGyro &&
+			math.Abs(state.GY) < StuckGyro && math.Abs(state.GZ) < StuckGyro
+		stalled = math.Abs(state.Left)+math.Abs(state.Right) < StuckWheels
+	}
+	if !commanded || !(still || stalled) {
+		s.Since = time.Time{}
+		return false
+	}
+	if s.Since.IsZero() {
+		s.Since = now
+		return false
+	}
+	if now.Sub(s.Since) < s.Timeout {
+		return false
+	}
+	s.Count++
+	s.Started = now
+	fmt.Printf("stuck: no progress for %v with flow %.2f stalled %t, recovering (%d)\n",
+		now.Sub(s.Since), s.Flow, stalled, s.Count)
+	return true
+}
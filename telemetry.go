@@ -0,0 +1,230 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RoverFeedback is the type of the base feedback frames of the rover
+// controller
+const RoverFeedback = 1001
+
+// RoverState is the state of the rover reported by the base feedback frames of
+// the rover controller
+type RoverState struct {
+	Type int `json:"T"`
+	// Left and Right are the speeds of the wheels
+	Left  float64 `json:"L"`
+	Right float64 `json:"R"`
+	// Roll, Pitch and Yaw are the orientation in degrees
+	Roll  float64 `json:"r"`
+	Pitch float64 `json:"p"`
+	Yaw   float64 `json:"y"`
+	// AX, AY and AZ are the raw accelerations
+	AX float64 `json:"ax"`
+	AY float64 `json:"ay"`
+	AZ float64 `json:"az"`
+	// GX, GY and GZ are the raw angular velocities
+	GX float64 `json:"gx"`
+	GY float64 `json:"gy"`
+	GZ float64 `json:"gz"`
+	// OdometryLeft and OdometryRight are the distances the wheels traveled
+	OdometryLeft  float64 `json:"odl"`
+	OdometryRight float64 `json:"odr"`
+	// Voltage is the battery voltage
+	Voltage float64 `json:"v"`
+	// Updated is when the state was reported, zero if it never was
+	Updated time.Time `json:"-"`
+}
+
+// Fresh returns true if the state was reported within the age
+func (r RoverState) Fresh(age time.Duration) bool {
+	return !r.Updated.IsZero() && time.Since(r.Updated) < age
+}
+
+// RoverStale is the age after which the base feedback is ignored
+const RoverStale = 2 * time.Second
+
+// SensorStale is the age after which the reading of a proximity sensor is
+// ignored, a sensor that stops reporting is taken for an obstacle
+const SensorStale = 500 * time.Millisecond
+
+// RoverSpeedMax is the maximum wheel speed in meters per second
+const RoverSpeedMax = .5
+
+// Wheels returns the speeds of the wheels scaled to 0..255, 128 is stopped
+func (r RoverState) Wheels() []float64 {
+	scale := func(speed float64) float64 {
+		value := 128 + 127*speed/RoverSpeedMax
+		if value < 0 {
+			value = 0
+		} else if value > 255 {
+			value = 255
+		}
+		return value
+	}
+	return []float64{scale(r.Left), scale(r.Right)}
+}
+
+// Telemetry is the latest telemetry reported by the rover over the serial
+// link as json lines
+type Telemetry struct {
+	sync.Mutex
+	Values  map[string]float64
+	Updated time.Time
+	// Times are when the values were last reported
+	Times map[string]time.Time
+	// Rover is the latest base feedback of the rover controller
+	Rover RoverState
+	// Link is true while the serial link is up
+	Link bool
+	// Outages is the number of times the serial link went down
+	Outages int
+	// Down is when the serial link last went down
+	Down time.Time
+	// LinkErr is the error that took the serial link down
+	LinkErr error
+	// Lines is called with each line read before it is parsed
+	Lines func(line []byte)
+}
+
+// NewTelemetry creates a new telemetry
+func NewTelemetry() *Telemetry {
+	return &Telemetry{
+		Values: make(map[string]float64),
+		Times:  make(map[string]time.Time),
+	}
+}
+
+// Read reads telemetry frames until the reader fails, lines that are not json
+// objects are ignored
+func (t *Telemetry) Read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if t.Lines != nil {
+			t.Lines(scanner.Bytes())
+		}
+		t.Parse(scanner.Bytes())
+	}
+	return scanner.Err()
+}
+
+// Parse parses a telemetry frame and records its numeric values
+func (t *Telemetry) Parse(line []byte) {
+	frame := make(map[string]interface{})
+	err := json.Unmarshal(line, &frame)
+	if err != nil {
+		return
+	}
+	var rover RoverState
+	if frame["T"] == float64(RoverFeedback) {
+		err := json.Unmarshal(line, &rover)
+		if err != nil {
+			return
+		}
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.Updated = time.Now()
+	for key, value := range frame {
+		if number, ok := value.(float64); ok {
+			t.Values[key], t.Times[key] = number, t.Updated
+		}
+	}
+	if rover.Type == RoverFeedback {
+		rover.Updated = t.Updated
+		t.Rover = rover
+	}
+}
+
+// SetLink records the state of the serial link, the link value is 1 while
+// the link is up and 0 while it is down
+func (t *Telemetry) SetLink(up bool, err error) {
+	t.Lock()
+	defer t.Unlock()
+	if t.Link && !up {
+		t.Outages++
+		t.Down = time.Now()
+	}
+	t.Link, t.LinkErr = up, err
+	t.Values["link"] = 0
+	if up {
+		t.Values["link"] = 1
+	}
+	t.Values["outages"] = float64(t.Outages)
+}
+
+// LinkUp returns true if the serial link is up
+func (t *Telemetry) LinkUp() bool {
+	t.Lock()
+	defer t.Unlock()
+	return t.Link
+}
+
+// ServeHTTP serves the latest telemetry values as json
+func (t *Telemetry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.Lock()
+	data, err := json.Marshal(t.Values)
+	t.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// State returns the latest base feedback of the rover controller
+func (t *Telemetry) State() RoverState {
+	t.Lock()
+	defer t.Unlock()
+	return t.Rover
+}
+
+// Set records a value, used by sensors that are not on the serial link
+func (t *Telemetry) Set(key string, value float64) {
+	t.Lock()
+	defer t.Unlock()
+	t.Updated = time.Now()
+	t.Values[key], t.Times[key] = value, t.Updated
+}
+
+// Copy returns a copy of the latest values
+func (t *Telemetry) Copy() map[string]float64 {
+	t.Lock()
+	defer t.Unlock()
+	values := make(map[string]float64, len(t.Values))
+	for key, value := range t.Values {
+		values[key] = value
+	}
+	return values
+}
+
+// Get returns the latest value of a key, ok is false if the key was never
+// reported
+func (t *Telemetry) Get(key string) (value float64, ok bool) {
+	t.Lock()
+	defer t.Unlock()
+	value, ok = t.Values[key]
+	return value, ok
+}
+
+// Fresh returns the value of a key reported within the age, ok is false if
+// the key was never reported or is stale
+func (t *Telemetry) Fresh(key string, age time.Duration) (value float64, ok bool) {
+	t.Lock()
+	defer t.Unlock()
+	value, ok = t.Values[key]
+	if !ok || time.Since(t.Times[key]) >= age {
+		return 0, false
+	}
+	return value, true
+}
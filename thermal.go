@@ -0,0 +1,72 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"image"
+	"math"
+
+	"github.com/blackjack/webcam"
+)
+
+const (
+	// ThermalY16 is the fourcc of 16 bit gray thermal frames
+	ThermalY16 = webcam.PixelFormat('Y' | '1'<<8 | '6'<<16 | ' '<<24)
+	// ThermalGrey is the fourcc of 8 bit gray thermal frames
+	ThermalGrey = webcam.PixelFormat('G' | 'R'<<8 | 'E'<<16 | 'Y'<<24)
+	// ThermalBins is the number of thermal histogram bins
+	ThermalBins = 64
+)
+
+// ThermalCamera is a thermal camera such as a lepton on a purethermal board
+// that is a v4l device with 16 or 8 bit gray frames
+type ThermalCamera struct {
+	*Camera16
+}
+
+// NewThermalCamera creates a new thermal camera
+func NewThermalCamera() *ThermalCamera {
+	return &ThermalCamera{
+		Camera16: NewCamera16(ThermalY16, ThermalGrey),
+	}
+}
+
+// Sense senses the latest thermal frame and returns the entropy of the
+// thermal histogram and the x and y of the hottest point, all scaled to 0 to
+// 255
+func (t *ThermalCamera) Sense() []float64 {
+	img := t.Get()
+	if img == nil {
+		return []float64{0, 0, 0}
+	}
+	bounds := img.Bounds()
+	min, max, hottest := uint16(65535), uint16(0), image.Point{}
+	for x := bounds.Min.X; x < bounds.Max.X; x++ {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			value := img.Gray16At(x, y).Y
+			if value < min {
+				min = value
+			}
+			if value > max {
+				max, hottest = value, image.Point{X: x, Y: y}
+			}
+		}
+	}
+	histogram := make([]float64, ThermalBins)
+	if max > min {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				value := img.Gray16At(x, y).Y
+				bin := int(value-min) * (ThermalBins - 1) / int(max-min)
+				histogram[bin]++
+			}
+		}
+	}
+	return []float64{
+		255 * Shannon(histogram) / math.Log2(ThermalBins),
+		255 * float64(hottest.X-bounds.Min.X) / float64(bounds.Dx()),
+		255 * float64(hottest.Y-bounds.Min.Y) / float64(bounds.Dy()),
+	}
+}
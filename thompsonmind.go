@@ -0,0 +1,159 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/gob"
+	"io"
+	"math"
+	"math/rand"
+)
+
+const (
+	// ThompsonLevels is the number of quantized entropy levels of a context
+	ThompsonLevels = 16
+	// ThompsonSamples is the number of samples used to estimate the action
+	// distribution
+	ThompsonSamples = 16
+)
+
+// ThompsonMind is a thompson sampling mind, the entropy reward of each action
+// in each context is modeled as a gaussian posterior
+type ThompsonMind struct {
+	Actions int
+	State   Context
+	// Counts, Sums, and Squares are the sufficient statistics of the reward of
+	// each action in each context
+	Counts      map[Context][]float64
+	Sums        map[Context][]float64
+	Squares     map[Context][]float64
+	Normalized  []float64
+	Action      int
+	Initialized bool
+	Visits      []uint64
+}
+
+// NewThompsonMind creates a new thompson sampling mind
+func NewThompsonMind(rng *rand.Rand, actions int) ThompsonMind {
+	t := ThompsonMind{
+		Actions: actions,
+	}
+	t.Reset()
+	return t
+}
+
+// sample samples the posterior of the rewards of the current context and
+// returns the best legal action
+func (t *ThompsonMind) sample(rng *rand.Rand, mask []bool) int {
+	counts, sums, squares := t.Counts[t.State], t.Sums[t.State], t.Squares[t.State]
+	action, max := -1, math.Inf(-1)
+	for i := 0; i < t.Actions; i++ {
+		if Masked(mask, i) {
+			continue
+		}
+		mean, variance := 0.0, 1.0
+		if counts != nil && counts[i] > 0 {
+			n := counts[i]
+			mean = sums[i] / (n + 1)
+			variance = (squares[i]/n - (sums[i]/n)*(sums[i]/n) + 1) / (n + 1)
+		}
+		value := mean + math.Sqrt(math.Max(variance, 0))*rng.NormFloat64()
+		if value > max {
+			action, max = i, value
+		}
+	}
+	return action
+}
+
+// Step steps the thompson sampling mind
+func (t *ThompsonMind) Step(rng *rand.Rand, observation []float64, rewards []float64, mask []bool) int {
+	entropy := Scalar(observation)
+	if t.Initialized {
+		reward := entropy/256 + Total(rewards)
+		counts, ok := t.Counts[t.State]
+		if !ok {
+			counts = make([]float64, t.Actions)
+			t.Counts[t.State] = counts
+			t.Sums[t.State] = make([]float64, t.Actions)
+			t.Squares[t.State] = make([]float64, t.Actions)
+		}
+		counts[t.Action]++
+		t.Sums[t.State][t.Action] += reward
+		t.Squares[t.State][t.Action] += reward * reward
+	}
+	t.State[0], t.State[1] = t.State[1], Quantize(observation, ThompsonLevels)
+
+	legal := false
+	for i := 0; i < t.Actions; i++ {
+		if !Masked(mask, i) {
+			legal = true
+			break
+		}
+	}
+	if !legal {
+		mask = nil
+	}
+	action := t.sample(rng, mask)
+	t.Normalized = make([]float64, t.Actions)
+	t.Normalized[action]++
+	for i := 1; i < ThompsonSamples; i++ {
+		t.Normalized[t.sample(rng, mask)]++
+	}
+	for i := range t.Normalized {
+		t.Normalized[i] /= ThompsonSamples
+	}
+	t.Action = action
+	t.Initialized = true
+	t.Visits[action]++
+	return action
+}
+
+// Reset resets the thompson sampling mind
+func (t *ThompsonMind) Reset() {
+	t.State = Context{}
+	t.Counts = make(map[Context][]float64)
+	t.Sums = make(map[Context][]float64)
+	t.Squares = make(map[Context][]float64)
+	t.Normalized = nil
+	t.Action = 0
+	t.Initialized = false
+	t.Visits = make([]uint64, t.Actions)
+}
+
+// Introspect returns a snapshot of the thompson sampling mind, the estimates
+// are the posterior mean rewards of the current context
+func (t *ThompsonMind) Introspect() Introspection {
+	estimates := make([]float64, t.Actions)
+	if counts, ok := t.Counts[t.State]; ok {
+		for i, count := range counts {
+			estimates[i] = t.Sums[t.State][i] / (count + 1)
+		}
+	}
+	introspection := NewIntrospection(t.Action, t.Normalized, t.Visits, estimates)
+	introspection.Details["contexts"] = float64(len(t.Counts))
+	return introspection
+}
+
+// Save saves the thompson sampling mind
+func (t *ThompsonMind) Save(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(t)
+}
+
+// Load loads the thompson sampling mind
+func (t *ThompsonMind) Load(r io.Reader) error {
+	*t = ThompsonMind{}
+	err := gob.NewDecoder(r).Decode(t)
+	if t.Counts == nil {
+		t.Counts = make(map[Context][]float64)
+	}
+	if t.Sums == nil {
+		t.Sums = make(map[Context][]float64)
+	}
+	if t.Squares == nil {
+		t.Squares = make(map[Context][]float64)
+	}
+	t.Visits = visits(t.Visits, t.Actions)
+	return err
+}
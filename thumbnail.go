@@ -0,0 +1,132 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"sync"
+
+	"github.com/nfnt/resize"
+)
+
+const (
+	// ThumbNearest samples the nearest pixel of each block
+	ThumbNearest = "nearest"
+	// ThumbBox averages the pixels of each block
+	ThumbBox = "box"
+	// ThumbBilinear resizes with bilinear interpolation
+	ThumbBilinear = "bilinear"
+	// ThumbLanczos resizes with lanczos3 interpolation
+	ThumbLanczos = "lanczos"
+)
+
+// Thumbnails is the thumbnailer of the frames of the cameras
+var Thumbnails = &Thumbnailer{Scale: 16, Method: ThumbNearest}
+
+// Thumbnailer downsamples the frames of the cameras into thumbnails, the gray
+// thumbnail of a frame is the luma plane of its thumbnail so it isn't
+// allocated separately
+type Thumbnailer struct {
+	// Scale is the factor the frames are downsampled by
+	Scale  int
+	Method string
+	// Pool keeps the thumbnails of the dropped frames for the next frames
+	Pool sync.Pool
+}
+
+// NewThumbnailer creates a new thumbnailer
+func NewThumbnailer(scale int, method string) (*Thumbnailer, error) {
+	if scale < 1 {
+		return nil, fmt.Errorf("invalid thumbnail scale %d", scale)
+	}
+	switch method {
+	case ThumbNearest, ThumbBox, ThumbBilinear, ThumbLanczos:
+	default:
+		return nil, fmt.Errorf("unknown thumbnail method %s", method)
+	}
+	return &Thumbnailer{Scale: scale, Method: method}, nil
+}
+
+// Thumbnail downsamples a frame
+func (t *Thumbnailer) Thumbnail(frame *image.YCbCr) *image.YCbCr {
+	bounds := frame.Bounds()
+	width, height := bounds.Dx()/t.Scale, bounds.Dy()/t.Scale
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	switch t.Method {
+	case ThumbBilinear:
+		return YCbCr(resize.Resize(uint(width), uint(height), frame, resize.Bilinear))
+	case ThumbLanczos:
+		return YCbCr(resize.Resize(uint(width), uint(height), frame, resize.Lanczos3))
+	}
+	thumb := t.get(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			x0, y0 := bounds.Min.X+x*t.Scale, bounds.Min.Y+y*t.Scale
+			i := thumb.YOffset(x, y)
+			if t.Method == ThumbNearest {
+				cx, cy := x0+t.Scale/2, y0+t.Scale/2
+				if cx >= bounds.Max.X {
+					cx = bounds.Max.X - 1
+				}
+				if cy >= bounds.Max.Y {
+					cy = bounds.Max.Y - 1
+				}
+				c := frame.COffset(cx, cy)
+				thumb.Y[i], thumb.Cb[i], thumb.Cr[i] = frame.Y[frame.YOffset(cx, cy)], frame.Cb[c], frame.Cr[c]
+				continue
+			}
+			luma, blue, red, count := 0, 0, 0, 0
+			for yy := y0; yy < y0+t.Scale && yy < bounds.Max.Y; yy++ {
+				for xx := x0; xx < x0+t.Scale && xx < bounds.Max.X; xx++ {
+					c := frame.COffset(xx, yy)
+					luma += int(frame.Y[frame.YOffset(xx, yy)])
+					blue += int(frame.Cb[c])
+					red += int(frame.Cr[c])
+					count++
+				}
+			}
+			thumb.Y[i], thumb.Cb[i], thumb.Cr[i] = uint8(luma/count), uint8(blue/count), uint8(red/count)
+		}
+	}
+	return thumb
+}
+
+// get returns a thumbnail from the pool or a new one if the pool has none of
+// the size
+func (t *Thumbnailer) get(width, height int) *image.YCbCr {
+	if thumb, ok := t.Pool.Get().(*image.YCbCr); ok &&
+		thumb.Rect.Dx() == width && thumb.Rect.Dy() == height {
+		return thumb
+	}
+	return image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio444)
+}
+
+// Release returns the thumbnail of a frame nothing else holds to the pool, the
+// thumbnails of the interpolations are allocated by the resizer and are left
+// to the garbage collector
+func (t *Thumbnailer) Release(frame *Frame) {
+	if t.Method != ThumbNearest && t.Method != ThumbBox {
+		return
+	}
+	if thumb, ok := frame.Thumb.(*image.YCbCr); ok && thumb.SubsampleRatio == image.YCbCrSubsampleRatio444 {
+		t.Pool.Put(thumb)
+	}
+}
+
+// Gray returns the luma plane of a thumbnail as a gray image, the pixels are
+// shared with the thumbnail
+func Gray(thumb *image.YCbCr) *image.Gray {
+	return &image.Gray{
+		Pix:    thumb.Y,
+		Stride: thumb.YStride,
+		Rect:   thumb.Rect,
+	}
+}
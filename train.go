@@ -0,0 +1,117 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LoadObservations loads a recording of sensor observations, one per line
+// with the values separated by commas or spaces, anything after a semicolon
+// is ignored
+func LoadObservations(path string) ([][]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var observations [][]float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if index := strings.Index(line, ";"); index >= 0 {
+			line = line[:index]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		observation := make([]float64, len(fields))
+		for i, field := range fields {
+			observation[i], err = strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		observations = append(observations, observation)
+	}
+	return observations, scanner.Err()
+}
+
+// WriteObservation writes an observation and the selected action in the
+// recording format, the frames the observation is of are referenced by their
+// source, sequence number and capture time in unix nanoseconds
+func WriteObservation(w io.Writer, observation []float64, action int, frames ...Frame) error {
+	fields := make([]string, len(observation))
+	for i, value := range observation {
+		fields[i] = strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	references := ""
+	for _, frame := range frames {
+		references += fmt.Sprintf(" ; %s %d %d", frame.Source, frame.Sequence, frame.Time.UnixNano())
+	}
+	_, err := fmt.Fprintf(w, "%s ; %d%s\n", strings.Join(fields, " "), action, references)
+	return err
+}
+
+// Train pre-trains a robot mind by replaying random segments of a recording
+// of sensor observations and saves it as a checkpoint
+func Train(path string) {
+	observations, err := LoadObservations(path)
+	if err != nil {
+		panic(err)
+	}
+	if len(observations) == 0 {
+		panic(fmt.Errorf("no observations in %s", path))
+	}
+	rng := rand.New(rand.NewSource(*FlagSeed))
+	mind, err := NewMind(*FlagMind, rng, int(ActionCount))
+	if err != nil {
+		panic(err)
+	}
+	if *FlagLoad != "" {
+		err := LoadMind(mind, *FlagLoad)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	segment := *FlagTrainSegment
+	if segment <= 0 || segment > len(observations) {
+		segment = len(observations)
+	}
+	segments := (len(observations) + segment - 1) / segment
+	for epoch := 0; epoch < *FlagTrainEpochs; epoch++ {
+		for s := 0; s < segments; s++ {
+			start := rng.Intn(len(observations) - segment + 1)
+			calibration := NewCalibration(*FlagCalibration)
+			habituation := NewHabituation(*FlagHabituation)
+			for _, observation := range observations[start : start+segment] {
+				mind.Step(rng, habituation.Adapt(calibration.Normalize(observation)), nil, nil)
+			}
+		}
+		introspection := mind.Introspect()
+		fmt.Printf("epoch %d entropy %f visits %v\n", epoch, introspection.Entropy, introspection.Visits)
+	}
+
+	f, err := os.Create(*FlagTrainOutput)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	err = mind.Save(f)
+	if err != nil {
+		panic(err)
+	}
+}
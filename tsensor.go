@@ -0,0 +1,36 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "image"
+
+// TSensor is a temporal difference sensor that senses the complexity of the
+// difference between consecutive frames, so a static but complex scene senses
+// as simple
+type TSensor struct {
+	// Complexity estimates the complexity of the difference, nil is mark1
+	Complexity Complexity
+	Last       *image.Gray
+}
+
+// Sense senses the difference between the gray image of a frame and the last
+// frame
+func (t *TSensor) Sense(frame *Frame) []float64 {
+	img := frame.Gray
+	last := t.Last
+	t.Last = image.NewGray(img.Bounds())
+	copy(t.Last.Pix, img.Pix)
+	if last == nil || last.Bounds() != img.Bounds() {
+		return []float64{0}
+	}
+	difference := make([]byte, len(img.Pix))
+	for i, value := range img.Pix {
+		difference[i] = value - last.Pix[i]
+	}
+	if t.Complexity == nil {
+		t.Complexity = &CompressorComplexity{Compressor: Mark1Compressor{}}
+	}
+	return []float64{255 * float64(t.Complexity.Complexity(difference)) / float64(len(difference))}
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/gob"
+	"io"
+	"math"
+	"math/rand"
+)
+
+// UCBMind is an upper confidence bound bandit mind, the actions are the arms
+// and the reward is the change in entropy
+type UCBMind struct {
+	Actions     int
+	Counts      []float64
+	Values      []float64
+	Total       float64
+	Action      int
+	Entropy     float64
+	Initialized bool
+}
+
+// NewUCBMind creates a new upper confidence bound mind
+func NewUCBMind(rng *rand.Rand, actions int) UCBMind {
+	u := UCBMind{
+		Actions: actions,
+	}
+	u.Reset()
+	return u
+}
+
+// Step steps the upper confidence bound mind
+func (u *UCBMind) Step(rng *rand.Rand, observation []float64, rewards []float64, mask []bool) int {
+	entropy := Scalar(observation)
+	if u.Initialized {
+		reward := (entropy-u.Entropy)/256 + Total(rewards)
+		u.Counts[u.Action]++
+		u.Total++
+		u.Values[u.Action] += (reward - u.Values[u.Action]) / u.Counts[u.Action]
+	}
+	u.Entropy = entropy
+	u.Initialized = true
+
+	legal := 0
+	for i := 0; i < u.Actions; i++ {
+		if !Masked(mask, i) {
+			legal++
+		}
+	}
+	if legal == 0 {
+		mask = nil
+	}
+
+	var untried []int
+	for i, count := range u.Counts {
+		if count == 0 && !Masked(mask, i) {
+			untried = append(untried, i)
+		}
+	}
+	if len(untried) > 0 {
+		u.Action = untried[rng.Intn(len(untried))]
+		return u.Action
+	}
+
+	action, max := 0, math.Inf(-1)
+	for i, value := range u.Values {
+		if Masked(mask, i) {
+			continue
+		}
+		bound := value + math.Sqrt(2*math.Log(u.Total)/u.Counts[i])
+		if bound > max {
+			action, max = i, bound
+		}
+	}
+	u.Action = action
+	return action
+}
+
+// Reset resets the upper confidence bound mind
+func (u *UCBMind) Reset() {
+	u.Counts = make([]float64, u.Actions)
+	u.Values = make([]float64, u.Actions)
+	u.Total = 0
+	u.Action = 0
+	u.Entropy = 0
+	u.Initialized = false
+}
+
+// Introspect returns a snapshot of the upper confidence bound mind, the
+// distribution is deterministic and the estimates are the mean rewards
+func (u *UCBMind) Introspect() Introspection {
+	distribution := make([]float64, u.Actions)
+	distribution[u.Action] = 1
+	visits := make([]uint64, u.Actions)
+	for i, count := range u.Counts {
+		visits[i] = uint64(count)
+	}
+	introspection := NewIntrospection(u.Action, distribution, visits, u.Values)
+	introspection.Details["total"] = u.Total
+	return introspection
+}
+
+// Save saves the upper confidence bound mind
+func (u *UCBMind) Save(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(u)
+}
+
+// Load loads the upper confidence bound mind
+func (u *UCBMind) Load(r io.Reader) error {
+	*u = UCBMind{}
+	err := gob.NewDecoder(r).Decode(u)
+	if u.Counts == nil {
+		u.Counts = make([]float64, u.Actions)
+	}
+	if u.Values == nil {
+		u.Values = make([]float64, u.Actions)
+	}
+	return err
+}
@@ -5,15 +5,18 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"image"
-	"image/color"
+	"image/jpeg"
+	"os"
+	"path/filepath"
 	"runtime"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/blackjack/webcam"
-	"github.com/nfnt/resize"
 )
 
 // FrameSizes is a slice of FrameSize
@@ -36,28 +39,248 @@ func (slice FrameSizes) Swap(i, j int) {
 	slice[i], slice[j] = slice[j], slice[i]
 }
 
+const (
+	// MJPEG is the fourcc of motion jpeg frames
+	MJPEG = webcam.PixelFormat('M' | 'J'<<8 | 'P'<<16 | 'G'<<24)
+	// YUYV is the fourcc of yuyv 4:2:2 frames
+	YUYV = webcam.PixelFormat('Y' | 'U'<<8 | 'Y'<<16 | 'V'<<24)
+	// H264 is the fourcc of h.264 frames
+	H264 = webcam.PixelFormat('H' | '2'<<8 | '6'<<16 | '4'<<24)
+	// CameraBackoffMin is the initial delay before reconnecting a camera
+	CameraBackoffMin = 250 * time.Millisecond
+	// CameraBackoffMax is the maximum delay before reconnecting a camera
+	CameraBackoffMax = 8 * time.Second
+	// CameraTimeouts is the number of consecutive frame timeouts after which
+	// a camera is reconnected
+	CameraTimeouts = 4
+)
+
+// NewFrame creates a frame with a thumbnail and a gray thumbnail from a full
+// size image
+func NewFrame(source string, yuyv *image.YCbCr, encoded []byte) Frame {
+	thumb := Thumbnails.Thumbnail(yuyv)
+	return Frame{
+		Source:  source,
+		Frame:   yuyv,
+		Thumb:   thumb,
+		Gray:    Gray(thumb),
+		Encoded: encoded,
+	}
+}
+
 // V4LCamera is a camera that is from a v4l device
 type V4LCamera struct {
+	FrameCounters
+	sync.Mutex
+	// camera is the open device
+	camera *webcam.Webcam
 	Stream bool
 	Images chan Frame
+	// Source is the name the frames are tagged with
+	Source string
+	// Device is the v4l device
+	Device string
+	// ID is the stable path of the device in /dev/v4l/by-id, empty until the
+	// device is found or if it has none
+	ID string
+	// Width, Height and FPS are the requested frame size and rate, 0 is the
+	// smallest frame size and the default rate
+	Width, Height, FPS int
+	// MJPEG streams motion jpeg frames instead of yuyv
+	MJPEG bool
+	// Decode decodes the motion jpeg frames, without decoding only the
+	// encoded frame is available
+	Decode bool
+	// Hardware decodes the compressed frames in a stream decoder instead of
+	// in go
+	Hardware bool
+	// H264 streams h.264 frames, which are only decoded by the stream
+	// decoder
+	H264 bool
+	// Status receives the connection status events
+	Status chan<- CameraStatus
+	// Controls are set each time the device is opened
+	Controls CameraControls
 }
 
-// NewV4LCamera creates a new v4l camera
-func NewV4LCamera() *V4LCamera {
+// V4LDevice is the default v4l device
+const V4LDevice = "/dev/video0"
+
+// NewV4LCamera creates a new v4l camera, an empty device is the default device
+func NewV4LCamera(device string, width, height, fps int) *V4LCamera {
+	if device == "" {
+		device = V4LDevice
+	}
 	return &V4LCamera{
 		Stream: true,
 		Images: make(chan Frame, 1),
+		Device: device,
+		Width:  width,
+		Height: height,
+		FPS:    fps,
+		Decode: true,
+		Controls: CameraControls{
+			Exposure:     -1,
+			Gain:         -1,
+			WhiteBalance: -1,
+		},
+	}
+}
+
+// SetControl sets a control of the open device
+func (vc *V4LCamera) SetControl(id webcam.ControlID, value int32) error {
+	vc.Lock()
+	defer vc.Unlock()
+	if vc.camera == nil {
+		return fmt.Errorf("%s is not open", vc.Device)
+	}
+	return vc.camera.SetControl(id, value)
+}
+
+// GetControl gets a control of the open device
+func (vc *V4LCamera) GetControl(id webcam.ControlID) (int32, error) {
+	vc.Lock()
+	defer vc.Unlock()
+	if vc.camera == nil {
+		return 0, fmt.Errorf("%s is not open", vc.Device)
+	}
+	return vc.camera.GetControl(id)
+}
+
+// Frames returns the channel the frames are streamed to
+func (vc *V4LCamera) Frames() chan Frame {
+	return vc.Images
+}
+
+// Size returns the supported frame size closest to the requested size
+func (vc *V4LCamera) Size(sizes FrameSizes) (width, height uint32) {
+	sort.Sort(sizes)
+	if vc.Width <= 0 || vc.Height <= 0 {
+		return sizes[0].MaxWidth, sizes[0].MaxHeight
+	}
+	fit := func(value int, min, max, step uint32) uint32 {
+		v := uint32(value)
+		if v < min {
+			v = min
+		} else if v > max {
+			v = max
+		}
+		if step > 0 {
+			v = min + (v-min)/step*step
+		}
+		return v
 	}
+	best := int64(-1)
+	for _, size := range sizes {
+		w := fit(vc.Width, size.MinWidth, size.MaxWidth, size.StepWidth)
+		h := fit(vc.Height, size.MinHeight, size.MaxHeight, size.StepHeight)
+		dw, dh := int64(w)-int64(vc.Width), int64(h)-int64(vc.Height)
+		if distance := dw*dw + dh*dh; best < 0 || distance < best {
+			best, width, height = distance, w, h
+		}
+	}
+	return width, height
 }
 
-// Start starts streaming
-func (vc *V4LCamera) Start(device string) {
+// Start streams frames, the camera is reconnected with exponential backoff
+// when the device disconnects or fails and the connection status is published
+func (vc *V4LCamera) Start() {
 	runtime.LockOSThread()
+	backoff := CameraBackoffMin
+	for vc.Stream {
+		device := vc.Enumerate()
+		frames, err := vc.stream(device)
+		if !vc.Stream {
+			break
+		}
+		vc.publish(CameraStatus{Source: vc.Source, Device: device, Err: err})
+		if frames > 0 {
+			backoff = CameraBackoffMin
+		}
+		fmt.Println(vc.Source, device, err, "reconnecting in", backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > CameraBackoffMax {
+			backoff = CameraBackoffMax
+		}
+	}
+}
+
+// Enumerate returns the stable path of the camera in /dev/v4l/by-id once it
+// is known, otherwise the configured device, so a camera that reappears under
+// another name is found and another camera is never opened in its place
+func (vc *V4LCamera) Enumerate() string {
+	if vc.ID != "" {
+		return vc.ID
+	}
+	if _, err := os.Stat(vc.Device); err == nil {
+		vc.ID = Identify(vc.Device)
+	}
+	return vc.Device
+}
+
+// Identify returns the path in /dev/v4l/by-id that links to the device, empty
+// if there is none
+func Identify(device string) string {
+	target, err := filepath.EvalSymlinks(device)
+	if err != nil {
+		return ""
+	}
+	links, err := filepath.Glob("/dev/v4l/by-id/*")
+	if err != nil {
+		return ""
+	}
+	sort.Strings(links)
+	for _, link := range links {
+		if resolved, err := filepath.EvalSymlinks(link); err == nil && resolved == target {
+			return link
+		}
+	}
+	return ""
+}
+
+// publish publishes a status event, the events are never dropped so a
+// disconnect or a reconnect is not missed
+func (vc *V4LCamera) publish(status CameraStatus) {
+	if vc.Status == nil {
+		return
+	}
+	vc.Status <- status
+}
+
+// exposure returns the exposure of the frames, 0 if it is automatic
+func (vc *V4LCamera) exposure(auto *AutoExposure) int32 {
+	if auto != nil {
+		return auto.Value
+	} else if vc.Controls.Exposure >= 0 {
+		return vc.Controls.Exposure
+	}
+	return 0
+}
+
+// frame creates a frame and adjusts the exposure
+func (vc *V4LCamera) frame(yuyv *image.YCbCr, encoded []byte, auto *AutoExposure) Frame {
+	img := NewFrame(vc.Source, yuyv, encoded)
+	img.Exposure = vc.exposure(auto)
+	if auto != nil {
+		if exposure, ok := auto.Adjust(img.Gray); ok {
+			err := vc.SetControl(ControlExposure, exposure)
+			if err != nil {
+				fmt.Println(vc.Device, "exposure", err)
+			}
+		}
+	}
+	return img
+}
+
+// stream streams frames from a device until it fails and returns the number
+// of frames streamed
+func (vc *V4LCamera) stream(device string) (int, error) {
 	skip := 0
 	fmt.Println(device)
 	camera, err := webcam.Open(device)
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
 	defer camera.Close()
 
@@ -73,7 +296,32 @@ func (vc *V4LCamera) Start(device string) {
 	for i, value := range formats {
 		fmt.Printf("[%d] %s\n", i+1, format_desc[value])
 	}
-	format := formats[1]
+	// yuyv is preferred unless motion jpeg is requested, each falls back to
+	// the other, h.264 falls back to both
+	preferred := []webcam.PixelFormat{YUYV, MJPEG}
+	if vc.MJPEG {
+		preferred = []webcam.PixelFormat{MJPEG, YUYV}
+	}
+	if vc.H264 && vc.Hardware && vc.Decode {
+		preferred = append([]webcam.PixelFormat{H264}, preferred...)
+	}
+	format, found := webcam.PixelFormat(0), false
+	for _, f := range preferred {
+		if _, ok := format_desc[f]; ok {
+			format, found = f, true
+			break
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("%s supports neither yuyv nor motion jpeg", device)
+	}
+	if vc.H264 && format != H264 {
+		fmt.Printf("falling back to %s\n", format_desc[format])
+	} else if format != H264 && (format == MJPEG) != vc.MJPEG {
+		fmt.Printf("falling back to %s\n", format_desc[format])
+		vc.MJPEG = format == MJPEG
+		vc.Decode = true
+	}
 
 	fmt.Printf("Supported frame sizes for format %s\n", format_desc[format])
 	frames := FrameSizes(camera.GetSupportedFrameSizes(format))
@@ -81,46 +329,106 @@ func (vc *V4LCamera) Start(device string) {
 	for i, value := range frames {
 		fmt.Printf("[%d] %s\n", i+1, value.GetString())
 	}
-	size := frames[0]
+	if len(frames) == 0 {
+		return 0, fmt.Errorf("%s has no frame sizes", device)
+	}
+	width, height := vc.Size(frames)
 
-	f, w, h, err := camera.SetImageFormat(format, uint32(size.MaxWidth), uint32(size.MaxHeight))
+	f, w, h, err := camera.SetImageFormat(format, width, height)
 	if err != nil {
-		panic(err)
-	} else {
-		fmt.Printf("Resulting image format: %s (%dx%d)\n", format_desc[f], w, h)
+		return 0, err
+	}
+	fmt.Printf("Resulting image format: %s (%dx%d)\n", format_desc[f], w, h)
+	if vc.FPS > 0 {
+		err := camera.SetFramerate(float32(vc.FPS))
+		if err != nil {
+			fmt.Println(device, "framerate", err)
+		}
 	}
+	vc.Controls.Apply(camera)
+	var auto *AutoExposure
+	if vc.Controls.Auto {
+		var ok bool
+		auto, ok = NewAutoExposure(camera)
+		if !ok {
+			fmt.Println(device, "has no exposure control")
+		}
+	}
+	vc.Lock()
+	vc.camera = camera
+	vc.Unlock()
+	defer func() {
+		vc.Lock()
+		vc.camera = nil
+		vc.Unlock()
+	}()
 
 	err = camera.StartStreaming()
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
 	defer camera.StopStreaming()
+	vc.publish(CameraStatus{Source: vc.Source, Device: device, Connected: true})
+
+	var decoder *StreamDecoder
+	if vc.Hardware && vc.Decode && (format == MJPEG || format == H264) {
+		codec := "mjpeg"
+		if format == H264 {
+			codec = "h264"
+		}
+		decoder, err = NewStreamDecoder(codec, int(w), int(h))
+		if err != nil {
+			return 0, err
+		}
+		defer decoder.Close()
+		go func() {
+			for {
+				yuyv, err := decoder.Read()
+				if err != nil {
+					vc.DecodeError()
+					fmt.Println(device, err)
+					return
+				}
+				vc.Send(vc.Images, vc.frame(yuyv, nil, auto))
+			}
+		}()
+	}
 
 	var cp []byte
-	start, count := time.Now(), 0.0
-	_ = start
+	count, timeouts := 0, 0
 	for vc.Stream {
 		err := camera.WaitForFrame(5)
 
 		switch err.(type) {
 		case nil:
+			timeouts = 0
 		case *webcam.Timeout:
 			fmt.Println(device, err)
+			timeouts++
+			if timeouts >= CameraTimeouts {
+				return count, err
+			}
 			continue
 		default:
-			panic(err)
+			return count, err
 		}
 
 		frame, err := camera.ReadFrame()
 		if err != nil {
-			fmt.Println(device, err)
-			continue
-		} else {
-			//fmt.Println(device)
+			return count, err
 		}
+		captured := time.Now()
 		count++
 
-		//fmt.Println(device, count/float64(time.Since(start).Seconds()))
+		if decoder != nil {
+			// every frame is decoded since h.264 frames depend on the
+			// previous frames
+			err := decoder.Write(frame)
+			if err != nil {
+				return count, err
+			}
+			continue
+		}
 
 		if skip < 20 {
 			skip++
@@ -133,35 +441,49 @@ func (vc *V4LCamera) Start(device string) {
 				cp = make([]byte, len(frame))
 			}
 			copy(cp, frame)
-			//fmt.Printf("Frame: %d bytes\n", len(cp))
-			yuyv := image.NewYCbCr(image.Rect(0, 0, int(w), int(h)), image.YCbCrSubsampleRatio422)
-			for i := range yuyv.Cb {
-				ii := i * 4
-				yuyv.Y[i*2] = cp[ii]
-				yuyv.Y[i*2+1] = cp[ii+2]
-				yuyv.Cb[i] = cp[ii+1]
-				yuyv.Cr[i] = cp[ii+3]
-
+			if vc.MJPEG && !vc.Decode {
+				vc.Send(vc.Images, Frame{
+					Source:   vc.Source,
+					Time:     captured,
+					Exposure: vc.exposure(auto),
+					Encoded:  append([]byte(nil), frame...),
+				})
+				continue
 			}
-			thumb := resize.Resize(uint(w)/16, uint(h)/16, yuyv, resize.NearestNeighbor)
-			gray := image.NewGray(thumb.Bounds())
-			dx := thumb.Bounds().Dx()
-			dy := thumb.Bounds().Dy()
-			for x := 0; x < dx; x++ {
-				for y := 0; y < dy; y++ {
-					gray.Set(x, y, color.GrayModel.Convert(thumb.At(x, y)))
+			var yuyv *image.YCbCr
+			if vc.MJPEG {
+				img, err := jpeg.Decode(bytes.NewReader(frame))
+				if err != nil {
+					vc.DecodeError()
+					fmt.Println(device, err)
+					continue
 				}
-			}
+				var ok bool
+				yuyv, ok = img.(*image.YCbCr)
+				if !ok {
+					vc.DecodeError()
+					fmt.Println(device, "motion jpeg frame is not ycbcr")
+					continue
+				}
+			} else {
+				yuyv = image.NewYCbCr(image.Rect(0, 0, int(w), int(h)), image.YCbCrSubsampleRatio422)
+				for i := range yuyv.Cb {
+					ii := i * 4
+					yuyv.Y[i*2] = cp[ii]
+					yuyv.Y[i*2+1] = cp[ii+2]
+					yuyv.Cb[i] = cp[ii+1]
+					yuyv.Cr[i] = cp[ii+3]
 
-			select {
-			case vc.Images <- Frame{
-				Frame: yuyv,
-				Thumb: thumb,
-				Gray:  gray,
-			}:
-			default:
-				//fmt.Println("drop", device)
+				}
+			}
+			var encoded []byte
+			if vc.MJPEG {
+				encoded = append([]byte(nil), frame...)
 			}
+			img := vc.frame(yuyv, encoded, auto)
+			img.Time = captured
+			vc.Send(vc.Images, img)
 		}
 	}
+	return count, nil
 }
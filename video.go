@@ -0,0 +1,181 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	// VideoRate is the frame rate of the recorded videos if the camera has
+	// no frame rate
+	VideoRate = 10
+	// VideoBar is the height of the entropy bar burned into the videos
+	VideoBar = 8
+)
+
+// VideoRecorder encodes the frames the mind acts on into an h.264 mp4 video
+// with ffmpeg, the entropy is burned in as a bar along the bottom and the
+// action and entropy of each frame are stored in a subtitle track
+type VideoRecorder struct {
+	sync.Mutex
+	Path string
+	// Encoder is the ffmpeg h.264 encoder, h264_v4l2m2m is the hardware
+	// encoder of the raspberry pi
+	Encoder       string
+	FPS           int
+	Width, Height int
+	Frames        int
+	Cmd           *exec.Cmd
+	Input         io.WriteCloser
+	Subtitles     *os.File
+	// Closed is true once the video is closed, later frames are skipped
+	Closed bool
+}
+
+// NewVideoRecorder creates a new video recorder, the encoder is started by
+// the first frame
+func NewVideoRecorder(path, encoder string, fps int) (*VideoRecorder, error) {
+	if fps <= 0 {
+		fps = VideoRate
+	}
+	subtitles, err := os.Create(path + ".srt")
+	if err != nil {
+		return nil, err
+	}
+	return &VideoRecorder{
+		Path:      path,
+		Encoder:   encoder,
+		FPS:       fps,
+		Subtitles: subtitles,
+	}, nil
+}
+
+// start starts the encoder for a frame size
+func (v *VideoRecorder) start(width, height int) error {
+	v.Width, v.Height = width, height
+	v.Cmd = exec.Command("ffmpeg", "-y", "-hide_banner", "-loglevel", "error",
+		"-f", "rawvideo", "-pix_fmt", "yuv420p", "-s", fmt.Sprintf("%dx%d", width, height),
+		"-r", fmt.Sprint(v.FPS), "-i", "pipe:0",
+		"-c:v", v.Encoder, "-pix_fmt", "yuv420p", v.Path+".video.mp4")
+	input, err := v.Cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	v.Input = input
+	return v.Cmd.Start()
+}
+
+// Write writes a frame with the entropy and action of the step, frames of
+// another size than the first frame are skipped
+func (v *VideoRecorder) Write(frame *image.YCbCr, entropy float64, action TypeAction) error {
+	if v == nil || frame == nil {
+		return nil
+	}
+	v.Lock()
+	defer v.Unlock()
+	if v.Closed {
+		return nil
+	}
+	bounds := frame.Bounds()
+	// i420 chroma is subsampled by two
+	width, height := bounds.Dx()&^1, bounds.Dy()&^1
+	if v.Cmd == nil {
+		err := v.start(width, height)
+		if err != nil {
+			return err
+		}
+	}
+	if width != v.Width || height != v.Height {
+		return nil
+	}
+	i420 := I420(frame.SubImage(image.Rect(bounds.Min.X, bounds.Min.Y,
+		bounds.Min.X+width, bounds.Min.Y+height)).(*image.YCbCr))
+	fill := entropy / 256
+	if fill > 1 {
+		fill = 1
+	} else if fill < 0 {
+		fill = 0
+	}
+	for y := height - VideoBar; y < height; y++ {
+		for x := 0; x < int(fill*float64(width)); x++ {
+			i420.Y[i420.YOffset(x, y)] = 255
+		}
+	}
+	for _, plane := range [][]byte{i420.Y, i420.Cb, i420.Cr} {
+		_, err := v.Input.Write(plane)
+		if err != nil {
+			return err
+		}
+	}
+
+	timecode := func(frames int) string {
+		t := time.Duration(frames) * time.Second / time.Duration(v.FPS)
+		return fmt.Sprintf("%02d:%02d:%02d,%03d", int(t.Hours()), int(t.Minutes())%60,
+			int(t.Seconds())%60, t.Milliseconds()%1000)
+	}
+	_, err := fmt.Fprintf(v.Subtitles, "%d\n%s --> %s\n%s %.2f\n\n", v.Frames+1,
+		timecode(v.Frames), timecode(v.Frames+1), action, entropy)
+	v.Frames++
+	return err
+}
+
+// Close stops the encoder and muxes the video and the subtitles into the mp4
+func (v *VideoRecorder) Close() error {
+	if v == nil {
+		return nil
+	}
+	v.Lock()
+	defer v.Unlock()
+	if v.Closed {
+		return nil
+	}
+	v.Closed = true
+	err := v.Subtitles.Close()
+	if err != nil {
+		return err
+	}
+	if v.Cmd == nil {
+		return os.Remove(v.Subtitles.Name())
+	}
+	v.Input.Close()
+	err = v.Cmd.Wait()
+	if err != nil {
+		return err
+	}
+	video := v.Path + ".video.mp4"
+	err = exec.Command("ffmpeg", "-y", "-hide_banner", "-loglevel", "error",
+		"-i", video, "-i", v.Subtitles.Name(), "-map", "0", "-map", "1",
+		"-c", "copy", "-c:s", "mov_text", v.Path).Run()
+	if err != nil {
+		return err
+	}
+	os.Remove(video)
+	return os.Remove(v.Subtitles.Name())
+}
+
+// I420 returns a frame with 4:2:0 chroma subsampling with its origin at zero,
+// the frame is always copied
+func I420(frame *image.YCbCr) *image.YCbCr {
+	bounds := frame.Bounds()
+	i420 := image.NewYCbCr(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), image.YCbCrSubsampleRatio420)
+	for y := 0; y < bounds.Dy(); y++ {
+		copy(i420.Y[y*i420.YStride:y*i420.YStride+bounds.Dx()], frame.Y[frame.YOffset(bounds.Min.X, bounds.Min.Y+y):])
+	}
+	for y := 0; y < bounds.Dy(); y += 2 {
+		for x := 0; x < bounds.Dx(); x += 2 {
+			c := frame.COffset(bounds.Min.X+x, bounds.Min.Y+y)
+			i := i420.COffset(x, y)
+			i420.Cb[i], i420.Cr[i] = frame.Cb[c], frame.Cr[c]
+		}
+	}
+	return i420
+}
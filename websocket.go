@@ -0,0 +1,176 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	// WebSocketGUID is appended to the key of the handshake
+	WebSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// WebSocketMax is the maximum size of a message
+	WebSocketMax = 1 << 16
+)
+
+// WebSocket opcodes
+const (
+	WebSocketContinuation = 0x0
+	WebSocketText         = 0x1
+	WebSocketBinary       = 0x2
+	WebSocketClose        = 0x8
+	WebSocketPing         = 0x9
+	WebSocketPong         = 0xA
+)
+
+// WebSocket is the server side of a websocket connection
+type WebSocket struct {
+	sync.Mutex
+	Conn   net.Conn
+	Reader *bufio.Reader
+}
+
+// UpgradeWebSocket upgrades an http request from the same origin to a
+// websocket connection
+func UpgradeWebSocket(w http.ResponseWriter, r *http.Request) (*WebSocket, error) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return nil, fmt.Errorf("not a websocket request")
+	}
+	// a browser sends the origin of the page, a page of another site is
+	// rejected
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !strings.EqualFold(u.Host, r.Host) {
+			return nil, fmt.Errorf("websocket from a foreign origin %s", origin)
+		}
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, fmt.Errorf("missing websocket key")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("the connection can't be hijacked")
+	}
+	conn, buffer, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	hash := sha1.Sum([]byte(key + WebSocketGUID))
+	_, err = fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(hash[:]))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &WebSocket{
+		Conn:   conn,
+		Reader: buffer.Reader,
+	}, nil
+}
+
+// Read reads the next text or binary message, pings are answered and a close
+// returns io.EOF
+func (ws *WebSocket) Read() ([]byte, error) {
+	var message []byte
+	for {
+		header := make([]byte, 2)
+		_, err := io.ReadFull(ws.Reader, header)
+		if err != nil {
+			return nil, err
+		}
+		fin, opcode := header[0]&0x80 != 0, header[0]&0x0F
+		masked, length := header[1]&0x80 != 0, uint64(header[1]&0x7F)
+		switch length {
+		case 126:
+			extended := make([]byte, 2)
+			_, err = io.ReadFull(ws.Reader, extended)
+			length = uint64(binary.BigEndian.Uint16(extended))
+		case 127:
+			extended := make([]byte, 8)
+			_, err = io.ReadFull(ws.Reader, extended)
+			length = binary.BigEndian.Uint64(extended)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// the length is checked alone first so a huge length can't wrap
+		// around the sum
+		if length > WebSocketMax || length+uint64(len(message)) > WebSocketMax {
+			return nil, fmt.Errorf("websocket message too large")
+		}
+		mask := make([]byte, 4)
+		if masked {
+			_, err = io.ReadFull(ws.Reader, mask)
+			if err != nil {
+				return nil, err
+			}
+		}
+		payload := make([]byte, length)
+		_, err = io.ReadFull(ws.Reader, payload)
+		if err != nil {
+			return nil, err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+		switch opcode {
+		case WebSocketClose:
+			ws.write(WebSocketClose, nil)
+			return nil, io.EOF
+		case WebSocketPing:
+			err := ws.write(WebSocketPong, payload)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		case WebSocketPong:
+			continue
+		}
+		message = append(message, payload...)
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// Write writes a text message
+func (ws *WebSocket) Write(message []byte) error {
+	return ws.write(WebSocketText, message)
+}
+
+// write writes an unmasked frame
+func (ws *WebSocket) write(opcode byte, payload []byte) error {
+	frame := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		frame = append(frame, byte(length))
+	case length <= 0xFFFF:
+		frame = append(frame, 126, byte(length>>8), byte(length))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	ws.Lock()
+	defer ws.Unlock()
+	_, err := ws.Conn.Write(append(frame, payload...))
+	return err
+}
+
+// Close closes the connection
+func (ws *WebSocket) Close() error {
+	return ws.Conn.Close()
+}
@@ -0,0 +1,167 @@
+// Copyright 2024 The AS Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/gob"
+	"io"
+	"math/rand"
+	"sort"
+)
+
+const (
+	// WorldLevels is the number of quantized entropy levels of a context
+	WorldLevels = 16
+	// WorldBeam is the number of actions expanded below the first level of a
+	// rollout
+	WorldBeam = 4
+	// WorldDiscount is the discount of future entropy in a rollout
+	WorldDiscount = .9
+	// WorldLearningRate is the learning rate of the transition model
+	WorldLearningRate = .1
+)
+
+// WorldMind is a mind that learns a transition model of the next entropy given
+// the context and action and plans with shallow rollouts
+type WorldMind struct {
+	Actions int
+	Depth   int
+	State   Context
+	// Model is the predicted next entropy for each context and action
+	Model       map[Context][]float64
+	Entropy     float64
+	Values      []float64
+	Normalized  []float64
+	Action      int
+	Initialized bool
+	Visits      []uint64
+	Schedule    Schedule
+}
+
+// NewWorldMind creates a new world model mind with the given rollout depth
+func NewWorldMind(rng *rand.Rand, actions, depth int) WorldMind {
+	if depth < 1 {
+		depth = 1
+	}
+	w := WorldMind{
+		Actions: actions,
+		Depth:   depth,
+	}
+	w.Reset()
+	return w
+}
+
+// predict returns the predicted next entropy of an action in a context
+func (w *WorldMind) predict(context Context, action int, entropy float64) float64 {
+	if predictions, ok := w.Model[context]; ok {
+		return predictions[action]
+	}
+	return entropy
+}
+
+// rollout returns the discounted value of the best plan of the given depth
+// starting in a context
+func (w *WorldMind) rollout(context Context, entropy float64, depth int) float64 {
+	if depth == 0 {
+		return 0
+	}
+	predictions := make([]float64, w.Actions)
+	indexes := make([]int, w.Actions)
+	for i := range predictions {
+		predictions[i] = w.predict(context, i, entropy)
+		indexes[i] = i
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return predictions[indexes[i]] > predictions[indexes[j]]
+	})
+	if len(indexes) > WorldBeam {
+		indexes = indexes[:WorldBeam]
+	}
+	best := 0.0
+	for j, i := range indexes {
+		next := Context{context[1], byte(Level(predictions[i], WorldLevels))}
+		value := predictions[i]/256 + WorldDiscount*w.rollout(next, predictions[i], depth-1)
+		if j == 0 || value > best {
+			best = value
+		}
+	}
+	return best
+}
+
+// Step steps the world model mind
+func (w *WorldMind) Step(rng *rand.Rand, observation []float64, rewards []float64, mask []bool) int {
+	entropy := Scalar(observation)
+	if w.Initialized {
+		predictions, ok := w.Model[w.State]
+		if !ok {
+			predictions = make([]float64, w.Actions)
+			for i := range predictions {
+				predictions[i] = w.Entropy
+			}
+			w.Model[w.State] = predictions
+		}
+		target := entropy + 256*Total(rewards)
+		predictions[w.Action] += WorldLearningRate * (target - predictions[w.Action])
+	}
+	w.Entropy = entropy
+	w.State[0], w.State[1] = w.State[1], byte(Level(entropy, WorldLevels))
+
+	w.Values = make([]float64, w.Actions)
+	for i := range w.Values {
+		prediction := w.predict(w.State, i, entropy)
+		next := Context{w.State[1], byte(Level(prediction, WorldLevels))}
+		w.Values[i] = prediction/256 + WorldDiscount*w.rollout(next, prediction, w.Depth-1)
+	}
+	w.Normalized = ApplyMask(softmax(w.Values, w.Schedule.Temperature(.1, entropy)), mask)
+	sum, action, selected := 0.0, 0, rng.Float64()
+	for i, value := range w.Normalized {
+		sum += value
+		if sum > selected {
+			action = i
+			break
+		}
+	}
+	w.Action = action
+	w.Initialized = true
+	w.Visits[action]++
+	return action
+}
+
+// Reset resets the world model mind
+func (w *WorldMind) Reset() {
+	w.State = Context{}
+	w.Model = make(map[Context][]float64)
+	w.Entropy = 0
+	w.Values = nil
+	w.Normalized = nil
+	w.Action = 0
+	w.Initialized = false
+	w.Visits = make([]uint64, w.Actions)
+	w.Schedule.Reset()
+}
+
+// Introspect returns a snapshot of the world model mind, the estimates are the
+// rollout values of each action
+func (w *WorldMind) Introspect() Introspection {
+	introspection := NewIntrospection(w.Action, w.Normalized, w.Visits, w.Values)
+	introspection.Details["contexts"] = float64(len(w.Model))
+	return introspection
+}
+
+// Save saves the world model mind
+func (w *WorldMind) Save(writer io.Writer) error {
+	return gob.NewEncoder(writer).Encode(w)
+}
+
+// Load loads the world model mind
+func (w *WorldMind) Load(r io.Reader) error {
+	*w = WorldMind{}
+	err := gob.NewDecoder(r).Decode(w)
+	if w.Model == nil {
+		w.Model = make(map[Context][]float64)
+	}
+	w.Visits = visits(w.Visits, w.Actions)
+	return err
+}